@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// syntheticSession builds a message stream mixing streamed text, tool calls and tool results,
+// shaped like a real session, for measuring rendering throughput
+func syntheticSession(turns int) []interface{} {
+	messages := []interface{}{
+		&SystemInit{Type: "system", Subtype: "init", SessionID: "benchmark", Model: "benchmark-model"},
+	}
+
+	text := "Looking at the code to find where the output is rendered. "
+	output := "main.go\noutput.go\nrunner.go\ntypes.go\ncolors.go\nformat.go\n"
+
+	for i := 0; i < turns; i++ {
+		toolID := fmt.Sprintf("toolu_%d", i)
+		input, _ := json.Marshal(map[string]interface{}{"command": "ls -la", "description": "List files"})
+
+		// Streamed text, a few deltas per turn
+		for j := 0; j < 5; j++ {
+			messages = append(messages, &StreamEvent{
+				Type:  StreamEventContentBlockDelta,
+				Delta: &Delta{Type: "text_delta", Text: text},
+			})
+		}
+		messages = append(messages, &StreamEvent{
+			Type:         StreamEventContentBlockStart,
+			ContentBlock: &ContentBlock{Type: ContentBlockTypeToolUse, ID: toolID, Name: "Bash", Input: input},
+		})
+		messages = append(messages, &AssistantMessage{
+			Type: "assistant",
+			Message: MessageContent{
+				ID:   fmt.Sprintf("msg_%d", i),
+				Role: "assistant",
+				Content: []ContentBlock{
+					{Type: ContentBlockTypeText, Text: text},
+					{Type: ContentBlockTypeToolUse, ID: toolID, Name: "Bash", Input: input},
+				},
+				Usage: &Usage{InputTokens: 100, OutputTokens: 50},
+			},
+		})
+		messages = append(messages, &AssistantMessage{
+			Type: "assistant",
+			Message: MessageContent{
+				Content: []ContentBlock{{Type: ContentBlockTypeToolResult, ToolUseID: toolID, Content: output}},
+			},
+		})
+	}
+
+	messages = append(messages, &Result{
+		Type:       "result",
+		Subtype:    "success",
+		TotalCost:  0.01,
+		DurationMS: 1000,
+		NumTurns:   turns,
+		Usage:      &TotalUsage{InputTokens: 100 * turns, OutputTokens: 50 * turns},
+	})
+	return messages
+}
+
+// replayMessages feeds messages through ProcessMessages and returns once rendering finishes
+func replayMessages(p *OutputProcessor, messages []interface{}) {
+	ch := make(chan interface{}, len(messages))
+	for _, msg := range messages {
+		ch <- msg
+	}
+	close(ch)
+	p.ProcessMessages(ch, nil)
+}
+
+// runBenchmark renders a synthetic session with output discarded and reports throughput to w.
+// It backs the hidden --benchmark flag.
+func runBenchmark(w io.Writer, turns int) {
+	messages := syntheticSession(turns)
+
+	p := NewOutputProcessor("text", false, false)
+	p.writer = io.Discard
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	replayMessages(p, messages)
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	count := len(messages)
+	fmt.Fprintf(w, "Rendered %d messages in %s\n", count, elapsed.Round(time.Microsecond))
+	fmt.Fprintf(w, "Throughput: %.0f msgs/sec\n", float64(count)/elapsed.Seconds())
+	fmt.Fprintf(w, "Allocations: %.1f allocs/msg, %.0f bytes/msg\n",
+		float64(after.Mallocs-before.Mallocs)/float64(count), float64(after.TotalAlloc-before.TotalAlloc)/float64(count))
+}
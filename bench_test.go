@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func BenchmarkProcessMessages(b *testing.B) {
+	messages := syntheticSession(100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := NewOutputProcessor("text", false, false)
+		p.writer = io.Discard
+		replayMessages(p, messages)
+	}
+	b.ReportMetric(float64(len(messages)*b.N)/b.Elapsed().Seconds(), "msgs/sec")
+}
+
+func TestSyntheticSession_Renders(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	replayMessages(p, syntheticSession(3))
+
+	output := w.String()
+	if strings.Count(output, "→ Bash: ls -la") != 3 {
+		t.Errorf("expected 3 tool calls rendered, got: %q", output)
+	}
+	if !strings.Contains(output, "Turns: 3") {
+		t.Errorf("expected final summary, got: %q", output)
+	}
+}
+
+func TestRunBenchmark(t *testing.T) {
+	var out bytes.Buffer
+	runBenchmark(&out, 10)
+
+	for _, want := range []string{"Rendered 82 messages", "msgs/sec", "allocs/msg"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in report, got: %q", want, out.String())
+		}
+	}
+}
+
+func BenchmarkPrintToolCall_VerboseInput(b *testing.B) {
+	p := NewOutputProcessor("text", true, false)
+	p.writer = io.Discard
+	toolCall := createTestToolCall("tool_1", "CustomTool", map[string]interface{}{
+		"description": "Sync records",
+		"records":     []interface{}{"a", "b", "c", "d", "e", "f", "g", "h"},
+		"options":     map[string]interface{}{"dry_run": true, "batch": float64(50)},
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.printToolCall(toolCall)
+	}
+}
+
+func BenchmarkToolCall_LargeInput(b *testing.B) {
+	p := NewOutputProcessor("text", false, false)
+	p.writer = io.Discard
+	p.state.InitializeSession(createTestSystemInit("bench", "model"))
+	block := createTestToolUseBlock("task_1", "Task", map[string]interface{}{
+		"subagent_type": "Explore",
+		"description":   "Survey the codebase",
+		"prompt":        strings.Repeat("Look through every package and summarize it. ", 2000),
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Streamed start, then the complete block with identical input
+		p.handleContentBlockStart(&StreamEvent{Type: StreamEventContentBlockStart, ContentBlock: block})
+		p.processContentBlock(block)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// clipboardCommands print the system clipboard, in the order they are tried: macOS, Wayland, X11
+var clipboardCommands = [][]string{
+	{"pbpaste"},
+	{"wl-paste", "--no-newline"},
+	{"xclip", "-selection", "clipboard", "-o"},
+	{"xsel", "--clipboard", "--output"},
+}
+
+// readClipboard returns the clipboard contents using the first clipboard tool installed
+func readClipboard() (string, error) {
+	for _, command := range clipboardCommands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", command[0], err)
+		}
+		text := strings.TrimSpace(string(out))
+		if text == "" {
+			return "", fmt.Errorf("the clipboard is empty")
+		}
+		return text, nil
+	}
+	return "", fmt.Errorf("no clipboard tool found (pbpaste, wl-paste, xclip or xsel)")
+}
+
+// withClipboardPrompt makes the clipboard text the prompt. A prompt already given leads it,
+// separated by a blank line, e.g. ccv --clipboard "Review this diff:".
+func withClipboardPrompt(args []string, text string) []string {
+	if i := promptIndex(args); i >= 0 {
+		args = append([]string(nil), args...)
+		args[i] += "\n\n" + text
+		return args
+	}
+	return append(args[:len(args):len(args)], text)
+}
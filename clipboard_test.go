@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// stubClipboard puts a pbpaste on PATH that prints text, and nothing else
+func stubClipboard(t *testing.T, text string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub clipboard tool is a shell script")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s' '" + text + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "pbpaste"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestRun_Clipboard(t *testing.T) {
+	stubClipboard(t, "Fix the flaky test in runner_test.go")
+
+	runner := newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out strings.Builder
+	if code := run([]string{"--clipboard"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if got := strings.Join(*gotArgs, "|"); got != "Fix the flaky test in runner_test.go" {
+		t.Errorf("expected the clipboard as the prompt, got args: %q", got)
+	}
+
+	// A prompt given alongside leads the clipboard text
+	runner = newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	gotArgs, restore = useScriptedRunner(runner)
+	defer restore()
+	if code := run([]string{"--clipboard", "--model", "sonnet", "Do this:"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if got := strings.Join(*gotArgs, "|"); got != "--model|sonnet|Do this:\n\nFix the flaky test in runner_test.go" {
+		t.Errorf("expected the given prompt before the clipboard, got args: %q", got)
+	}
+
+	// A flag value isn't taken for the prompt
+	runner = newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	gotArgs, restore = useScriptedRunner(runner)
+	defer restore()
+	if code := run([]string{"--clipboard", "--model", "sonnet"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if got := strings.Join(*gotArgs, "|"); got != "--model|sonnet|Fix the flaky test in runner_test.go" {
+		t.Errorf("expected the clipboard appended as the prompt, got args: %q", got)
+	}
+}
+
+func TestRun_ClipboardUnavailable(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	runner := newScriptedRunner(nil, 0)
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out strings.Builder
+	if code := run([]string{"--clipboard"}, &out); code != 1 {
+		t.Errorf("run() = %d without a clipboard tool, want 1", code)
+	}
+	if *gotArgs != nil {
+		t.Errorf("expected claude not to run, got args: %q", *gotArgs)
+	}
+}
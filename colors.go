@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strconv"
 )
 
 // ANSI color codes
@@ -10,6 +11,7 @@ const (
 	Bold    = "\033[1m"
 	Dim     = "\033[2m"
 	Italic  = "\033[3m"
+	Reverse = "\033[7m"
 
 	// Colors
 	Black   = "\033[30m"
@@ -66,6 +68,12 @@ type ColorScheme struct {
 	// File paths
 	FilePath string // File paths in tool calls
 
+	// Search term highlighting
+	Highlight string // --highlight matches
+
+	// Warnings
+	Warning string // --confirm-tools "about to run" lines
+
 	// Reset
 	Reset string
 }
@@ -116,6 +124,12 @@ func DefaultScheme() *ColorScheme {
 		// File paths - green as per visual requirements
 		FilePath: Green,
 
+		// Highlighted terms - reverse video so they stand out on any background
+		Highlight: Bold + Reverse,
+
+		// Warnings - bold yellow so advisory notices stand out from tool lines
+		Warning: Bold + Yellow,
+
 		Reset: Reset,
 	}
 }
@@ -135,7 +149,22 @@ func initColors() {
 		return
 	}
 
-	// Colors stay enabled by default (no terminal check)
+	// Colors stay enabled by default; redirected stdout turns them off via --pipe in main.go
+}
+
+// defaultTerminalWidth is assumed when the terminal width isn't known
+const defaultTerminalWidth = 80
+
+// terminalWidth returns the width of the terminal on stdout. When stdout isn't a terminal it
+// falls back to COLUMNS, then defaultTerminalWidth.
+func terminalWidth() int {
+	if n, ok := fdWidth(os.Stdout.Fd()); ok {
+		return n
+	}
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultTerminalWidth
 }
 
 // NoColorScheme returns a scheme with no colors (empty strings)
@@ -152,6 +181,32 @@ func GetScheme() *ColorScheme {
 	return DefaultScheme()
 }
 
+// Glyphs defines the symbols decorating tool lines. Each includes its trailing space,
+// so an empty glyph leaves no gap behind.
+type Glyphs struct {
+	ToolArrow string // Before each tool call
+	Success   string // Before successful results
+	Failure   string // Before failed results
+	Thinking  string // Before thinking blocks
+	Gist      string // Before one-line thinking gists
+}
+
+// DefaultGlyphs returns the glyphs used in text and verbose output
+func DefaultGlyphs() *Glyphs {
+	return &Glyphs{
+		ToolArrow: "→ ",
+		Success:   "✓ ",
+		Failure:   "✗ ",
+		Thinking:  "[THINKING] ",
+		Gist:      "[thinking] ",
+	}
+}
+
+// PlainGlyphs returns empty glyphs, for --format plain
+func PlainGlyphs() *Glyphs {
+	return &Glyphs{}
+}
+
 // C is a helper that returns the color code if colors are enabled, empty string otherwise
 func C(color string) string {
 	if colorEnabled {
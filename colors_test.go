@@ -35,6 +35,8 @@ func TestDefaultScheme(t *testing.T) {
 		{"LabelDim", scheme.LabelDim},
 		{"ValueBright", scheme.ValueBright},
 		{"FilePath", scheme.FilePath},
+		{"Highlight", scheme.Highlight},
+		{"Warning", scheme.Warning},
 		{"Reset", scheme.Reset},
 	}
 
@@ -75,6 +77,8 @@ func TestNoColorScheme(t *testing.T) {
 		{"LabelDim", scheme.LabelDim},
 		{"ValueBright", scheme.ValueBright},
 		{"FilePath", scheme.FilePath},
+		{"Highlight", scheme.Highlight},
+		{"Warning", scheme.Warning},
 		{"Reset", scheme.Reset},
 	}
 
@@ -328,6 +332,32 @@ func TestInitColors_NormalTerm(t *testing.T) {
 	// The test just verifies it doesn't get disabled for normal TERM
 }
 
+// TestTerminalWidth_Fallback tests COLUMNS, then the default, are used when stdout isn't a terminal
+func TestTerminalWidth_Fallback(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, ok := fdWidth(f.Fd()); ok {
+		t.Error("expected no terminal width for a regular file")
+	}
+
+	origStdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = origStdout }()
+
+	t.Setenv("COLUMNS", "120")
+	if got := terminalWidth(); got != 120 {
+		t.Errorf("expected COLUMNS width 120, got %d", got)
+	}
+	t.Setenv("COLUMNS", "")
+	if got := terminalWidth(); got != defaultTerminalWidth {
+		t.Errorf("expected default width %d, got %d", defaultTerminalWidth, got)
+	}
+}
+
 func TestColorConstants(t *testing.T) {
 	// Verify that color constants are ANSI escape sequences
 	constants := []struct {
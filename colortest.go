@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// colorSwatches returns each color of the scheme with its field name, in declaration order.
+// Reset is left out since it is what ends every swatch.
+func colorSwatches(c *ColorScheme) [][2]string {
+	var swatches [][2]string
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if name == "Reset" {
+			continue
+		}
+		swatches = append(swatches, [2]string{name, v.Field(i).String()})
+	}
+	return swatches
+}
+
+// colorTestSession is a short session touching each kind of rendered block, for --color-test
+func colorTestSession() []interface{} {
+	messages := []interface{}{
+		&SystemInit{Type: "system", Subtype: "init", SessionID: "color-test", Model: "claude-sonnet-4-5"},
+	}
+	turn := func(id string, blocks ...ContentBlock) {
+		// Tool calls are registered by their stream start, as in a live session
+		for i := range blocks {
+			if blocks[i].Type == ContentBlockTypeToolUse {
+				messages = append(messages, &StreamEvent{Type: StreamEventContentBlockStart, ContentBlock: &blocks[i]})
+			}
+		}
+		messages = append(messages, &AssistantMessage{Type: "assistant", Message: MessageContent{ID: id, Role: "assistant", Content: blocks}})
+	}
+	toolUse := func(id, name string, input map[string]interface{}) ContentBlock {
+		data, _ := json.Marshal(input)
+		return ContentBlock{Type: ContentBlockTypeToolUse, ID: id, Name: name, Input: data}
+	}
+	// Results come back in a user message, as claude sends them
+	result := func(id, content string, isError bool) {
+		messages = append(messages, &UserMessage{Type: "user", Message: UserMessageContent{Role: "user", Content: []ContentBlock{
+			{Type: ContentBlockTypeToolResult, ToolUseID: id, Content: content, IsError: isError},
+		}}})
+	}
+
+	turn("msg_1",
+		ContentBlock{Type: ContentBlockTypeThinking, Thinking: "The failing test reads the config before it is written."},
+		ContentBlock{Type: ContentBlockTypeText, Text: "Let me look at the config loader."},
+		toolUse("toolu_1", "Read", map[string]interface{}{"file_path": "config/load.go"}),
+	)
+	result("toolu_1", "func Load() (*Config, error) {", false)
+	turn("msg_2", toolUse("toolu_2", "Edit", map[string]interface{}{"file_path": "config/load.go", "old_string": "return nil, err", "new_string": "return defaults(), nil"}))
+	result("toolu_2", "The file config/load.go has been updated.", false)
+	turn("msg_3", toolUse("toolu_3", "Bash", map[string]interface{}{"command": "go test ./config", "description": "Run the config tests"}))
+	result("toolu_3", "--- FAIL: TestLoad (0.00s)", true)
+
+	return append(messages, &Result{
+		Type:       "result",
+		Subtype:    "success",
+		TotalCost:  0.0123,
+		DurationMS: 8400,
+		NumTurns:   3,
+		Usage:      &TotalUsage{InputTokens: 1240, OutputTokens: 380},
+	})
+}
+
+// runColorTest previews the active color scheme (--color-test): a labeled swatch of every
+// color, then a sample session rendered with it
+func runColorTest(w io.Writer) {
+	c := GetScheme()
+	for _, swatch := range colorSwatches(c) {
+		fmt.Fprintf(w, "%-15s %sSample text%s\n", swatch[0], swatch[1], c.Reset)
+	}
+	fmt.Fprintln(w)
+
+	p := NewOutputProcessor("text", false, false)
+	p.writer = w
+	replayMessages(p, colorTestSession())
+}
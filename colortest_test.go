@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun_ColorTest(t *testing.T) {
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--color-test", "--no-color"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	output := out.String()
+	for _, label := range []string{"ToolName ", "FilePath ", "DiffAdd ", "DiffRemove ", "Error ", "ThinkingPrefix ", "Warning "} {
+		if !strings.Contains(output, label) {
+			t.Errorf("expected a swatch labeled %q, got: %q", label, output)
+		}
+	}
+	for _, sample := range []string{"→ Edit: config/load.go", "+ return defaults(), nil", "✗ Command failed", "Cost: $0.0123"} {
+		if !strings.Contains(output, sample) {
+			t.Errorf("expected the sample session to render %q, got: %q", sample, output)
+		}
+	}
+}
+
+func TestColorSwatches(t *testing.T) {
+	swatches := colorSwatches(DefaultScheme())
+	if len(swatches) == 0 || swatches[0] != [2]string{"ToolArrow", Cyan} {
+		t.Errorf("expected swatches in declaration order, got: %v", swatches)
+	}
+	for _, swatch := range swatches {
+		if swatch[0] == "Reset" {
+			t.Error("expected Reset to be left out")
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxCompareTextLen caps how much of a text step is shown in a comparison
+const maxCompareTextLen = 80
+
+// sessionSteps loads a JSONL session and reduces it to the sequence of assistant text
+// and tool calls, one label per step. Stream events are skipped since the complete
+// assistant messages carry the same content.
+func sessionSteps(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var steps []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSuffix(scanner.Bytes(), []byte("\r"))
+		if len(line) == 0 {
+			continue
+		}
+		msg, err := ParseMessage(line)
+		if err != nil {
+			// Transcripts may hold lines ccv doesn't know; they carry no steps
+			continue
+		}
+		if m, ok := msg.(*AssistantMessage); ok {
+			steps = append(steps, contentSteps(m.Message.Content)...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return steps, nil
+}
+
+// contentSteps labels the text and tool_use blocks of a message, e.g. "→ Bash: ls" or "text: Done."
+func contentSteps(blocks []ContentBlock) []string {
+	var steps []string
+	for _, block := range blocks {
+		switch block.Type {
+		case ContentBlockTypeText:
+			text := strings.TrimSpace(block.Text)
+			if text == "" {
+				continue
+			}
+			if i := strings.IndexByte(text, '\n'); i >= 0 {
+				text = text[:i] + " …"
+			}
+			if runes := []rune(text); len(runes) > maxCompareTextLen {
+				text = string(runes[:maxCompareTextLen]) + "…"
+			}
+			steps = append(steps, "text: "+text)
+		case ContentBlockTypeToolUse:
+			tc := &ToolCall{Name: block.Name, Input: block.Input}
+			if target, _ := toolTarget(tc); target != "" {
+				steps = append(steps, fmt.Sprintf("→ %s: %s", FormatMCPToolName(block.Name), target))
+			} else {
+				steps = append(steps, "→ "+FormatMCPToolName(block.Name))
+			}
+		}
+	}
+	return steps
+}
+
+// alignSteps aligns two step sequences on their longest common subsequence, so the
+// result lists shared steps once and marks steps only in a as removed and only in b as added
+func alignSteps(a, b []string) []DiffLine {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: DiffOpSame, Line: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: DiffOpRemove, Line: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: DiffOpAdd, Line: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: DiffOpRemove, Line: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: DiffOpAdd, Line: b[j]})
+	}
+	return diff
+}
+
+// runCompare prints the step-level diff of two sessions and flags where they first diverge.
+// It backs --compare.
+func runCompare(w io.Writer, pathA, pathB string, c *ColorScheme) error {
+	stepsA, err := sessionSteps(pathA)
+	if err != nil {
+		return err
+	}
+	stepsB, err := sessionSteps(pathB)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s--- %s%s\n", c.DiffRemove, pathA, c.Reset)
+	fmt.Fprintf(w, "%s+++ %s%s\n", c.DiffAdd, pathB, c.Reset)
+
+	divergence := 0
+	for n, d := range alignSteps(stepsA, stepsB) {
+		switch d.Op {
+		case DiffOpSame:
+			fmt.Fprintf(w, "  %s\n", d.Line)
+		case DiffOpRemove:
+			fmt.Fprintf(w, "%s- %s%s\n", c.DiffRemove, d.Line, c.Reset)
+		case DiffOpAdd:
+			fmt.Fprintf(w, "%s+ %s%s\n", c.DiffAdd, d.Line, c.Reset)
+		}
+		if d.Op != DiffOpSame && divergence == 0 {
+			divergence = n + 1
+		}
+	}
+
+	fmt.Fprintln(w)
+	if divergence == 0 {
+		fmt.Fprintf(w, "%sSessions match (%d steps)%s\n", c.Success, len(stepsA), c.Reset)
+		return nil
+	}
+	fmt.Fprintf(w, "%s⚠ sessions diverge at step %d%s\n", c.Warning, divergence, c.Reset)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSession writes JSONL lines to a file in dir and returns its path
+func writeSession(t *testing.T, dir, name string, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunCompare_FlagsDivergence(t *testing.T) {
+	dir := t.TempDir()
+	readLine := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Read","input":{"file_path":"main.go"}}]}}`
+	doneLine := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"All tests pass."}]}}`
+
+	a := writeSession(t, dir, "a.jsonl",
+		`{"type":"system","subtype":"init","session_id":"a","model":"m"}`,
+		readLine,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t2","name":"Bash","input":{"command":"go test ./..."}}]}}`,
+		doneLine,
+	)
+	b := writeSession(t, dir, "b.jsonl",
+		`{"type":"system","subtype":"init","session_id":"b","model":"m"}`,
+		readLine,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t2","name":"Bash","input":{"command":"go build ./..."}}]}}`,
+		doneLine,
+	)
+
+	var out bytes.Buffer
+	if err := runCompare(&out, a, b, NoColorScheme()); err != nil {
+		t.Fatalf("runCompare() error: %v", err)
+	}
+
+	want := "  → Read: main.go\n- → Bash: go test ./...\n+ → Bash: go build ./...\n  text: All tests pass.\n"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("expected aligned steps with the differing tool call marked, got: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "⚠ sessions diverge at step 2") {
+		t.Errorf("expected divergence flagged, got: %q", out.String())
+	}
+
+	out.Reset()
+	if err := runCompare(&out, a, a, NoColorScheme()); err != nil {
+		t.Fatalf("runCompare() error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Sessions match (3 steps)") {
+		t.Errorf("expected identical sessions to match, got: %q", out.String())
+	}
+}
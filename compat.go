@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// claudeVersion is a parsed claude CLI version, e.g. 2.0.14
+type claudeVersion struct {
+	Major, Minor, Patch int
+}
+
+func (v claudeVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// less reports whether v is an older release than o
+func (v claudeVersion) less(o claudeVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+var (
+	// testedClaudeVersion is the claude release line ccv's rendering was last checked against.
+	// Other minor versions get a dim note in verbose mode.
+	testedClaudeVersion = claudeVersion{Major: 2, Minor: 0}
+
+	// minCompatibleClaudeVersion is the oldest claude whose stream-json ccv renders correctly.
+	// Older versions, and newer major versions, get a warning.
+	minCompatibleClaudeVersion = claudeVersion{Major: 1, Minor: 0}
+)
+
+// parseClaudeVersion parses the claude_code_version reported at session start. It tolerates
+// a leading "v", a suffix such as " (Claude Code)", pre-release and build metadata, and
+// missing minor or patch numbers.
+func parseClaudeVersion(s string) (claudeVersion, bool) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, " -+"); i >= 0 {
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return claudeVersion{}, false
+	}
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return claudeVersion{}, false
+		}
+		nums[i] = n
+	}
+	return claudeVersion{Major: nums[0], Minor: nums[1], Patch: nums[2]}, true
+}
+
+// claudeCompatibility describes how a claude version relates to the versions ccv was tested
+// against. note is empty for a tested version; breaking is set for versions known or likely
+// to render incorrectly.
+func claudeCompatibility(version string) (note string, breaking bool) {
+	v, ok := parseClaudeVersion(version)
+	if !ok {
+		return "", false
+	}
+
+	tested := fmt.Sprintf("%d.%d.x", testedClaudeVersion.Major, testedClaudeVersion.Minor)
+	switch {
+	case v.less(minCompatibleClaudeVersion):
+		return fmt.Sprintf("claude %s is older than %s, the oldest version ccv supports; output may render incorrectly", v, minCompatibleClaudeVersion), true
+	case v.Major > testedClaudeVersion.Major:
+		return fmt.Sprintf("claude %s is a newer major version than ccv was tested with (%s); output may render incorrectly", v, tested), true
+	case v.Major != testedClaudeVersion.Major || v.Minor != testedClaudeVersion.Minor:
+		return fmt.Sprintf("ccv was tested with claude %s, this is %s", tested, v), false
+	}
+	return "", false
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestParseClaudeVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  claudeVersion
+		ok    bool
+	}{
+		{"2.0.14", claudeVersion{2, 0, 14}, true},
+		{"v1.0.3", claudeVersion{1, 0, 3}, true},
+		{"2.0.14 (Claude Code)", claudeVersion{2, 0, 14}, true},
+		{"2.1.0-beta.2", claudeVersion{2, 1, 0}, true},
+		{"2.1.0+build.7", claudeVersion{2, 1, 0}, true},
+		{"2.1", claudeVersion{2, 1, 0}, true},
+		{"", claudeVersion{}, false},
+		{"latest", claudeVersion{}, false},
+		{"1.2.3.4", claudeVersion{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseClaudeVersion(tt.input)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseClaudeVersion(%q) = %v, %v; want %v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClaudeCompatibility(t *testing.T) {
+	tests := []struct {
+		version  string
+		noted    bool
+		breaking bool
+	}{
+		{"2.0.14", false, false},
+		{"2.1.3", true, false},
+		{"1.0.100", true, false},
+		{"0.2.9", true, true},
+		{"3.0.0", true, true},
+		{"garbage", false, false},
+	}
+
+	for _, tt := range tests {
+		note, breaking := claudeCompatibility(tt.version)
+		if (note != "") != tt.noted || breaking != tt.breaking {
+			t.Errorf("claudeCompatibility(%q) = %q, %v; want noted=%v, breaking=%v", tt.version, note, breaking, tt.noted, tt.breaking)
+		}
+	}
+}
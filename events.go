@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// EventType identifies a normalized event in the ccv event stream
+type EventType string
+
+const (
+	EventSessionStart EventType = "session_start"
+	EventText         EventType = "text"
+	EventThinking     EventType = "thinking"
+	EventToolCall     EventType = "tool_call"
+	EventToolResult   EventType = "tool_result"
+	EventResult       EventType = "result"
+	EventTodos        EventType = "todos"
+)
+
+// rootAgentID is the agent ID used for events from the main agent
+const rootAgentID = "main"
+
+// Event is a normalized event with a stable schema, independent of the SDK message format
+type Event struct {
+	Type      EventType `json:"ccv_event"`
+	Timestamp string    `json:"timestamp"` // RFC 3339
+	AgentID   string    `json:"agent_id"`  // "main" or the ID of the Task tool call that spawned the agent
+	Depth     int       `json:"depth"`     // 0 for the main agent
+
+	// session_start
+	SessionID string `json:"session_id,omitempty"`
+	Model     string `json:"model,omitempty"`
+
+	// text, thinking
+	Text string `json:"text,omitempty"`
+
+	// tool_call, tool_result
+	ToolID   string          `json:"tool_id,omitempty"`
+	ToolName string          `json:"tool_name,omitempty"`
+	Input    json.RawMessage `json:"input,omitempty"`
+	Content  string          `json:"content,omitempty"`
+	IsError  bool            `json:"is_error,omitempty"`
+
+	// tool_call for Edit and MultiEdit
+	FilePath string     `json:"file_path,omitempty"`
+	Diff     []DiffLine `json:"diff,omitempty"`
+	Added    int        `json:"added,omitempty"`
+	Removed  int        `json:"removed,omitempty"`
+
+	// todos, after each TodoWrite; items keep the list's order
+	Todos     []TodoItem `json:"todos,omitempty"`
+	Completed int        `json:"completed,omitempty"`
+	Total     int        `json:"total,omitempty"`
+
+	// result
+	CostUSD    float64     `json:"cost_usd,omitempty"`
+	DurationMS int64       `json:"duration_ms,omitempty"`
+	NumTurns   int         `json:"num_turns,omitempty"`
+	Usage      *TotalUsage `json:"usage,omitempty"`
+}
+
+// EventEmitter normalizes SDK messages into Events and writes them as NDJSON to each sink
+type EventEmitter struct {
+	sinks     []io.Writer
+	toolNames map[string]string // tool ID -> tool name, for labeling results
+	depths    map[string]int    // Task tool ID -> depth of the agent it spawned
+	now       func() time.Time
+}
+
+// NewEventEmitter creates an emitter writing to the given sinks
+func NewEventEmitter(sinks ...io.Writer) *EventEmitter {
+	return &EventEmitter{
+		sinks:     sinks,
+		toolNames: make(map[string]string),
+		depths:    make(map[string]int),
+		now:       time.Now,
+	}
+}
+
+// AddSink adds another writer that receives every event
+func (e *EventEmitter) AddSink(w io.Writer) {
+	e.sinks = append(e.sinks, w)
+}
+
+// Observe emits the normalized events for a message.
+// Stream events are skipped since the complete messages carry the same content.
+func (e *EventEmitter) Observe(msg interface{}) {
+	switch m := msg.(type) {
+	case *SystemInit:
+		e.emit(Event{Type: EventSessionStart, AgentID: rootAgentID, SessionID: m.SessionID, Model: m.Model})
+	case *AssistantMessage:
+		e.observeBlocks(m.Message.Content, m.ParentToolUseID)
+	case *UserMessage:
+		e.observeBlocks(m.Message.Content, m.ParentToolUseID)
+	case *Result:
+		e.emit(Event{
+			Type:       EventResult,
+			AgentID:    rootAgentID,
+			SessionID:  m.SessionID,
+			IsError:    m.IsError,
+			CostUSD:    m.TotalCost,
+			DurationMS: m.DurationMS,
+			NumTurns:   m.NumTurns,
+			Usage:      m.Usage,
+		})
+	}
+}
+
+// observeBlocks emits an event per content block, attributed to the agent that produced it
+func (e *EventEmitter) observeBlocks(blocks []ContentBlock, parentToolUseID *string) {
+	agentID := rootAgentID
+	depth := 0
+	if parentToolUseID != nil && *parentToolUseID != "" {
+		agentID = *parentToolUseID
+		depth = e.depths[agentID]
+	}
+
+	for _, block := range blocks {
+		event := Event{AgentID: agentID, Depth: depth}
+
+		switch block.Type {
+		case ContentBlockTypeText:
+			event.Type = EventText
+			event.Text = block.Text
+		case ContentBlockTypeThinking:
+			event.Type = EventThinking
+			event.Text = block.Thinking
+		case ContentBlockTypeToolUse:
+			e.toolNames[block.ID] = block.Name
+			if block.Name == "Task" {
+				e.depths[block.ID] = depth + 1
+			}
+			event.Type = EventToolCall
+			event.ToolID = block.ID
+			event.ToolName = block.Name
+			event.Input = block.Input
+			if block.Name == "Edit" || block.Name == "MultiEdit" {
+				addEditDiff(&event, block.Input)
+			}
+		case ContentBlockTypeToolResult:
+			event.Type = EventToolResult
+			event.ToolID = block.ToolUseID
+			event.ToolName = e.toolNames[block.ToolUseID]
+			event.Content = block.Content
+			event.IsError = block.IsError
+		default:
+			continue
+		}
+
+		e.emit(event)
+
+		// A TodoWrite also gets a todos event, so progress doesn't need the raw input shape
+		if event.Type == EventToolCall && block.Name == "TodoWrite" {
+			todos := Event{Type: EventTodos, AgentID: agentID, Depth: depth, ToolID: block.ID}
+			if addTodos(&todos, block.Input) {
+				e.emit(todos)
+			}
+		}
+	}
+}
+
+// emit timestamps an event and writes it as a JSON line to every sink
+func (e *EventEmitter) emit(event Event) {
+	event.Timestamp = e.now().UTC().Format(time.RFC3339Nano)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling event: %v\n", err)
+		return
+	}
+	data = append(data, '\n')
+
+	for _, sink := range e.sinks {
+		if _, err := sink.Write(data); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing event: %v\n", err)
+		}
+	}
+}
+
+// addTodos attaches the list of a TodoWrite input and its completion counts to an event.
+// It reports false if the input holds no todo list.
+func addTodos(event *Event, input json.RawMessage) bool {
+	var todoInput struct {
+		Todos []TodoItem `json:"todos"`
+	}
+	if err := json.Unmarshal(input, &todoInput); err != nil || todoInput.Todos == nil {
+		return false
+	}
+
+	event.Todos = todoInput.Todos
+	event.Completed, event.Total = todoCounts(todoInput.Todos)
+	return true
+}
+
+// addEditDiff attaches the structured diff of an Edit or MultiEdit input to an event
+func addEditDiff(event *Event, input json.RawMessage) {
+	var inputMap map[string]interface{}
+	if len(input) > 0 {
+		// Ignore error - the event still carries the raw input
+		_ = json.Unmarshal(input, &inputMap)
+	}
+
+	event.FilePath, _ = inputMap["file_path"].(string)
+
+	// Edit carries a single old/new pair, MultiEdit a list of them
+	edits := []interface{}{inputMap}
+	if list, ok := inputMap["edits"].([]interface{}); ok {
+		edits = list
+	}
+
+	for _, edit := range edits {
+		editMap, ok := edit.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		oldStr, hasOld := editMap["old_string"].(string)
+		newStr, hasNew := editMap["new_string"].(string)
+		if !hasOld || !hasNew {
+			continue
+		}
+		for _, d := range diffLines(oldStr, newStr) {
+			if d.Op == DiffOpAdd {
+				event.Added++
+			} else {
+				event.Removed++
+			}
+			event.Diff = append(event.Diff, d)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeEvents parses NDJSON event output into Events
+func decodeEvents(t *testing.T, data string) []Event {
+	t.Helper()
+
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid event line %q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEventEmitter_Observe(t *testing.T) {
+	var a, b bytes.Buffer
+	e := NewEventEmitter(&a)
+	e.AddSink(&b)
+	e.now = func() time.Time { return time.Date(2025, 1, 22, 10, 0, 0, 0, time.UTC) }
+
+	taskID := "task_1"
+	e.Observe(createTestSystemInit("session-1", "model"))
+	e.Observe(createTestAssistantMessage([]ContentBlock{
+		{Type: ContentBlockTypeThinking, Thinking: "Delegating"},
+		*createTestToolUseBlock(taskID, "Task", map[string]interface{}{"subagent_type": "Explore"}),
+	}))
+	e.Observe(&AssistantMessage{
+		Type:            "assistant",
+		ParentToolUseID: &taskID,
+		Message: MessageContent{Content: []ContentBlock{
+			*createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls"}),
+		}},
+	})
+	e.Observe(&UserMessage{
+		Type:            "user",
+		ParentToolUseID: &taskID,
+		Message:         UserMessageContent{Role: "user", Content: []ContentBlock{*createTestToolResultBlock("tool_1", "main.go", false)}},
+	})
+	e.Observe(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "ignored"}, nil))
+	e.Observe(createTestResult(0.01, 1000, 1))
+
+	if a.String() != b.String() {
+		t.Errorf("expected every sink to receive the same events")
+	}
+
+	events := decodeEvents(t, a.String())
+	want := []struct {
+		typ     EventType
+		agentID string
+		depth   int
+	}{
+		{EventSessionStart, "main", 0},
+		{EventThinking, "main", 0},
+		{EventToolCall, "main", 0},
+		{EventToolCall, taskID, 1},
+		{EventToolResult, taskID, 1},
+		{EventResult, "main", 0},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d: %s", len(want), len(events), a.String())
+	}
+	for i, w := range want {
+		if events[i].Type != w.typ || events[i].AgentID != w.agentID || events[i].Depth != w.depth {
+			t.Errorf("event[%d] = %s/%s/%d, want %s/%s/%d", i, events[i].Type, events[i].AgentID, events[i].Depth, w.typ, w.agentID, w.depth)
+		}
+		if events[i].Timestamp != "2025-01-22T10:00:00Z" {
+			t.Errorf("event[%d] timestamp = %q", i, events[i].Timestamp)
+		}
+	}
+
+	if events[4].ToolName != "Bash" || events[4].Content != "main.go" {
+		t.Errorf("expected tool result labeled with its tool, got: %+v", events[4])
+	}
+}
+
+// TestRun_EventsOut tests --events-out captures normalized events while rendering text
+func TestRun_EventsOut(t *testing.T) {
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-events", "claude-sonnet-4-5"),
+		createTestAssistantMessage([]ContentBlock{
+			{Type: ContentBlockTypeText, Text: "Listing files."},
+		}),
+		createTestResult(0.0123, 2500, 1),
+	}, 0)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	var out bytes.Buffer
+	if code := run([]string{"--no-color", "--events-out", path, "List the files"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	if !strings.Contains(out.String(), "[Session started: claude-sonnet-4-5]") {
+		t.Errorf("expected rendered text output, got: %q", out.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading events file: %v", err)
+	}
+	events := decodeEvents(t, string(data))
+	if len(events) != 3 || events[0].Type != EventSessionStart || events[1].Type != EventText || events[2].Type != EventResult {
+		t.Errorf("expected session_start, text, result events, got: %s", data)
+	}
+	if events[1].Text != "Listing files." {
+		t.Errorf("expected text event content, got: %q", events[1].Text)
+	}
+}
+
+func TestEventEmitter_Todos(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEventEmitter(&buf)
+
+	e.Observe(createTestAssistantMessage([]ContentBlock{
+		*createTestToolUseBlock("tool_1", "TodoWrite", map[string]interface{}{
+			"todos": []interface{}{
+				map[string]interface{}{"content": "Write tests", "status": "completed", "activeForm": "Writing tests"},
+				map[string]interface{}{"content": "Fix bug", "status": "in_progress"},
+				map[string]interface{}{"content": "Update docs", "status": "pending"},
+			},
+		}),
+	}))
+
+	events := decodeEvents(t, buf.String())
+	if len(events) != 2 || events[0].Type != EventToolCall {
+		t.Fatalf("expected a tool_call then a todos event, got: %s", buf.String())
+	}
+	todos := events[1]
+	if todos.Type != EventTodos || todos.ToolID != "tool_1" || todos.Completed != 1 || todos.Total != 3 {
+		t.Errorf("unexpected todos event: %+v", todos)
+	}
+	want := []TodoItem{{"Write tests", "completed"}, {"Fix bug", "in_progress"}, {"Update docs", "pending"}}
+	if len(todos.Todos) != len(want) {
+		t.Fatalf("expected %d todos, got %+v", len(want), todos.Todos)
+	}
+	for i, item := range want {
+		if todos.Todos[i] != item {
+			t.Errorf("todos[%d] = %+v, want %+v", i, todos.Todos[i], item)
+		}
+	}
+}
+
+// TestProcessMessage_JSONTodos tests JSON mode writes a TodoWrite's raw message alone: todos events
+// belong to --events-out and --format ndjson
+func TestProcessMessage_JSONTodos(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeJSON)
+	p.processMessage(createTestAssistantMessage([]ContentBlock{
+		*createTestToolUseBlock("tool_1", "TodoWrite", map[string]interface{}{
+			"todos": []interface{}{
+				map[string]interface{}{"content": "Write tests", "status": "completed"},
+				map[string]interface{}{"content": "Fix bug", "status": "pending"},
+			},
+		}),
+	}))
+
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if len(lines) != 1 || strings.Contains(w.String(), "ccv_event") {
+		t.Errorf("expected only the raw message, got: %s", w.String())
+	}
+}
+
+func TestEventEmitter_EditDiff(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEventEmitter(&buf)
+
+	e.Observe(createTestAssistantMessage([]ContentBlock{
+		*createTestToolUseBlock("tool_1", "Edit", map[string]interface{}{
+			"file_path":  "/tmp/main.go",
+			"old_string": "a := 1\n",
+			"new_string": "a := 2\nb := 3\n",
+		}),
+		*createTestToolUseBlock("tool_2", "MultiEdit", map[string]interface{}{
+			"file_path": "/tmp/types.go",
+			"edits": []interface{}{
+				map[string]interface{}{"old_string": "x", "new_string": "y"},
+				map[string]interface{}{"old_string": "p", "new_string": "q"},
+			},
+		}),
+	}))
+
+	events := decodeEvents(t, buf.String())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got: %s", buf.String())
+	}
+
+	edit := events[0]
+	want := []DiffLine{{DiffOpRemove, "a := 1"}, {DiffOpAdd, "a := 2"}, {DiffOpAdd, "b := 3"}}
+	if edit.FilePath != "/tmp/main.go" || edit.Added != 2 || edit.Removed != 1 {
+		t.Errorf("unexpected Edit summary: %+v", edit)
+	}
+	if len(edit.Diff) != len(want) {
+		t.Fatalf("expected %d diff lines, got %+v", len(want), edit.Diff)
+	}
+	for i, d := range want {
+		if edit.Diff[i] != d {
+			t.Errorf("diff[%d] = %+v, want %+v", i, edit.Diff[i], d)
+		}
+	}
+	if !strings.Contains(buf.String(), `{"op":"-","line":"a := 1"}`) {
+		t.Errorf("expected op/line diff entries in JSON, got: %s", buf.String())
+	}
+
+	multi := events[1]
+	if multi.FilePath != "/tmp/types.go" || len(multi.Diff) != 4 || multi.Added != 2 || multi.Removed != 2 {
+		t.Errorf("unexpected MultiEdit diff: %+v", multi)
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
 // syntaxPattern holds a compiled regex and its associated color
@@ -39,6 +43,7 @@ func initSyntaxPatterns() {
 type FormatConfig struct {
 	Colors     *ColorScheme
 	ShowLineNo bool
+	StartLine  int // Number of the first line, when the code is an excerpt (0 starts at 1)
 	Indent     string
 }
 
@@ -62,11 +67,12 @@ func FormatCodeBlock(code string, config *FormatConfig) string {
 	var result strings.Builder
 
 	// Calculate line number width for alignment
-	lineNoWidth := len(fmt.Sprintf("%d", len(lines)))
+	first := max(config.StartLine, 1)
+	lineNoWidth := len(strconv.Itoa(first + len(lines) - 1))
 
 	for i, line := range lines {
 		if config.ShowLineNo {
-			lineNo := i + 1
+			lineNo := first + i
 			// Dim line numbers
 			result.WriteString(fmt.Sprintf("%s%*d%s %s", c.LabelDim, lineNoWidth, lineNo, c.Reset, config.Indent))
 		} else {
@@ -102,6 +108,65 @@ func highlightSyntax(line string, c *ColorScheme) string {
 	return result
 }
 
+// NewHighlighter compiles the search terms into a single pattern matching any of them.
+// It returns nil when there are no terms.
+func NewHighlighter(terms []string, ignoreCase bool) *regexp.Regexp {
+	var quoted []string
+	for _, term := range terms {
+		if term != "" {
+			quoted = append(quoted, regexp.QuoteMeta(term))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+
+	// Prefer the longest match when terms overlap
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+
+	pattern := strings.Join(quoted, "|")
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// HighlightMatches wraps every match of re in the highlight color. The color in effect before
+// a match is restored after it, so a match inside colored text doesn't end that color.
+func HighlightMatches(text string, re *regexp.Regexp, c *ColorScheme) string {
+	if re == nil || c.Highlight == "" {
+		return text
+	}
+	matches := re.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m[0]])
+		b.WriteString(c.Highlight + text[m[0]:m[1]] + c.Reset + activeColor(text[:m[0]]))
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// activeColor returns the color sequences still in effect at the end of text: those written
+// since its last reset
+func activeColor(text string) string {
+	active := ""
+	for _, code := range ansiPattern.FindAllString(text, -1) {
+		if code == Reset || code == "\x1b[m" {
+			active = ""
+		} else {
+			active += code
+		}
+	}
+	return active
+}
+
 // FormatFilePath formats a file path with appropriate highlighting
 func FormatFilePath(path string, c *ColorScheme) string {
 	return c.FilePath + path + c.Reset
@@ -183,6 +248,83 @@ func IndentLines(s string, indent string) string {
 	return strings.Join(lines, "\n")
 }
 
+// truncateInput shortens s to n characters, ending in "..." when there is room for it.
+// n <= 0 leaves s whole. truncated reports whether anything was cut.
+func truncateInput(s string, n int) (short string, truncated bool) {
+	if n <= 0 || len(s) <= n {
+		return s, false
+	}
+	if n <= 3 {
+		return s[:n], true
+	}
+	return s[:n-3] + "...", true
+}
+
+// normalizeLineEndings converts CRLF line endings to LF and drops any other carriage
+// returns, which would move the cursor back to column 0 mid-line in a terminal
+func normalizeLineEndings(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "")
+}
+
+// sanitizeUTF8 replaces each run of invalid UTF-8 bytes with a visible �,
+// so mostly-text stderr with a few bad bytes renders consistently
+func sanitizeUTF8(s string) string {
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// formatCount formats an integer with thousands separators, e.g. 1,240
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// thinkingTagPattern matches wrapper tags that sometimes appear around thinking content
+var thinkingTagPattern = regexp.MustCompile(`</?(?:thinking|reasoning|scratchpad|reflection|inner_monologue)>`)
+
+// blankLinesPattern matches two or more consecutive blank lines
+var blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+
+// cleanThinkingText strips wrapper tags and trailing and repeated blank space from
+// thinking, for --clean-thinking. The reasoning itself is left untouched.
+func cleanThinkingText(s string) string {
+	s = thinkingTagPattern.ReplaceAllString(s, "")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	s = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(s)
+}
+
+// thinkingGist reduces thinking to its first sentence, for --thinking-gist. A trailing "…"
+// marks that there was more.
+func thinkingGist(s string) string {
+	s = cleanThinkingText(s)
+	line, rest, _ := strings.Cut(s, "\n")
+	line = strings.TrimSpace(line)
+	more := strings.TrimSpace(rest) != ""
+
+	for i := 0; i < len(line); i++ {
+		if strings.IndexByte(".!?", line[i]) >= 0 && i+1 < len(line) && line[i+1] == ' ' {
+			line, more = line[:i+1], true
+			break
+		}
+	}
+	if more {
+		line += "…"
+	}
+	return line
+}
+
 // FormatMCPToolName shortens MCP tool names from the format
 // mcp__plugin_foo_bar__baz to plugin:foo:bar:baz.
 // The mcp__ prefix is stripped, the double underscore separator
@@ -212,3 +354,47 @@ func FormatMCPToolName(name string) string {
 
 	return plugin + ":" + toolName
 }
+
+// normalizeToolName gives tool names a consistent display casing: bare names are
+// title-cased (navigate → Navigate) and MCP names are shortened as by FormatMCPToolName
+// and lowercased (mcp__Browser__Navigate → browser:navigate). It only affects display;
+// handlers still match on the original name.
+func normalizeToolName(name string) string {
+	if short := FormatMCPToolName(name); short != name {
+		return strings.ToLower(short)
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	if r == utf8.RuneError {
+		return name
+	}
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// ansiPattern matches the SGR color sequences ccv writes
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// visibleWidth returns how many columns text occupies, ignoring color sequences
+func visibleWidth(text string) int {
+	return utf8.RuneCountInString(ansiPattern.ReplaceAllString(text, ""))
+}
+
+// wrapWords breaks text at spaces into lines of at most width visible columns. Words
+// longer than width get a line of their own. It always returns at least one line.
+func wrapWords(text string, width int) []string {
+	var lines []string
+	line, lineWidth := "", 0
+	for _, word := range strings.Split(text, " ") {
+		w := visibleWidth(word)
+		if lineWidth > 0 && lineWidth+1+w > width {
+			lines = append(lines, line)
+			line, lineWidth = "", 0
+		}
+		if lineWidth > 0 {
+			line += " "
+			lineWidth++
+		}
+		line += word
+		lineWidth += w
+	}
+	return append(lines, line)
+}
@@ -478,6 +478,29 @@ func TestFormatMCPToolName(t *testing.T) {
 	}
 }
 
+func TestNormalizeToolName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"navigate", "Navigate"},
+		{"Navigate", "Navigate"},
+		{"Bash", "Bash"},
+		{"mcp__browser__navigate", "browser:navigate"},
+		{"mcp__Browser__Navigate", "browser:navigate"},
+		{"mcp__plugin_Foo__Bar_Baz", "plugin:foo:bar_baz"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := normalizeToolName(tt.input); got != tt.expected {
+				t.Errorf("normalizeToolName(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestHighlightSyntax_AdditionalCases(t *testing.T) {
 	scheme := DefaultScheme()
 
@@ -813,3 +836,109 @@ func FuzzIndentLines(f *testing.F) {
 		}
 	})
 }
+
+func TestHighlightMatches(t *testing.T) {
+	c := DefaultScheme()
+
+	if re := NewHighlighter(nil, false); re != nil {
+		t.Errorf("expected nil highlighter without terms, got %v", re)
+	}
+
+	// Terms are literal and the longest match wins
+	re := NewHighlighter([]string{"a.b", "a.b.c"}, false)
+	got := HighlightMatches("x a.b.c axb", re, c)
+	want := "x " + c.Highlight + "a.b.c" + c.Reset + " axb"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Case-sensitive by default
+	re = NewHighlighter([]string{"err"}, false)
+	if got := HighlightMatches("ERR", re, c); got != "ERR" {
+		t.Errorf("expected no case-insensitive match, got %q", got)
+	}
+	re = NewHighlighter([]string{"err"}, true)
+	if got := HighlightMatches("ERR", re, c); got != c.Highlight+"ERR"+c.Reset {
+		t.Errorf("expected case-insensitive match, got %q", got)
+	}
+
+	// No-color schemes leave text untouched
+	if got := HighlightMatches("err", re, NoColorScheme()); got != "err" {
+		t.Errorf("expected unchanged text without colors, got %q", got)
+	}
+
+	// A match inside colored text goes back to that color, and after a reset to none
+	re = NewHighlighter([]string{"err"}, false)
+	got = HighlightMatches(c.Error+"an err here"+c.Reset+" err", re, c)
+	want = c.Error + "an " + c.Highlight + "err" + c.Reset + c.Error + " here" + c.Reset + " " + c.Highlight + "err" + c.Reset
+	if got != want {
+		t.Errorf("expected the surrounding color restored\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	tests := map[string]string{
+		"a\r\nb\r\n":  "a\nb\n",
+		"a\nb":        "a\nb",
+		"50%\r100%\n": "50%100%\n",
+	}
+	for in, want := range tests {
+		if got := normalizeLineEndings(in); got != want {
+			t.Errorf("normalizeLineEndings(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTruncateInput(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+		cut  bool
+	}{
+		{0, "abcdefghij", false},
+		{20, "abcdefghij", false},
+		{10, "abcdefghij", false},
+		{8, "abcde...", true},
+		{4, "a...", true},
+		{2, "ab", true},
+	}
+	for _, tt := range tests {
+		got, cut := truncateInput("abcdefghij", tt.n)
+		if got != tt.want || cut != tt.cut {
+			t.Errorf("truncateInput(%d) = %q, %v, want %q, %v", tt.n, got, cut, tt.want, tt.cut)
+		}
+	}
+}
+
+func TestThinkingGist(t *testing.T) {
+	tests := map[string]string{
+		"Check the config. Then run it.":      "Check the config.…",
+		"Is it cached? Probably not.":         "Is it cached?…",
+		"Version 1.2 is out. Upgrade.":        "Version 1.2 is out.…",
+		"Plan:\n1. Read\n2. Fix":               "Plan:…",
+		"  One sentence only.  ":              "One sentence only.",
+		"<thinking>Wrapped idea.</thinking>": "Wrapped idea.",
+	}
+	for in, want := range tests {
+		if got := thinkingGist(in); got != want {
+			t.Errorf("thinkingGist(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSanitizeUTF8(t *testing.T) {
+	if got := sanitizeUTF8("match: caf\xe9 \xff\xfe end"); got != "match: caf� � end" {
+		t.Errorf("sanitizeUTF8() = %q", got)
+	}
+	if got := sanitizeUTF8("héllo"); got != "héllo" {
+		t.Errorf("expected valid UTF-8 unchanged, got: %q", got)
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1240: "1,240", 1234567: "1,234,567", -4500: "-4,500"} {
+		if got := formatCount(n); got != want {
+			t.Errorf("formatCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -804,3 +806,53 @@ func TestIntegration_NilHandlers(t *testing.T) {
 		t.Fatal("Processing did not complete within timeout")
 	}
 }
+
+// TestIntegration_ScriptedSession drives run() end-to-end with a scripted runner
+func TestIntegration_ScriptedSession(t *testing.T) {
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-scripted", "claude-sonnet-4-5"),
+		createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Listing files."}, nil),
+		createTestAssistantMessage([]ContentBlock{
+			{Type: ContentBlockTypeText, Text: "Listing files."},
+		}),
+		&StreamEvent{
+			Type:         StreamEventContentBlockStart,
+			ContentBlock: createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls -la"}),
+		},
+		createTestAssistantMessage([]ContentBlock{
+			*createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls -la"}),
+		}),
+		fmt.Errorf("line 7: failed to parse message: unexpected EOF"),
+		createTestResult(0.0123, 2500, 2),
+	}, time.Millisecond)
+
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	code := run([]string{"--no-color", "List the files"}, &out)
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	if len(*gotArgs) != 1 || (*gotArgs)[0] != "List the files" {
+		t.Errorf("expected prompt passed to runner, got: %v", *gotArgs)
+	}
+
+	want := "[Session started: claude-sonnet-4-5]\n" +
+		"\n" +
+		"Listing files.\n" +
+		"\n" +
+		"→ Bash: ls -la\n" +
+		"\n" +
+		"───────────────────────────────────────\n" +
+		"Tokens: 1500 total (1000 in, 500 out)\n" +
+		"Cost: $0.0123\n" +
+		"Duration: 2.5s\n" +
+		"Turns: 2\n" +
+		"Bash: 1\n"
+	if out.String() != want {
+		t.Errorf("rendered transcript mismatch\ngot:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
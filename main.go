@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/template"
+	"time"
 )
 
 var (
@@ -18,61 +22,423 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, "A headless CLI wrapper for Claude Code that outputs structured text.\n\n")
 	fmt.Fprintf(os.Stderr, "Usage:\n")
 	fmt.Fprintf(os.Stderr, "  ccv [options] [prompt]\n")
-	fmt.Fprintf(os.Stderr, "  ccv [options] [claude args...]\n\n")
+	fmt.Fprintf(os.Stderr, "  ccv [options] [claude args...]\n")
+	fmt.Fprintf(os.Stderr, "  ccv [options] -- [claude args...]  (args after -- are never read as ccv flags)\n\n")
 	fmt.Fprintf(os.Stderr, "Output Flags:\n")
 	fmt.Fprintf(os.Stderr, "  --verbose        Show verbose output including full tool inputs\n")
+	fmt.Fprintf(os.Stderr, "  --verbose-no-raw Like --verbose, without raw JSON dumps of tool inputs\n")
 	fmt.Fprintf(os.Stderr, "  --quiet          Show only assistant text responses\n")
-	fmt.Fprintf(os.Stderr, "  --format <fmt>   Output format: text (default), json\n")
+	fmt.Fprintf(os.Stderr, "  --answer-only    Print only the final turn's answer text when the session ends, like claude -p\n")
+	fmt.Fprintf(os.Stderr, "  --seq            Tag each message's output with its input sequence number (#42)\n")
+	fmt.Fprintf(os.Stderr, "  --denials-out <file>  Append each tool the permission settings denied to file as JSONL\n")
+	fmt.Fprintf(os.Stderr, "  --log-prompts <file>  Append each prompt and its session ID to file as JSONL\n")
+	fmt.Fprintf(os.Stderr, "  --compare <a.jsonl> <b.jsonl>  Diff the text and tool calls of two saved sessions\n")
+	fmt.Fprintf(os.Stderr, "  --color-test     Preview the colors: a swatch of each, then a sample session\n")
+	fmt.Fprintf(os.Stderr, "  --replay <file>  Render captured stream-json output instead of running claude\n")
+	fmt.Fprintf(os.Stderr, "  --clipboard      Use the clipboard as the prompt, after the prompt given if any\n")
+	fmt.Fprintf(os.Stderr, "  --merge-text     Run a turn's consecutive text blocks together without blank lines between them\n")
+	fmt.Fprintf(os.Stderr, "  --group-by-turn  Print each turn's text first, then its tool calls indented under it (text doesn't stream)\n")
+	fmt.Fprintf(os.Stderr, "  --collapse-reads  Batch consecutive Read calls into one line listing the files\n")
+	fmt.Fprintf(os.Stderr, "  --dim-results    Show tool output dim so the tool calls stand out\n")
+	fmt.Fprintf(os.Stderr, "  --files-summary  List the files read, written or edited at the end (on with --verbose)\n")
+	fmt.Fprintf(os.Stderr, "  --normalize-tool-names  Title-case bare tool names and lowercase MCP names (navigate → Navigate)\n")
+	fmt.Fprintf(os.Stderr, "  --resume <id>    Resume the claude session with this ID\n")
+	fmt.Fprintf(os.Stderr, "  --continue       Resume claude's most recent session\n")
+	fmt.Fprintf(os.Stderr, "  --reconnect      Resume the most recent session of --project (default: current directory)\n")
+	fmt.Fprintf(os.Stderr, "  --project <name>  Project for --reconnect: a path, or its directory name under ~/.claude/projects\n")
+	fmt.Fprintf(os.Stderr, "  --validate-resume  Check the transcript of the --resume session (in --project) or --continue one and show its model and first prompt first\n")
+	fmt.Fprintf(os.Stderr, "  --show-uuids     Tag each message's output with its uuid, truncated to 8 characters\n")
+	fmt.Fprintf(os.Stderr, "  --full-uuids     Like --show-uuids, with the full uuid\n")
+	fmt.Fprintf(os.Stderr, "  --timestamps[=relative]  Start each block of output with [HH:MM:SS], or [+1.2s] from the session start\n")
+	fmt.Fprintf(os.Stderr, "  --format <fmt>   Output format: text (default), json, plain, ndjson (normalized events), script (commands and file changes)\n")
 	fmt.Fprintf(os.Stderr, "  --no-color       Disable colored output\n")
+	fmt.Fprintf(os.Stderr, "  --pipe           Redirect-friendly output: no color, text written in whole blocks (default when stdout isn't a terminal)\n")
+	fmt.Fprintf(os.Stderr, "  --no-pipe        Keep color and streaming when stdout is redirected\n")
+	fmt.Fprintf(os.Stderr, "  --indent <n>     Spaces per indentation level for tool results and subagents (default 2)\n")
+	fmt.Fprintf(os.Stderr, "  --diff=word      Show Edit diffs with the changed words highlighted inline (default line)\n")
+	fmt.Fprintf(os.Stderr, "  --diff=unified   Show Edit and MultiEdit diffs as a unified diff patch, one per file\n")
+	fmt.Fprintf(os.Stderr, "  --diff-context <n>  Context lines around unified diff hunks (default 3)\n")
+	fmt.Fprintf(os.Stderr, "  --truncate <n>   Characters of long prompts, queries and typed text to show (default 120, 0 for never)\n")
+	fmt.Fprintf(os.Stderr, "  --safe-width     Fit the final summary to the terminal width (stdout, else COLUMNS, default 80) with aligned columns\n")
+	fmt.Fprintf(os.Stderr, "  --width <n>      Like --safe-width, for a terminal n columns wide\n")
+	fmt.Fprintf(os.Stderr, "  --head <n>       Stop claude after the first n assistant turns and tool calls, then print the summary\n")
+	fmt.Fprintf(os.Stderr, "  --interrupt-after <dur>  Stop claude once the run has lasted this long, e.g. 90s, then print the summary\n")
+	fmt.Fprintf(os.Stderr, "  --max-cost <usd>  Stop claude and exit 1 once the run has cost more than this, e.g. 0.50\n")
+	fmt.Fprintf(os.Stderr, "  --max-tokens <n>  Stop claude and exit 1 once the run has used more than n tokens\n")
+	fmt.Fprintf(os.Stderr, "  --summary-template <tmpl>  Go text/template for the final summary, e.g. '{{.TotalTokens}} tokens, ${{printf \"%%.4f\" .Cost}}'\n")
+	fmt.Fprintf(os.Stderr, "  --events-out <path>  Also write normalized NDJSON events to path, whatever the --format\n")
+	fmt.Fprintf(os.Stderr, "  --merge-stderr   Show claude's stderr inline as dim [stderr] lines\n")
+	fmt.Fprintf(os.Stderr, "  --quiet-errors   Drop known-benign stderr noise (error-looking lines always show)\n")
+	fmt.Fprintf(os.Stderr, "  --filter-stderr <regex>  Drop stderr lines matching regex (error-looking lines always show)\n")
+	fmt.Fprintf(os.Stderr, "  --no-banner-newline  Omit the blank line after the session banner\n")
+	fmt.Fprintf(os.Stderr, "  --fold-tool-results  Show a one-line summary per tool result (full output with --verbose)\n")
+	fmt.Fprintf(os.Stderr, "  --no-result-on-empty  Hide successful tool results that have no output\n")
+	fmt.Fprintf(os.Stderr, "  --todo-progress  Show a completion bar after each TodoWrite list, e.g. [███░░] 3/5 done\n")
+	fmt.Fprintf(os.Stderr, "  --per-turn-tokens  Print each turn's token usage, e.g. [+1,240 in, 380 out]\n")
+	fmt.Fprintf(os.Stderr, "  --per-message-cost Print each assistant message's cost and duration (on with --verbose)\n")
+	fmt.Fprintf(os.Stderr, "  --slow-tool-threshold <dur>  Mark results of tools that ran longer than this, e.g. 45s (default 30s, 0 disables)\n")
+	fmt.Fprintf(os.Stderr, "  --context-window-warning <fraction>  Warn once when context use crosses this fraction (default 0.9, 0 disables)\n")
+	fmt.Fprintf(os.Stderr, "  --show-hooks         Show dim [hook: PreToolUse → blocked] lines when user hooks run\n")
+	fmt.Fprintf(os.Stderr, "  --keep-partial-on-error  Keep a partially streamed message after a parse error instead of resetting\n")
+	fmt.Fprintf(os.Stderr, "  --clean-thinking  Strip wrapper tags and extra blank lines from thinking\n")
+	fmt.Fprintf(os.Stderr, "  --thinking-out <path>  Write thinking to path instead of inline, keeping stdout to text and tools\n")
+	fmt.Fprintf(os.Stderr, "  --thinking-last      Show each turn's thinking after its text, under a [reasoning] footer\n")
+	fmt.Fprintf(os.Stderr, "  --thinking-gist      Show each thinking block as its first sentence (in full with --verbose)\n")
+	fmt.Fprintf(os.Stderr, "  --confirm-tools <list>  Flag calls to these tools (e.g. Bash,Write) with a prominent warning; advisory only\n")
+	fmt.Fprintf(os.Stderr, "  --only-tools <list>  Show only these tools' calls and results (e.g. Bash,Edit,Write)\n")
+	fmt.Fprintf(os.Stderr, "  --hide-tools <list>  Hide these tools' calls and results (e.g. Read,Glob,Grep); wins over --only-tools\n")
+	fmt.Fprintf(os.Stderr, "  --copyable           Also print Bash commands ($ cmd) and file paths on bare, uncolored lines\n")
+	fmt.Fprintf(os.Stderr, "  --only-agent <type>  Show only one agent's activity, e.g. Plan or main\n")
+	fmt.Fprintf(os.Stderr, "  --hide-root-agent     Never show [main: ...] context lines, even with subagents\n")
+	fmt.Fprintf(os.Stderr, "  --highlight <term>   Highlight term in assistant text and tool output (repeatable)\n")
+	fmt.Fprintf(os.Stderr, "  --highlight-i        Match --highlight terms case-insensitively\n")
 	fmt.Fprintf(os.Stderr, "\nGeneral Flags:\n")
+	fmt.Fprintf(os.Stderr, "  --claude-cmd <cmd>  Run claude through a wrapper command, e.g. \"npx claude-code\" (quotes are respected)\n")
+	fmt.Fprintf(os.Stderr, "  --claude-bin <path>  Run this claude binary instead of claude from PATH\n")
+	fmt.Fprintf(os.Stderr, "  --watch <glob>   After each run, wait for a matching file to change and run again (Ctrl-C stops)\n")
+	fmt.Fprintf(os.Stderr, "  --watch-clear    Clear the screen before each --watch re-run\n")
+	fmt.Fprintf(os.Stderr, "  --strict-args    Error on missing or flag-like flag values and --project without --reconnect or --validate-resume\n")
 	fmt.Fprintf(os.Stderr, "  --help           Show help information\n")
 	fmt.Fprintf(os.Stderr, "  --version        Show version information\n")
 	fmt.Fprintf(os.Stderr, "\nEnvironment Variables:\n")
 	fmt.Fprintf(os.Stderr, "  CCV_VERBOSE=1    Equivalent to --verbose\n")
 	fmt.Fprintf(os.Stderr, "  CCV_QUIET=1      Equivalent to --quiet\n")
 	fmt.Fprintf(os.Stderr, "  CCV_FORMAT=json  Equivalent to --format json\n")
+	fmt.Fprintf(os.Stderr, "  CCV_TRUNCATE=n   Equivalent to --truncate n\n")
 	fmt.Fprintf(os.Stderr, "  NO_COLOR=1       Disable colored output (standard)\n")
 	fmt.Fprintf(os.Stderr, "\nExamples:\n")
 	fmt.Fprintf(os.Stderr, "  ccv \"Explain this codebase\"\n")
 	fmt.Fprintf(os.Stderr, "  ccv --verbose \"Debug this issue\"\n")
 	fmt.Fprintf(os.Stderr, "  ccv --format json \"List all files\"\n")
 	fmt.Fprintf(os.Stderr, "  ccv -p \"Fix the bug\" --allowedTools Bash,Read\n")
+	fmt.Fprintf(os.Stderr, "  ccv --quiet -- --verbose \"Explain this\"  (--verbose goes to claude)\n")
+}
+
+// valueFlags are the ccv flags that read their value from the following argument(s),
+// mapped to how many values they take
+var valueFlags = map[string]int{
+	"filter-stderr":          1,
+	"highlight":              1,
+	"only-agent":             1,
+	"summary-template":       1,
+	"confirm-tools":          1,
+	"only-tools":             1,
+	"hide-tools":             1,
+	"context-window-warning": 1,
+	"indent":                 1,
+	"truncate":               1,
+	"slow-tool-threshold":    1,
+	"width":                  1,
+	"head":                   1,
+	"diff":                   1,
+	"diff-context":           1,
+	"interrupt-after":        1,
+	"max-cost":               1,
+	"max-tokens":             1,
+	"watch":                  1,
+	"events-out":             1,
+	"replay":                 1,
+	"compare":                2,
+	"log-prompts":            1,
+	"project":                1,
+	"resume":                 1,
+	"thinking-out":           1,
+	"denials-out":            1,
+	"claude-cmd":             1,
+	"claude-bin":             1,
+	"format":                 1,
+}
+
+// checkStrictArgs rejects the arguments the flag loop would otherwise guess at (--strict-args):
+// a value flag with nothing after it, which is ignored; a value flag followed by another
+// flag, which is taken as the value; and --project without --reconnect or --validate-resume,
+// which is ignored.
+func checkStrictArgs(args []string) error {
+	usesProject, project := false, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if before, _, ok := strings.Cut(name, "="); ok {
+			project = project || before == "project"
+			continue
+		}
+		switch name {
+		case "reconnect", "validate-resume":
+			usesProject = true
+		case "project":
+			project = true
+		}
+
+		n, ok := valueFlags[name]
+		if !ok {
+			continue
+		}
+		for j := 1; j <= n; j++ {
+			if i+j >= len(args) {
+				return fmt.Errorf("--%s needs a value", name)
+			}
+			if strings.HasPrefix(args[i+j], "-") {
+				if n == 1 {
+					return fmt.Errorf("--%s needs a value, got flag %q (use --%s=%s for a value starting with -)", name, args[i+j], name, args[i+j])
+				}
+				return fmt.Errorf("--%s needs %d values, got flag %q", name, n, args[i+j])
+			}
+		}
+		i += n
+	}
+
+	if project && !usesProject {
+		return fmt.Errorf("--project is only used with --reconnect or --validate-resume")
+	}
+	return nil
+}
+
+// reconnectSession finds the latest session of a project, defaulting to the current directory
+func reconnectSession(project string) (string, error) {
+	if project == "" {
+		project = "."
+	}
+	projectsDir, err := claudeProjectsDir()
+	if err != nil {
+		return "", err
+	}
+	dir, err := projectDir(projectsDir, project)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("no sessions found for project %s (looked in %s)", project, dir)
+	}
+	return latestSession(dir)
+}
+
+// parseToolList parses a comma-separated list of tool names, e.g. "Bash,Write"
+func parseToolList(list string) map[string]bool {
+	tools := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			tools[name] = true
+		}
+	}
+	return tools
+}
+
+// redirected reports whether w is a file or pipe rather than a terminal. Writers that
+// aren't files, such as buffers in tests, count as terminals.
+func redirected(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// newRunner creates the runner for a session. Tests replace it with a scripted runner
+// so the full pipeline can be exercised without the claude binary.
+var newRunner = func(ctx context.Context, command, args []string) (Runner, error) {
+	return NewClaudeRunnerWithCommand(ctx, command, args)
 }
 
 func main() {
 	// Initialize colors based on terminal capability
 	initColors()
 
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+// run parses ccv's flags, drives a session, and returns the process exit code
+func run(args []string, stdout io.Writer) int {
+	// --watch re-runs the rest of the command whenever a matching file changes
+	if pattern, clearBetween, rest, ok := watchArgs(args); ok {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return runWatch(ctx, pattern, clearBetween, rest, stdout)
+	}
+
 	// Manually parse only ccv's own flags to allow passthrough of all other args to claude
 	// This avoids Go's flag package rejecting unknown flags like --model
-	args := os.Args[1:]
 
 	// Read configuration from environment variables (can be overridden by flags)
 	verbose := os.Getenv("CCV_VERBOSE") == "1"
 	quiet := os.Getenv("CCV_QUIET") == "1"
 	noColor := false
+	pipe := false
+	groupByTurn := false
+	noPipe := false
+	mergeStderr := false
+	noBannerNewline := false
+	foldResults := false
+	copyable := false
+	hideRootAgent := false
+	eventsOut := ""
+	replay := ""
+	thinkingOut := ""
+	denialsOut := ""
+	claudeCmd := ""
+	claudeBin := ""
+	keepPartialOnError := false
+	showUUIDs := false
+	timestamps := ""
+	diffMode := diffModeLine
+	diffContext := defaultDiffContext
+	clipboard := false
+	colorTest := false
+	fullUUIDs := false
+	reconnect := false
+	resumeID := ""
+	continueSession := false
+	checkResume := false
+	collapseReads := false
+	normalizeToolNames := false
+	dimResults := false
+	filesSummary := false
+	noEmptyResults := false
+	logPrompts := ""
+	perTurnTokens := false
+	perMessageCost := false
+	todoProgress := false
+	answerOnly := false
+	mergeText := false
+	cleanThinking := false
+	thinkingGist := false
+	project := ""
+	var compareFiles []string
+	thinkingLast := false
+	onlyAgent := ""
+	seqTags := false
+	quietErrors := false
+	summaryTemplate := ""
+	noRawInput := false
+	var confirmTools map[string]bool
+	var onlyTools, hideTools map[string]bool
+	showHooks := false
+	contextWarnAt := 0.9
+	indentWidth := defaultIndentWidth
+	slowToolThreshold := defaultSlowToolThreshold
+	summaryWidth := 0
+	head := 0
+	var interruptAfter time.Duration
+	maxCost := 0.0
+	maxTokens := 0
+	filterStderr := ""
+	var highlightTerms []string
+	highlightIgnoreCase := false
+	truncateAt := defaultTruncateAt
+	if value := os.Getenv("CCV_TRUNCATE"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			fmt.Fprintf(os.Stderr, "Error: CCV_TRUNCATE must be a number of characters (0 for never), got %q\n", value)
+			return 1
+		}
+		truncateAt = n
+	}
 	format := strings.ToLower(os.Getenv("CCV_FORMAT"))
 	if format == "" {
 		format = "text"
 	}
 
+	// --strict-args changes how every other flag is read, so look for it first
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--strict-args" || arg == "-strict-args" {
+			if err := checkStrictArgs(args); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			break
+		}
+	}
+
 	// Parse and filter ccv-specific flags, pass remaining args to claude
 	var claudeArgs []string
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 
+		// Everything after a literal "--" goes to claude verbatim
+		if arg == "--" {
+			claudeArgs = append(claudeArgs, args[i+1:]...)
+			break
+		}
+
 		if arg == "-version" || arg == "--version" {
-			fmt.Printf("ccv version %s\n", version)
-			os.Exit(0)
+			fmt.Fprintf(stdout, "ccv version %s\n", version)
+			return 0
+		}
+		if arg == "--benchmark" {
+			// Hidden: measure rendering throughput on a synthetic session
+			runBenchmark(stdout, 2000)
+			return 0
 		}
 		if arg == "-help" || arg == "--help" {
 			printUsage()
-			os.Exit(0)
+			return 0
 		}
 		if arg == "--verbose" || arg == "-verbose" {
 			verbose = true
 			continue
 		}
+		if arg == "--strict-args" || arg == "-strict-args" {
+			// Already checked before parsing
+			continue
+		}
+		if arg == "--verbose-no-raw" || arg == "-verbose-no-raw" {
+			// Verbose output without the raw input JSON dump
+			verbose = true
+			noRawInput = true
+			continue
+		}
+		if arg == "--seq" || arg == "-seq" {
+			seqTags = true
+			continue
+		}
+		if arg == "--diff" || arg == "-diff" || strings.HasPrefix(arg, "--diff=") {
+			// Value is how Edit diffs render: line or word
+			value := strings.TrimPrefix(arg, "--diff=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			if value != diffModeLine && value != diffModeWord && value != diffModeUnified {
+				fmt.Fprintf(os.Stderr, "Error: --diff must be line, word or unified, got %q\n", value)
+				return 1
+			}
+			diffMode = value
+			continue
+		}
+		if arg == "--timestamps" || arg == "-timestamps" {
+			timestamps = timestampsClock
+			continue
+		}
+		if strings.HasPrefix(arg, "--timestamps=") {
+			// Value picks the style; it is only taken with = so a prompt is never mistaken for it
+			timestamps = strings.TrimPrefix(arg, "--timestamps=")
+			if timestamps != timestampsClock && timestamps != timestampsRelative {
+				fmt.Fprintf(os.Stderr, "Error: --timestamps must be clock or relative, got %q\n", timestamps)
+				return 1
+			}
+			continue
+		}
+		if arg == "--clipboard" || arg == "-clipboard" {
+			clipboard = true
+			continue
+		}
+		if arg == "--color-test" || arg == "-color-test" {
+			colorTest = true
+			continue
+		}
 		if arg == "--quiet" || arg == "-quiet" {
 			quiet = true
 			continue
@@ -81,6 +447,521 @@ func main() {
 			noColor = true
 			continue
 		}
+		if arg == "--group-by-turn" || arg == "-group-by-turn" {
+			groupByTurn = true
+			continue
+		}
+		if arg == "--watch-clear" || arg == "-watch-clear" {
+			// Only meaningful with --watch, which takes it out before this loop
+			continue
+		}
+		if arg == "--pipe" || arg == "-pipe" {
+			pipe = true
+			continue
+		}
+		if arg == "--no-pipe" || arg == "-no-pipe" {
+			noPipe = true
+			continue
+		}
+		if arg == "--merge-stderr" || arg == "-merge-stderr" {
+			mergeStderr = true
+			continue
+		}
+		if arg == "--quiet-errors" || arg == "-quiet-errors" {
+			quietErrors = true
+			continue
+		}
+		if arg == "--filter-stderr" || arg == "-filter-stderr" {
+			// Next arg is the regex of stderr lines to drop
+			if i+1 < len(args) {
+				i++
+				filterStderr = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--filter-stderr=") {
+			filterStderr = strings.TrimPrefix(arg, "--filter-stderr=")
+			continue
+		}
+		if arg == "--no-banner-newline" || arg == "-no-banner-newline" {
+			noBannerNewline = true
+			continue
+		}
+		if arg == "--fold-tool-results" || arg == "-fold-tool-results" {
+			foldResults = true
+			continue
+		}
+		if arg == "--show-hooks" || arg == "-show-hooks" {
+			showHooks = true
+			continue
+		}
+		if arg == "--thinking-last" || arg == "-thinking-last" {
+			thinkingLast = true
+			continue
+		}
+		if arg == "--copyable" || arg == "-copyable" {
+			copyable = true
+			continue
+		}
+		if arg == "--hide-root-agent" || arg == "-hide-root-agent" {
+			hideRootAgent = true
+			continue
+		}
+		if arg == "--highlight-i" || arg == "-highlight-i" {
+			highlightIgnoreCase = true
+			continue
+		}
+		if arg == "--highlight" || arg == "-highlight" {
+			// Next arg is the term to highlight
+			if i+1 < len(args) {
+				i++
+				highlightTerms = append(highlightTerms, args[i])
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--highlight=") {
+			highlightTerms = append(highlightTerms, strings.TrimPrefix(arg, "--highlight="))
+			continue
+		}
+		if arg == "--only-agent" || arg == "-only-agent" {
+			// Next arg is the agent type to show
+			if i+1 < len(args) {
+				i++
+				onlyAgent = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--only-agent=") {
+			onlyAgent = strings.TrimPrefix(arg, "--only-agent=")
+			continue
+		}
+		if arg == "--summary-template" || arg == "-summary-template" {
+			// Next arg is the template text
+			if i+1 < len(args) {
+				i++
+				summaryTemplate = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--summary-template=") {
+			summaryTemplate = strings.TrimPrefix(arg, "--summary-template=")
+			continue
+		}
+		if arg == "--confirm-tools" || arg == "-confirm-tools" {
+			// Next arg is a comma-separated tool list
+			if i+1 < len(args) {
+				i++
+				confirmTools = parseToolList(args[i])
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--confirm-tools=") {
+			confirmTools = parseToolList(strings.TrimPrefix(arg, "--confirm-tools="))
+			continue
+		}
+		if arg == "--only-tools" || arg == "-only-tools" {
+			// Next arg is a comma-separated tool list
+			if i+1 < len(args) {
+				i++
+				onlyTools = parseToolList(args[i])
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--only-tools=") {
+			onlyTools = parseToolList(strings.TrimPrefix(arg, "--only-tools="))
+			continue
+		}
+		if arg == "--hide-tools" || arg == "-hide-tools" {
+			// Next arg is a comma-separated tool list
+			if i+1 < len(args) {
+				i++
+				hideTools = parseToolList(args[i])
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--hide-tools=") {
+			hideTools = parseToolList(strings.TrimPrefix(arg, "--hide-tools="))
+			continue
+		}
+		if arg == "--context-window-warning" || arg == "-context-window-warning" || strings.HasPrefix(arg, "--context-window-warning=") {
+			// Value is the fraction of the context window that triggers the warning
+			value := strings.TrimPrefix(arg, "--context-window-warning=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			fraction, err := strconv.ParseFloat(value, 64)
+			if err != nil || fraction < 0 || fraction > 1 {
+				fmt.Fprintf(os.Stderr, "Error: --context-window-warning must be a fraction between 0 and 1, got %q\n", value)
+				return 1
+			}
+			contextWarnAt = fraction
+			continue
+		}
+		if arg == "--indent" || arg == "-indent" || strings.HasPrefix(arg, "--indent=") {
+			// Value is the number of spaces per indentation level
+			value := strings.TrimPrefix(arg, "--indent=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			width, err := strconv.Atoi(value)
+			if err != nil || width < 1 {
+				fmt.Fprintf(os.Stderr, "Error: --indent must be a positive number of spaces, got %q\n", value)
+				return 1
+			}
+			indentWidth = width
+			continue
+		}
+		if arg == "--diff-context" || arg == "-diff-context" || strings.HasPrefix(arg, "--diff-context=") {
+			// Value is how many context lines surround a unified diff hunk
+			value := strings.TrimPrefix(arg, "--diff-context=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				fmt.Fprintf(os.Stderr, "Error: --diff-context must be a number of lines, got %q\n", value)
+				return 1
+			}
+			diffContext = n
+			continue
+		}
+		if arg == "--truncate" || arg == "-truncate" || strings.HasPrefix(arg, "--truncate=") {
+			// Value is how many characters of a long tool input to show
+			value := strings.TrimPrefix(arg, "--truncate=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				fmt.Fprintf(os.Stderr, "Error: --truncate must be a number of characters (0 for never), got %q\n", value)
+				return 1
+			}
+			truncateAt = n
+			continue
+		}
+		if arg == "--safe-width" || arg == "-safe-width" {
+			// Lay the summary out for the terminal, unless --width already set one
+			if summaryWidth == 0 {
+				summaryWidth = terminalWidth()
+			}
+			continue
+		}
+		if arg == "--width" || arg == "-width" || strings.HasPrefix(arg, "--width=") {
+			// Value is the terminal width in columns
+			value := strings.TrimPrefix(arg, "--width=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			width, err := strconv.Atoi(value)
+			if err != nil || width < 1 {
+				fmt.Fprintf(os.Stderr, "Error: --width must be a positive number of columns, got %q\n", value)
+				return 1
+			}
+			summaryWidth = width
+			continue
+		}
+		if arg == "--head" || arg == "-head" || strings.HasPrefix(arg, "--head=") {
+			// Value is how many turns and tool calls to render before stopping
+			value := strings.TrimPrefix(arg, "--head=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: --head must be a positive number of events, got %q\n", value)
+				return 1
+			}
+			head = n
+			continue
+		}
+		if arg == "--max-cost" || arg == "-max-cost" || strings.HasPrefix(arg, "--max-cost=") {
+			// Value is a dollar amount such as 0.50 or $2
+			value := strings.TrimPrefix(arg, "--max-cost=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			usd, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+			if err != nil || usd <= 0 {
+				fmt.Fprintf(os.Stderr, "Error: --max-cost must be a positive dollar amount such as 0.50, got %q\n", value)
+				return 1
+			}
+			maxCost = usd
+			continue
+		}
+		if arg == "--max-tokens" || arg == "-max-tokens" || strings.HasPrefix(arg, "--max-tokens=") {
+			// Value is the session's token budget, input and output combined
+			value := strings.TrimPrefix(arg, "--max-tokens=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "Error: --max-tokens must be a positive number of tokens, got %q\n", value)
+				return 1
+			}
+			maxTokens = n
+			continue
+		}
+		if arg == "--interrupt-after" || arg == "-interrupt-after" || strings.HasPrefix(arg, "--interrupt-after=") {
+			// Value is a wall-clock duration such as 90s or 5m
+			value := strings.TrimPrefix(arg, "--interrupt-after=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				fmt.Fprintf(os.Stderr, "Error: --interrupt-after must be a positive duration such as 90s or 5m, got %q\n", value)
+				return 1
+			}
+			interruptAfter = d
+			continue
+		}
+		if arg == "--slow-tool-threshold" || arg == "-slow-tool-threshold" || strings.HasPrefix(arg, "--slow-tool-threshold=") {
+			// Value is a duration such as 30s or 2m
+			value := strings.TrimPrefix(arg, "--slow-tool-threshold=")
+			if value == arg {
+				if i+1 >= len(args) {
+					continue
+				}
+				i++
+				value = args[i]
+			}
+			threshold, err := time.ParseDuration(value)
+			if err != nil || threshold < 0 {
+				fmt.Fprintf(os.Stderr, "Error: --slow-tool-threshold must be a duration such as 30s or 2m, got %q\n", value)
+				return 1
+			}
+			slowToolThreshold = threshold
+			continue
+		}
+		if arg == "--events-out" || arg == "-events-out" {
+			// Next arg is the events file path
+			if i+1 < len(args) {
+				i++
+				eventsOut = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--events-out=") {
+			eventsOut = strings.TrimPrefix(arg, "--events-out=")
+			continue
+		}
+		if arg == "--replay" || arg == "-replay" {
+			// Next arg is the captured stream-json file
+			if i+1 < len(args) {
+				i++
+				replay = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--replay=") {
+			replay = strings.TrimPrefix(arg, "--replay=")
+			continue
+		}
+		if arg == "--compare" || arg == "-compare" {
+			// Next two args are the sessions to compare
+			if i+2 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --compare needs two session files")
+				return 1
+			}
+			compareFiles = args[i+1 : i+3]
+			i += 2
+			continue
+		}
+		if arg == "--clean-thinking" || arg == "-clean-thinking" {
+			cleanThinking = true
+			continue
+		}
+		if arg == "--thinking-gist" || arg == "-thinking-gist" {
+			thinkingGist = true
+			continue
+		}
+		if arg == "--per-turn-tokens" || arg == "-per-turn-tokens" {
+			perTurnTokens = true
+			continue
+		}
+		if arg == "--per-message-cost" || arg == "-per-message-cost" {
+			perMessageCost = true
+			continue
+		}
+		if arg == "--merge-text" || arg == "-merge-text" {
+			mergeText = true
+			continue
+		}
+		if arg == "--answer-only" || arg == "-answer-only" {
+			answerOnly = true
+			continue
+		}
+		if arg == "--todo-progress" || arg == "-todo-progress" {
+			todoProgress = true
+			continue
+		}
+		if arg == "--log-prompts" || arg == "-log-prompts" {
+			// Next arg is the prompt log path
+			if i+1 < len(args) {
+				i++
+				logPrompts = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--log-prompts=") {
+			logPrompts = strings.TrimPrefix(arg, "--log-prompts=")
+			continue
+		}
+		if arg == "--no-result-on-empty" || arg == "-no-result-on-empty" {
+			noEmptyResults = true
+			continue
+		}
+		if arg == "--collapse-reads" || arg == "-collapse-reads" {
+			collapseReads = true
+			continue
+		}
+		if arg == "--normalize-tool-names" || arg == "-normalize-tool-names" {
+			normalizeToolNames = true
+			continue
+		}
+		if arg == "--dim-results" || arg == "-dim-results" {
+			dimResults = true
+			continue
+		}
+		if arg == "--files-summary" || arg == "-files-summary" {
+			filesSummary = true
+			continue
+		}
+		if arg == "--reconnect" || arg == "-reconnect" {
+			reconnect = true
+			continue
+		}
+		if arg == "--resume" || arg == "-resume" {
+			// Next arg is the session ID
+			if i+1 < len(args) {
+				i++
+				resumeID = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--resume=") {
+			resumeID = strings.TrimPrefix(arg, "--resume=")
+			continue
+		}
+		if arg == "--continue" || arg == "-continue" {
+			continueSession = true
+			continue
+		}
+		if arg == "--validate-resume" || arg == "-validate-resume" {
+			checkResume = true
+			continue
+		}
+		if arg == "--project" || arg == "-project" {
+			// Next arg is the project name or path
+			if i+1 < len(args) {
+				i++
+				project = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--project=") {
+			project = strings.TrimPrefix(arg, "--project=")
+			continue
+		}
+		if arg == "--show-uuids" || arg == "-show-uuids" {
+			showUUIDs = true
+			continue
+		}
+		if arg == "--full-uuids" || arg == "-full-uuids" {
+			// Full UUIDs imply showing them
+			showUUIDs = true
+			fullUUIDs = true
+			continue
+		}
+		if arg == "--keep-partial-on-error" || arg == "-keep-partial-on-error" {
+			keepPartialOnError = true
+			continue
+		}
+		if arg == "--claude-cmd" || arg == "-claude-cmd" {
+			// Next arg is the command line that runs claude
+			if i+1 < len(args) {
+				i++
+				claudeCmd = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--claude-cmd=") {
+			claudeCmd = strings.TrimPrefix(arg, "--claude-cmd=")
+			continue
+		}
+		if arg == "--claude-bin" || arg == "-claude-bin" {
+			// Next arg is the claude binary
+			if i+1 < len(args) {
+				i++
+				claudeBin = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--claude-bin=") {
+			claudeBin = strings.TrimPrefix(arg, "--claude-bin=")
+			continue
+		}
+		if arg == "--denials-out" || arg == "-denials-out" {
+			// Next arg is the denial log path
+			if i+1 < len(args) {
+				i++
+				denialsOut = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--denials-out=") {
+			denialsOut = strings.TrimPrefix(arg, "--denials-out=")
+			continue
+		}
+		if arg == "--thinking-out" || arg == "-thinking-out" {
+			// Next arg is the thinking sidecar path
+			if i+1 < len(args) {
+				i++
+				thinkingOut = args[i]
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--thinking-out=") {
+			thinkingOut = strings.TrimPrefix(arg, "--thinking-out=")
+			continue
+		}
 		if arg == "--format" || arg == "-format" {
 			// Next arg is the format value
 			if i+1 < len(args) {
@@ -103,16 +984,131 @@ func main() {
 		claudeArgs = append(claudeArgs, arg)
 	}
 
+	// Redirected output gets the --pipe defaults; --no-pipe keeps the terminal ones
+	if noPipe {
+		pipe = false
+	} else if redirected(stdout) {
+		pipe = true
+	}
+	if pipe {
+		noColor = true
+	}
+
 	// Apply --no-color flag to color system
 	if noColor {
 		SetNoColor(true)
 	}
 
+	// Previewing the colors doesn't run claude either
+	if colorTest {
+		runColorTest(stdout)
+		return 0
+	}
+
+	// Comparing saved sessions doesn't run claude
+	if compareFiles != nil {
+		if err := runCompare(stdout, compareFiles[0], compareFiles[1], GetScheme()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --compare: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	// Run whatever was copied, after any instruction given as the prompt
+	if clipboard {
+		text, err := readClipboard()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --clipboard: %v\n", err)
+			return 1
+		}
+		claudeArgs = withClipboardPrompt(claudeArgs, text)
+	}
+
+	// --reconnect, --resume and --continue each pick the session claude resumes
+	picked := 0
+	for _, set := range []bool{reconnect, resumeID != "", continueSession} {
+		if set {
+			picked++
+		}
+	}
+	if picked > 1 {
+		fmt.Fprintln(os.Stderr, "Error: use only one of --reconnect, --resume and --continue")
+		return 1
+	}
+	if resumeID != "" {
+		claudeArgs = append([]string{"--resume", resumeID}, claudeArgs...)
+	}
+	if continueSession {
+		claudeArgs = append([]string{"--continue"}, claudeArgs...)
+	}
+
+	// Resume the project's most recent session without looking up its ID
+	if reconnect {
+		sessionID, err := reconnectSession(project)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --reconnect: %v\n", err)
+			return 1
+		}
+		claudeArgs = append([]string{"--resume", sessionID}, claudeArgs...)
+	}
+
+	// Check the session being resumed is intact before claude starts on it, so the banner can
+	// say which it is
+	resumeSession, resumeDetail := resumeSessionID(claudeArgs), ""
+	if checkResume {
+		resumeProject := project
+		if resumeSession == "" && continuesSession(claudeArgs) {
+			// claude continues the most recent session of the directory it runs in
+			resumeProject = ""
+			latest, err := reconnectSession(resumeProject)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --validate-resume: %v\n", err)
+				return 1
+			}
+			resumeSession = latest
+		}
+		if resumeSession != "" {
+			info, err := validateResume(resumeProject, resumeSession)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --validate-resume: %v\n", err)
+				return 1
+			}
+			if info.Model != "" {
+				resumeDetail += fmt.Sprintf(" (%s)", info.Model)
+			}
+			if info.FirstPrompt != "" {
+				resumeDetail += fmt.Sprintf(": %q", info.FirstPrompt)
+			}
+		}
+	}
+
 	args = claudeArgs
-	if len(args) == 0 {
+	if len(args) == 0 && replay == "" {
 		fmt.Fprintln(os.Stderr, "Error: No prompt or arguments provided")
 		printUsage()
-		os.Exit(1)
+		return 1
+	}
+
+	var summaryTmpl *template.Template
+	if summaryTemplate != "" {
+		tmpl, err := ParseSummaryTemplate(summaryTemplate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --summary-template: %v\n", err)
+			return 1
+		}
+		summaryTmpl = tmpl
+	}
+
+	command, err := claudeCommand(claudeCmd, claudeBin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	stderrFilter, err := NewStderrFilter(quietErrors, filterStderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --filter-stderr pattern: %v\n", err)
+		return 1
 	}
 
 	// Create context with signal handling
@@ -122,30 +1118,183 @@ func main() {
 	// Handle OS signals for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 	go func() {
-		<-sigChan
-		fmt.Fprintln(os.Stderr, "\nReceived interrupt signal, shutting down...")
-		cancel()
+		select {
+		case <-sigChan:
+			fmt.Fprintln(os.Stderr, "\nReceived interrupt signal, shutting down...")
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
 
-	// Create and start the Claude runner
-	runner, err := NewClaudeRunner(ctx, args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating runner: %v\n", err)
-		os.Exit(1)
+	// Create and start the Claude runner, or read a capture instead of running claude
+	var runner Runner
+	if replay != "" {
+		runner, err = NewFileRunner(ctx, replay)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --replay: %v\n", err)
+			return 1
+		}
+	} else {
+		runner, err = newRunner(ctx, command, args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating runner: %v\n", err)
+			return 1
+		}
 	}
 
+	// Create output processor
+	processor := NewOutputProcessor(format, verbose, quiet)
+	processor.writer = stdout
+	processor.foldResults = foldResults
+	processor.copyable = copyable
+	processor.thinkingLast = thinkingLast
+	processor.onlyAgent = onlyAgent
+	processor.seqTags = seqTags
+	processor.summaryTemplate = summaryTmpl
+	processor.noRawInput = noRawInput
+	processor.confirmTools = confirmTools
+	processor.onlyTools = onlyTools
+	processor.hideTools = hideTools
+	processor.showHooks = showHooks
+	processor.contextWarnAt = contextWarnAt
+	processor.indentWidth = indentWidth
+	processor.truncateAt = truncateAt
+	if truncateAt == 0 {
+		processor.truncateAt = -1 // --truncate 0 never cuts
+	}
+	processor.slowToolThreshold = slowToolThreshold
+	processor.summaryWidth = summaryWidth
+	processor.head = head
+	if replay == "" {
+		// A replayed capture spends no tokens, so there is nothing to cut short
+		processor.maxTokens = maxTokens
+		processor.maxCost = maxCost
+	}
+	processor.resumeSession = resumeSession
+	processor.resumeDetail = resumeDetail
+	processor.keepPartialOnError = keepPartialOnError
+	processor.showUUIDs = showUUIDs
+	processor.timestamps = timestamps
+	processor.diffMode = diffMode
+	processor.diffContext = diffContext
+	if diffContext == 0 {
+		processor.diffContext = -1 // --diff-context 0 shows only the changed lines
+	}
+	processor.collapseReads = collapseReads
+	processor.normalizeToolNames = normalizeToolNames
+	processor.dimResults = dimResults
+	processor.filesSummary = filesSummary || verbose
+	processor.noEmptyResults = noEmptyResults
+	processor.perTurnTokens = perTurnTokens
+	processor.perMessageCost = perMessageCost
+	processor.todoProgress = todoProgress
+	processor.mergeText = mergeText
+	processor.noStream = pipe || groupByTurn // Grouping needs a turn's complete text
+	processor.groupByTurn = groupByTurn
+
+	// Only the final answer is printed; everything rendered along the way is dropped
+	if answerOnly {
+		processor.answerOut = stdout
+		processor.writer = io.Discard
+	}
+	processor.cleanThinking = cleanThinking
+	processor.thinkingGist = thinkingGist
+	processor.fullUUIDs = fullUUIDs
+	processor.hideRootAgent = hideRootAgent
+	processor.highlighter = NewHighlighter(highlightTerms, highlightIgnoreCase)
+
+	// Keep a personal history of prompts and the sessions they started
+	if logPrompts != "" {
+		processor.promptLog = NewPromptLog(logPrompts, promptFromArgs(args))
+		defer func() {
+			if err := processor.promptLog.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error logging prompt: %v\n", err)
+			}
+		}()
+	}
+
+	// Capture normalized events to a file alongside the rendered output
+	if eventsOut != "" {
+		eventsFile, err := os.Create(eventsOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating events file: %v\n", err)
+			return 1
+		}
+		defer eventsFile.Close()
+		processor.events = NewEventEmitter(eventsFile)
+	}
+
+	// --format ndjson writes the same normalized events to stdout instead of rendering
+	if processor.mode == OutputModeNDJSON {
+		if processor.events == nil {
+			processor.events = NewEventEmitter(stdout)
+		} else {
+			processor.events.AddSink(stdout)
+		}
+	}
+
+	// Route thinking to its own file so stdout carries only text and tools
+	if thinkingOut != "" {
+		thinkingFile, err := os.Create(thinkingOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating thinking file: %v\n", err)
+			return 1
+		}
+		defer thinkingFile.Close()
+		processor.thinkingWriter = thinkingFile
+	}
+
+	// Keep an audit log of denied tools across runs
+	if denialsOut != "" {
+		denialsFile, err := os.OpenFile(denialsOut, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening denials file: %v\n", err)
+			return 1
+		}
+		defer denialsFile.Close()
+		processor.denialsOut = denialsFile
+	}
+
+	if noBannerNewline {
+		processor.spacing[spacingAfterBanner] = 0
+	}
+
+	if claudeRunner, ok := runner.(*ClaudeRunner); ok {
+		claudeRunner.FilterStderr(stderrFilter)
+
+		// Route stderr through the processor so it interleaves with stdout
+		if mergeStderr {
+			processor.stderr = claudeRunner.MergeStderr()
+		}
+	}
+
+	// --head, --interrupt-after, --max-cost and --max-tokens stop claude before it finishes
+	processor.stop = runner.Stop
+
 	if err := runner.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error starting Claude: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 
-	// Create output processor
-	processor := NewOutputProcessor(format, verbose, quiet)
+	// --interrupt-after caps the run's wall-clock time, however busy claude is
+	if interruptAfter > 0 {
+		timer := time.NewTimer(interruptAfter)
+		defer timer.Stop()
+		processor.interruptAt = timer.C
+		processor.interruptAfter = interruptAfter
+	}
 
 	// Process messages (blocks until completion)
 	processor.ProcessMessages(runner.Messages(), runner.Errors())
 
 	// Wait for runner to complete
 	runner.Wait()
+
+	// A run stopped for going over budget didn't finish its job
+	if processor.costExceeded || processor.tokensExceeded {
+		return 1
+	}
+	return 0
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestFlagParsing tests various flag parsing scenarios
@@ -513,3 +518,604 @@ func TestPrintUsageFunc(t *testing.T) {
 	}()
 	printUsage()
 }
+
+// TestRun_DoubleDashPassthrough tests args after "--" reach claude without ccv interpreting them
+func TestRun_DoubleDashPassthrough(t *testing.T) {
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-passthrough", "claude-sonnet-4-5"),
+		createTestResult(0.01, 1000, 1),
+	}, 0)
+
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out bytes.Buffer
+	code := run([]string{"--quiet", "--", "--verbose", "--format", "json", "prompt"}, &out)
+	if code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	want := []string{"--verbose", "--format", "json", "prompt"}
+	if strings.Join(*gotArgs, " ") != strings.Join(want, " ") {
+		t.Errorf("expected %v passed to claude, got %v", want, *gotArgs)
+	}
+
+	// ccv itself stays in quiet text mode: no banner, no summary
+	if out.Len() != 0 {
+		t.Errorf("expected quiet output, got: %q", out.String())
+	}
+}
+
+func TestRun_ThinkingOut(t *testing.T) {
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-thinking", "claude-sonnet-4-5"),
+		createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "thinking_delta", Thinking: "The user wants a file listing."}, nil),
+		createTestStreamEvent(StreamEventContentBlockStop, nil, nil),
+		createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Listing files."}, nil),
+		createTestStreamEvent(StreamEventContentBlockStop, nil, nil),
+		createTestAssistantMessage([]ContentBlock{
+			{Type: ContentBlockTypeThinking, Thinking: "The user wants a file listing."},
+			{Type: ContentBlockTypeText, Text: "Listing files."},
+		}),
+		createTestResult(0.01, 1000, 1),
+	}, 0)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	path := filepath.Join(t.TempDir(), "thinking.txt")
+	var out bytes.Buffer
+	if code := run([]string{"--no-color", "--thinking-out", path, "List the files"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	if !strings.Contains(out.String(), "Listing files.") {
+		t.Errorf("expected text on the main writer, got: %q", out.String())
+	}
+	if strings.Contains(out.String(), "file listing") || strings.Contains(out.String(), "[THINKING]") {
+		t.Errorf("expected no thinking on the main writer, got: %q", out.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading thinking file: %v", err)
+	}
+	// The complete message repeats the streamed thinking, which the sidecar gets once
+	if want := "[THINKING] The user wants a file listing.\n"; string(data) != want {
+		t.Errorf("expected the sidecar to hold %q, got: %q", want, data)
+	}
+}
+
+// TestRun_StrictArgs tests --strict-args rejects arguments ccv would otherwise guess at
+func TestRun_StrictArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"--strict-args", "prompt", "--format"},
+		{"--strict-args", "--only-agent", "--verbose", "prompt"},
+		{"--strict-args", "--compare", "a.jsonl", "--quiet"},
+		{"--strict-args", "--project", "x", "prompt"},
+	} {
+		runner := newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+		_, restore := useScriptedRunner(runner)
+
+		var out bytes.Buffer
+		if code := run(args, &out); code != 1 {
+			t.Errorf("run(%q) = %d, want 1", args, code)
+		}
+		restore()
+	}
+
+	// Explicit values, and flags after "--", are accepted
+	runner := newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out bytes.Buffer
+	if code := run([]string{"--strict-args", "--quiet", "--only-agent=-x", "--", "--project", "prompt"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if strings.Join(*gotArgs, " ") != "--project prompt" {
+		t.Errorf("expected args after -- passed to claude, got %v", *gotArgs)
+	}
+}
+
+// TestRun_AnswerOnly tests --answer-only prints only the final turn's text
+func TestRun_AnswerOnly(t *testing.T) {
+	first := createTestAssistantMessage([]ContentBlock{
+		{Type: ContentBlockTypeThinking, Thinking: "I should run the numbers."},
+		{Type: ContentBlockTypeText, Text: "Let me calculate that."},
+		*createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "echo $((2+2))"}),
+	})
+	first.Message.ID = "msg_1"
+	final := createTestAssistantMessage([]ContentBlock{
+		{Type: ContentBlockTypeText, Text: "2 + 2 = 4."},
+	})
+	final.Message.ID = "msg_2"
+
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-answer", "claude-sonnet-4-5"),
+		first,
+		&UserMessage{Type: "user", Message: UserMessageContent{Role: "user", Content: []ContentBlock{*createTestToolResultBlock("tool_1", "4", false)}}},
+		final,
+		createTestResult(0.01, 1000, 2),
+	}, 0)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out bytes.Buffer
+	if code := run([]string{"--answer-only", "what's 2+2"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if out.String() != "2 + 2 = 4.\n" {
+		t.Errorf("expected only the final answer, got: %q", out.String())
+	}
+}
+
+// TestRun_FormatNDJSON tests --format ndjson writes one normalized event per line and nothing else
+func TestRun_FormatNDJSON(t *testing.T) {
+	msg := createTestAssistantMessage([]ContentBlock{
+		{Type: ContentBlockTypeText, Text: "Listing files."},
+		*createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls"}),
+	})
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-ndjson", "claude-sonnet-4-5"),
+		msg,
+		&UserMessage{Type: "user", Message: UserMessageContent{Role: "user", Content: []ContentBlock{*createTestToolResultBlock("tool_1", "main.go", false)}}},
+		createTestResult(0.01, 1000, 1),
+	}, 0)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out bytes.Buffer
+	if code := run([]string{"--format", "ndjson", "list files"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	var types []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected only JSON lines, got %q: %v", line, err)
+		}
+		if event.Timestamp == "" || event.AgentID != "main" {
+			t.Errorf("expected a timestamp and the main agent on every event, got: %q", line)
+		}
+		types = append(types, string(event.Type))
+	}
+	if got := strings.Join(types, ","); got != "session_start,text,tool_call,tool_result,result" {
+		t.Errorf("expected one event per step, got: %s", got)
+	}
+}
+
+// TestRun_Head tests --head stops rendering and stops the runner after N turns and tool calls
+func TestRun_Head(t *testing.T) {
+	script := []interface{}{createTestSystemInit("session-head", "claude-sonnet-4-5")}
+	for i := 1; i <= 5; i++ {
+		block := createTestToolUseBlock(fmt.Sprintf("tool_%d", i), "Bash", map[string]interface{}{"command": fmt.Sprintf("echo step-%d", i)})
+		msg := createTestAssistantMessage([]ContentBlock{*block})
+		msg.Message.ID = fmt.Sprintf("msg_%d", i)
+		msg.Message.Usage = &Usage{InputTokens: 100, OutputTokens: 20}
+		script = append(script, createTestStreamEvent(StreamEventContentBlockStart, nil, block), msg)
+	}
+	script = append(script, createTestResult(0.01, 1000, 5))
+	runner := newScriptedRunner(script, 10*time.Millisecond)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--head", "2", "--no-color", "run five steps"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	output := out.String()
+	for _, want := range []string{"echo step-1", "echo step-2", "stopped after 2 turns and tool calls", "Tokens:"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+	for _, unwanted := range []string{"echo step-3", "echo step-5"} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("expected rendering to stop before %q, got:\n%s", unwanted, output)
+		}
+	}
+	select {
+	case <-runner.stop:
+	default:
+		t.Error("expected --head to stop the runner")
+	}
+}
+
+// TestRun_InterruptAfter tests --interrupt-after stops a run at the time cap and summarizes what completed
+func TestRun_InterruptAfter(t *testing.T) {
+	script := []interface{}{createTestSystemInit("session-cap", "claude-sonnet-4-5")}
+	for i := 1; i <= 5; i++ {
+		msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: fmt.Sprintf("Step %d done.", i)}})
+		msg.Message.ID = fmt.Sprintf("msg_%d", i)
+		msg.Message.Usage = &Usage{InputTokens: 100, OutputTokens: 20}
+		script = append(script, msg)
+	}
+	script = append(script, createTestResult(0.01, 1000, 5))
+	runner := newScriptedRunner(script, 100*time.Millisecond)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--interrupt-after", "250ms", "--no-color", "run five steps"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	output := out.String()
+	for _, want := range []string{"Step 1 done.", "[stopped after 250ms (--interrupt-after)]", "Tokens:"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "Step 5 done.") {
+		t.Errorf("expected the run to stop before its last step, got:\n%s", output)
+	}
+	select {
+	case <-runner.stop:
+	default:
+		t.Error("expected --interrupt-after to stop the runner")
+	}
+
+	if code := run([]string{"--interrupt-after", "soon", "prompt"}, &out); code != 1 {
+		t.Errorf("run() = %d for an invalid duration, want 1", code)
+	}
+
+	// JSON output stays parseable: the notice goes to stderr
+	runner = newScriptedRunner(script, 100*time.Millisecond)
+	_, restore = useScriptedRunner(runner)
+	defer restore()
+	out.Reset()
+	if code := run([]string{"--interrupt-after", "250ms", "--format", "json", "run five steps"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("expected only JSON on stdout, got line: %q", line)
+		}
+	}
+}
+
+// TestRun_MaxCost tests --max-cost stops the run and exits non-zero once the streamed cost passes it
+func TestRun_MaxCost(t *testing.T) {
+	script := []interface{}{createTestSystemInit("session-budget", "claude-sonnet-4-5")}
+	for i := 1; i <= 5; i++ {
+		msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: fmt.Sprintf("Step %d done.", i)}})
+		msg.Message.ID = fmt.Sprintf("msg_%d", i)
+		msg.CostUSD = 0.02
+		script = append(script, msg)
+		if i == 1 {
+			// Repeats of a message don't count twice
+			script = append(script, msg)
+		}
+	}
+	script = append(script, createTestResult(0.1, 1000, 5))
+	runner := newScriptedRunner(script, 20*time.Millisecond)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--max-cost", "$0.05", "--no-color", "run five steps"}, &out); code != 1 {
+		t.Fatalf("run() = %d, want 1 for a run over budget", code)
+	}
+	output := out.String()
+	if !strings.Contains(output, "Step 3 done.") || strings.Contains(output, "Step 5 done.") {
+		t.Errorf("expected the run to stop after the third step, got:\n%s", output)
+	}
+	select {
+	case <-runner.stop:
+	default:
+		t.Error("expected --max-cost to stop the runner")
+	}
+
+	// Within budget the run finishes normally
+	runner = newScriptedRunner(script, 0)
+	_, restore = useScriptedRunner(runner)
+	defer restore()
+	if code := run([]string{"--max-cost", "1", "--no-color", "run five steps"}, &out); code != 0 {
+		t.Errorf("run() = %d within budget, want 0", code)
+	}
+
+	// The result's total arrives after the run is over, so there is nothing left to stop
+	runner = newScriptedRunner([]interface{}{createTestSystemInit("session-budget", "claude-sonnet-4-5"), createTestResult(0.1, 1000, 1)}, 0)
+	_, restore = useScriptedRunner(runner)
+	defer restore()
+	if code := run([]string{"--max-cost", "0.05", "--no-color", "run one step"}, &out); code != 0 {
+		t.Errorf("run() = %d for a run that finished, want 0", code)
+	}
+}
+
+// TestRun_MaxCostEstimated tests --max-cost estimates the cost from usage when claude doesn't
+// report it, counting each message's repeated usage once
+func TestRun_MaxCostEstimated(t *testing.T) {
+	// Each step is $0.315 at Sonnet's list price, so a $0.50 budget allows one
+	script := []interface{}{createTestSystemInit("session-budget", "claude-sonnet-4-5")}
+	for i := 1; i <= 3; i++ {
+		for _, text := range []string{"Working.", fmt.Sprintf("Step %d done.", i)} {
+			msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: text}})
+			msg.Message.ID = fmt.Sprintf("msg_%d", i)
+			msg.Message.Usage = &Usage{InputTokens: 100000, OutputTokens: 1000}
+			script = append(script, msg)
+		}
+	}
+	script = append(script, createTestResult(0.95, 1000, 3))
+
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			runner := newScriptedRunner(script, 20*time.Millisecond)
+			_, restore := useScriptedRunner(runner)
+			defer restore()
+			defer SetNoColor(false)
+
+			var out bytes.Buffer
+			if code := run([]string{"--format", format, "--max-cost", "0.50", "--no-color", "run three steps"}, &out); code != 1 {
+				t.Fatalf("run() = %d, want 1 for a run over budget", code)
+			}
+			if !strings.Contains(out.String(), "Step 1 done.") || strings.Contains(out.String(), "Step 3 done.") {
+				t.Errorf("expected the run to stop during the second step, got:\n%s", out.String())
+			}
+			select {
+			case <-runner.stop:
+			default:
+				t.Error("expected --max-cost to stop the runner")
+			}
+		})
+	}
+
+	// A replayed capture spends nothing
+	capture := filepath.Join(t.TempDir(), "capture.jsonl")
+	var lines []string
+	for _, msg := range script {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(data))
+	}
+	if err := os.WriteFile(capture, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if code := run([]string{"--max-cost", "0.50", "--no-color", "--replay", capture}, &out); code != 0 {
+		t.Errorf("run() = %d replaying, want 0", code)
+	}
+	if !strings.Contains(out.String(), "Step 3 done.") {
+		t.Errorf("expected the whole capture replayed, got:\n%s", out.String())
+	}
+}
+
+// TestRun_MaxTokens tests --max-tokens stops the run once the total tokens pass the budget
+// tokenBudgetScript is a five-step session using 120 tokens a step
+func tokenBudgetScript() []interface{} {
+	script := []interface{}{createTestSystemInit("session-tokens", "claude-sonnet-4-5")}
+	for i := 1; i <= 5; i++ {
+		msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: fmt.Sprintf("Step %d done.", i)}})
+		msg.Message.ID = fmt.Sprintf("msg_%d", i)
+		msg.Message.Usage = &Usage{InputTokens: 100, OutputTokens: 20}
+		script = append(script, msg)
+	}
+	return append(script, createTestResult(0.01, 1000, 5))
+}
+
+func TestRun_MaxTokens(t *testing.T) {
+	runner := newScriptedRunner(tokenBudgetScript(), 20*time.Millisecond)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--max-tokens", "300", "--no-color", "run five steps"}, &out); code != 1 {
+		t.Fatalf("run() = %d, want 1", code)
+	}
+
+	output := out.String()
+	for _, want := range []string{"Step 3 done.", "[Token budget exceeded: 360/300]", "Tokens:"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "Step 5 done.") {
+		t.Errorf("expected the run to stop before its last step, got:\n%s", output)
+	}
+	select {
+	case <-runner.stop:
+	default:
+		t.Error("expected --max-tokens to stop the runner")
+	}
+}
+
+// TestRun_MaxTokensRawFormats tests --max-tokens also stops runs whose output isn't rendered,
+// keeping its notice out of stdout
+func TestRun_MaxTokensRawFormats(t *testing.T) {
+	for _, format := range []string{"json", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			runner := newScriptedRunner(tokenBudgetScript(), 20*time.Millisecond)
+			_, restore := useScriptedRunner(runner)
+			defer restore()
+
+			var out bytes.Buffer
+			if code := run([]string{"--format", format, "--max-tokens", "300", "run five steps"}, &out); code != 1 {
+				t.Fatalf("run() = %d, want 1", code)
+			}
+			select {
+			case <-runner.stop:
+			default:
+				t.Error("expected --max-tokens to stop the runner")
+			}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if !json.Valid([]byte(line)) {
+					t.Errorf("expected only JSON on stdout, got line: %q", line)
+				}
+			}
+		})
+	}
+}
+
+// TestRun_MaxTokensRepeatedUsage tests --max-tokens counts a message's usage once, though claude
+// repeats it on each content block and again in message_delta
+func TestRun_MaxTokensRepeatedUsage(t *testing.T) {
+	usage := &Usage{InputTokens: 1000, OutputTokens: 50}
+	script := func() []interface{} {
+		thinking := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeThinking, Thinking: "Plan."}})
+		thinking.Message.Usage = usage
+		text := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Done."}})
+		text.Message.Usage = usage
+		return []interface{}{
+			createTestSystemInit("session-usage", "claude-sonnet-4-5"),
+			&StreamEvent{Type: StreamEventMessageStart, Message: &MessageContent{ID: "msg_test"}},
+			thinking,
+			text,
+			&StreamEvent{Type: StreamEventMessageDelta, Delta: &Delta{StopReason: "end_turn"}, Usage: &Usage{OutputTokens: 50}},
+			createTestResult(0.01, 1000, 1),
+		}
+	}
+
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			runner := newScriptedRunner(script(), 0)
+			_, restore := useScriptedRunner(runner)
+			defer restore()
+			defer SetNoColor(false)
+
+			var out bytes.Buffer
+			if code := run([]string{"--format", format, "--max-tokens", "1500", "--no-color", "finish"}, &out); code != 0 {
+				t.Fatalf("run() = %d, want 0, output:\n%s", code, out.String())
+			}
+			if strings.Contains(out.String(), "Token budget exceeded") {
+				t.Errorf("expected 1050 tokens to stay within the budget, got:\n%s", out.String())
+			}
+		})
+	}
+}
+
+// TestRun_Pipe tests --pipe turns off color and writes text once complete instead of as it streams
+func TestRun_Pipe(t *testing.T) {
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-pipe", "claude-sonnet-4-5"),
+		createTestStreamEvent(StreamEventContentBlockStart, nil, createTestContentBlock(ContentBlockTypeText, "")),
+		createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Hel"}, nil),
+		createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "lo"}, nil),
+		createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Hello"}}),
+	}, 0)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--pipe", "Say hello"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Errorf("expected no color codes with --pipe, got: %q", out.String())
+	}
+	if strings.Count(out.String(), "Hello") != 1 || strings.Contains(out.String(), "Hel\n") {
+		t.Errorf("expected the text once, written whole, got: %q", out.String())
+	}
+}
+
+// TestRun_RedirectedThinking tests thinking streamed to redirected output is written once
+// complete, without a stray line where the streamed block would have ended
+func TestRun_RedirectedThinking(t *testing.T) {
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-pipe", "claude-sonnet-4-5"),
+		createTestStreamEvent(StreamEventContentBlockStart, nil, createTestContentBlock(ContentBlockTypeThinking, "")),
+		createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "thinking_delta", Thinking: "Check the "}, nil),
+		createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "thinking_delta", Thinking: "tests."}, nil),
+		createTestStreamEvent(StreamEventContentBlockStop, nil, nil),
+		createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeThinking, Thinking: "Check the tests."}}),
+	}, 0)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if code := run([]string{"Think first"}, f); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); !strings.Contains(got, "\n\n[THINKING] Check the tests.\n") || strings.Contains(got, "\n\n\n") {
+		t.Errorf("expected the thinking written whole on its own line, got: %q", got)
+	}
+}
+
+// TestRedirected tests files count as redirected output and other writers don't
+func TestRedirected(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if !redirected(f) {
+		t.Error("expected a regular file to count as redirected")
+	}
+	if redirected(&bytes.Buffer{}) {
+		t.Error("expected a buffer not to count as redirected")
+	}
+}
+
+// TestRun_DenialsOut tests --denials-out appends one JSON line per permission denial
+func TestRun_DenialsOut(t *testing.T) {
+	result := createTestResult(0.01, 1000, 1)
+	result.SessionID = "session-denied"
+	result.PermissionDenials = []PermissionDenial{
+		{ToolName: "Bash", Reason: "rm -rf is not allowed"},
+		{ToolName: "mcp__github__create_issue"},
+	}
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-denied", "claude-sonnet-4-5"),
+		result,
+	}, 0)
+
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	path := filepath.Join(t.TempDir(), "denials.jsonl")
+	var out bytes.Buffer
+	if code := run([]string{"--no-color", "--denials-out", path, "Clean up"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading denials file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 denial lines, got %d: %q", len(lines), data)
+	}
+
+	var record map[string]string
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", lines[0], err)
+	}
+	if record["tool_name"] != "Bash" || record["reason"] != "rm -rf is not allowed" || record["session_id"] != "session-denied" || record["timestamp"] == "" {
+		t.Errorf("unexpected denial record: %v", record)
+	}
+
+	if !strings.Contains(out.String(), "Denied: Bash, github:create_issue") {
+		t.Errorf("expected denied tools in the summary, got: %q", out.String())
+	}
+}
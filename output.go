@@ -6,7 +6,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
 // OutputMode represents the output formatting mode
@@ -17,17 +23,150 @@ const (
 	OutputModeJSON    OutputMode = "json"
 	OutputModeVerbose OutputMode = "verbose"
 	OutputModeQuiet   OutputMode = "quiet"
+	OutputModePlain   OutputMode = "plain"  // Text without colors, glyphs, banner or separators
+	OutputModeNDJSON  OutputMode = "ndjson" // Normalized events only, one JSON object per line
+	OutputModeScript  OutputMode = "script" // The session's side effects as a shell script
 )
 
+// spacingBlock identifies an output block that may be followed by blank lines
+type spacingBlock int
+
+const (
+	spacingAfterBanner spacingBlock = iota
+	spacingAfterText
+	spacingAfterThinking
+	spacingBeforeSummary
+)
+
+// spacingPolicy maps output blocks to the number of blank lines emitted around them
+type spacingPolicy map[spacingBlock]int
+
+// defaultSpacing returns the standard spacing: one blank line between blocks
+func defaultSpacing() spacingPolicy {
+	return spacingPolicy{
+		spacingAfterBanner:   1,
+		spacingAfterText:     1,
+		spacingAfterThinking: 1,
+		spacingBeforeSummary: 1,
+	}
+}
+
 // OutputProcessor processes and formats messages from the Claude runner
 type OutputProcessor struct {
-	mode   OutputMode
-	writer io.Writer
-	state  *AppState
-	result *Result       // Final result with cost, duration, turns
-	colors *ColorScheme  // Terminal color scheme
+	mode               OutputMode
+	writer             io.Writer
+	state              *AppState
+	result             *Result            // Final result with cost, duration, turns
+	colors             *ColorScheme       // Terminal color scheme
+	stderr             <-chan string      // Merged stderr lines (nil unless --merge-stderr)
+	spacing            spacingPolicy      // Blank lines between blocks (nil uses defaultSpacing)
+	foldResults        bool               // Collapse tool results to a one-line summary (unless verbose)
+	highlighter        *regexp.Regexp     // --highlight terms (nil when not highlighting)
+	pendingLine        string             // Streamed text held back until a full line is available for highlighting
+	copyable           bool               // Also print Bash commands and file paths on bare, uncolored lines
+	hideRootAgent      bool               // Never print the root agent's context, even once subagents exist
+	events             *EventEmitter      // Normalized event capture (nil unless --events-out)
+	thinkingLast       bool               // Defer thinking until after the turn's text
+	deferred           []string           // Thinking held back for the current turn (--thinking-last)
+	deferredTurn       string             // Message ID the deferred thinking belongs to
+	onlyAgent          string             // Render only this agent type's activity (empty renders all)
+	seqTags            bool               // Tag each message's output with its sequence number
+	midLine            bool               // The last output tagged by --seq or --show-uuids ended partway through a line
+	seq                int                // Number of messages consumed so far
+	summaryTemplate    *template.Template // Custom final summary layout (nil uses the default)
+	streamMessageID    string             // ID of the message currently streaming
+	stopNotedID        string             // ID of the last message whose stop sequence was noted
+	noRawInput         bool               // Skip the raw input JSON dump for unformatted tools in verbose mode
+	confirmTools       map[string]bool    // Tools that get an "about to run" warning (--confirm-tools)
+	onlyTools          map[string]bool    // Render only these tools' calls and results (--only-tools; empty renders all)
+	hideTools          map[string]bool    // Tools whose calls and results are not rendered (--hide-tools)
+	showHooks          bool               // Render hook events (--show-hooks)
+	indentBuf          bytes.Buffer       // Scratch buffer for verbose input JSON, reused across tool calls
+	contextWarnAt      float64            // Fraction of the context window that triggers a warning (0 disables)
+	contextWarned      bool               // The context warning fires once per session
+	thinkingWriter     io.Writer          // Sidecar for thinking content (--thinking-out); nil keeps it inline
+	cleanThinking      bool               // Strip wrapper tags and extra blank lines from thinking
+	thinkingGist       bool               // Show each thinking block as its first sentence (not in verbose mode)
+	perTurnTokens      bool               // Print each turn's token usage (--per-turn-tokens)
+	perMessageCost     bool               // Print each assistant message's cost and duration
+	turnTokensID       string             // Message whose usage --per-turn-tokens printed last
+	promptLog          *PromptLog         // Records the prompt and session ID (--log-prompts)
+	noEmptyResults     bool               // Skip successful results with no content (--no-result-on-empty)
+	collapseReads      bool               // Batch consecutive Read calls into one line
+	normalizeToolNames bool               // Display tool names with consistent casing
+	dimResults         bool               // Show tool result bodies dim
+	filesSummary       bool               // List the files the session touched at the end
+	pendingReads       []*ToolCall        // Reads batched since the last other output (--collapse-reads)
+	collapsedReads     map[string]bool    // IDs of batched reads, whose results are hidden unless they fail
+	streamedText       bool               // Assistant text arrives as deltas, so complete text blocks are duplicates
+	streamedThinking   bool               // Thinking was rendered when its block finished streaming, so complete thinking blocks are duplicates
+	noStream           bool               // Render text and thinking once complete instead of as deltas arrive
+	groupByTurn        bool               // Print each turn's text before its tool calls
+	turnTools          []*ToolCall        // Tool calls held back until the turn ends (--group-by-turn)
+	turnID             string             // Message ID of the turn holding turnTools
+	textShown          bool               // Any assistant text has been shown, so Result.Result is a duplicate
+	glyphs             *Glyphs            // Tool line symbols; nil means DefaultGlyphs
+	showUUIDs          bool               // Prefix each message's output with its (truncated) uuid
+	timestamps         string             // Stamp each block of output: timestampsClock or timestampsRelative
+	startTime          time.Time          // When the first message was processed, for relative timestamps
+	msgTime            time.Time          // When the current message was processed
+	now                func() time.Time   // Clock for timestamps (nil uses time.Now)
+	fullUUIDs          bool               // Show uuids in full rather than truncated to 8 characters
+	keepPartialOnError bool               // Keep streaming state across errors instead of resetting it
+	indentWidth        int                // Spaces per indentation level (0 uses defaultIndentWidth)
+	truncateAt         int                // Length long tool inputs are cut to (0 uses defaultTruncateAt, negative never cuts)
+	todoProgress       bool               // Show a completion bar after each TodoWrite list
+	answerOut          io.Writer          // Final answer destination (--answer-only); everything else goes to a discarded writer
+	answer             []string           // Text blocks of the main agent's latest turn (--answer-only)
+	answerTurn         string             // Message ID the answer text belongs to
+	mergeText          bool               // Run a turn's consecutive text blocks together without blank lines
+	textOpen           bool               // Text was shown and its trailing spacing is held back (--merge-text)
+	textTurn           string             // Message ID of the held-back text
+	denialsOut         io.Writer          // JSONL log of permission denials (--denials-out)
+	slowToolThreshold  time.Duration      // Tools running longer than this get a slow marker (0 disables)
+	summaryWidth       int                // Terminal width the summary is laid out for (0 keeps the compact layout)
+	head               int                // Stop after this many assistant turns and tool calls (0 renders everything)
+	headCount          int                // Turns and tool calls rendered so far (--head)
+	stop               func()             // Stops the runner once --head, --interrupt-after, --max-cost or --max-tokens is reached
+	interruptAt        <-chan time.Time   // Fires when the --interrupt-after time cap is reached (nil without one)
+	interruptAfter     time.Duration      // The --interrupt-after time cap, for its notice
+	diffMode           string             // How Edit diffs render: diffModeLine (also the zero value), diffModeWord or diffModeUnified
+	diffContext        int                // Context lines around unified diff hunks (0 uses defaultDiffContext, negative none)
+	scriptStarted      bool               // The --format script shebang has been written
+	scripted           map[string]bool    // IDs of tool calls already written by --format script
+	resumeSession      string             // ID of the session claude is resuming, announced before the stream starts
+	resumeDetail       string             // Model and first prompt of the resumed session, from --validate-resume
+	maxCost            float64            // Stop the run once it has cost more than this many dollars (0 is no limit)
+	spent              float64            // Running cost claude reported for the assistant messages seen so far
+	messageCosts       map[string]float64 // Cost last reported for each assistant message ID
+	costExceeded       bool               // The run went over --max-cost, so ccv exits non-zero
+	maxTokens          int                // Stop the run once it has used more than this many tokens (0 is no limit)
+	tokensExceeded     bool               // The --max-tokens notice has been shown and the runner told to stop
 }
 
+// defaultIndentWidth is the number of spaces per indentation level unless --indent says otherwise
+const defaultIndentWidth = 2
+
+// --timestamps styles: wall-clock time, or the offset from the session start
+const (
+	timestampsClock    = "clock"
+	timestampsRelative = "relative"
+)
+
+// --diff modes: whole removed and added lines, changed words highlighted inline, or a unified
+// diff patch
+const (
+	diffModeLine    = "line"
+	diffModeWord    = "word"
+	diffModeUnified = "unified"
+)
+
+// defaultDiffContext is how many context lines surround a unified diff hunk unless --diff-context says otherwise
+const defaultDiffContext = 3
+
+// defaultTruncateAt is how much of a long prompt, query or typed text is shown unless --truncate says otherwise
+const defaultTruncateAt = 120
+
 // NewOutputProcessor creates a new output processor
 func NewOutputProcessor(format string, verbose bool, quiet bool) *OutputProcessor {
 	mode := OutputModeText
@@ -38,14 +177,68 @@ func NewOutputProcessor(format string, verbose bool, quiet bool) *OutputProcesso
 		mode = OutputModeVerbose
 	} else if format == "json" {
 		mode = OutputModeJSON
+	} else if format == "plain" {
+		mode = OutputModePlain
+	} else if format == "ndjson" {
+		mode = OutputModeNDJSON
+	} else if format == "script" {
+		mode = OutputModeScript
+	}
+
+	p := &OutputProcessor{
+		mode:              mode,
+		writer:            os.Stdout,
+		state:             NewAppState(),
+		colors:            GetScheme(),
+		spacing:           defaultSpacing(),
+		contextWarnAt:     0.9,
+		slowToolThreshold: defaultSlowToolThreshold,
+	}
+
+	// Plain output reuses the text rendering with all decoration emptied out
+	if mode == OutputModePlain {
+		p.colors = NoColorScheme()
+		p.glyphs = PlainGlyphs()
+	}
+	return p
+}
+
+// space writes the blank lines the spacing policy assigns to a block
+func (p *OutputProcessor) space(block spacingBlock) {
+	policy := p.spacing
+	if policy == nil {
+		policy = defaultSpacing()
+	}
+	for i := 0; i < policy[block]; i++ {
+		fmt.Fprintln(p.writer)
+	}
+}
+
+// glyphSet returns the processor's glyphs, defaulting when none are set
+func (p *OutputProcessor) glyphSet() *Glyphs {
+	if p.glyphs == nil {
+		return DefaultGlyphs()
+	}
+	return p.glyphs
+}
+
+// indent returns the leading whitespace for depth levels of nesting. Tool results sit one
+// level deep and subagent activity one level per agent depth.
+func (p *OutputProcessor) indent(depth int) string {
+	width := p.indentWidth
+	if width <= 0 {
+		width = defaultIndentWidth
 	}
+	return strings.Repeat(" ", width*depth)
+}
 
-	return &OutputProcessor{
-		mode:   mode,
-		writer: os.Stdout,
-		state:  NewAppState(),
-		colors: GetScheme(),
+// truncate cuts a long tool input to the --truncate length
+func (p *OutputProcessor) truncate(s string) (string, bool) {
+	n := p.truncateAt
+	if n == 0 {
+		n = defaultTruncateAt
 	}
+	return truncateInput(s, n)
 }
 
 // ProcessMessages consumes messages from the channel and outputs them
@@ -58,24 +251,132 @@ func (p *OutputProcessor) ProcessMessages(messages <-chan interface{}, errors <-
 		}
 	}()
 
+	p.printResumeBanner()
+
 	for {
 		select {
 		case msg, ok := <-messages:
 			if !ok {
 				// Channel closed, processing complete
+				p.flushStreamText()
+				p.closeText()
+				p.flushTurnTools()
+				p.flushDeferredThinking()
+				p.flushReads()
+				p.drainStderr()
+				p.flushOrphanResults()
 				p.printFinalSummary()
+				p.printFilesSummary()
+				p.printAnswer()
 				return
 			}
 			p.processMessage(msg)
 
-		case err := <-errors:
+		case err, ok := <-errors:
+			if !ok {
+				// Stop selecting on the closed channel, which would otherwise spin this loop
+				errors = nil
+				continue
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				if !p.keepPartialOnError {
+					p.resetInterruptedStream()
+				}
 			}
+
+		case line, ok := <-p.stderr:
+			if !ok {
+				// Stop selecting on the closed channel
+				p.stderr = nil
+				continue
+			}
+			p.printStderrLine(line)
+
+		case <-p.interruptAt:
+			p.interruptAt = nil
+			p.interruptRun()
 		}
 	}
 }
 
+// interruptRun stops the runner when the --interrupt-after time cap is reached. Messages
+// already sent still render, and the summary covers what completed.
+func (p *OutputProcessor) interruptRun() {
+	if p.rawOutput() {
+		// Keep JSON output parseable - the notice goes to stderr there
+		fmt.Fprintf(os.Stderr, "[stopped after %s (--interrupt-after)]\n", p.interruptAfter)
+	} else if p.mode != OutputModeQuiet {
+		// A block cut off mid-stream is closed so the notice starts its own line
+		p.resetInterruptedStream()
+		p.closeText()
+		c := p.colors
+		fmt.Fprintf(p.writer, "%s[stopped after %s (--interrupt-after)]%s\n", c.LabelDim, p.interruptAfter, c.Reset)
+	}
+	if p.stop != nil {
+		// Stop waits for the runner to drain, which needs this goroutine to keep reading
+		go p.stop()
+	}
+}
+
+// printResumeBanner announces the session being resumed, e.g. [Resuming session: 4f2a…], or
+// with --validate-resume its model and first prompt too
+func (p *OutputProcessor) printResumeBanner() {
+	if p.resumeSession == "" || (p.mode != OutputModeText && p.mode != OutputModeVerbose) {
+		return
+	}
+	c := p.colors
+	if p.resumeDetail != "" {
+		fmt.Fprintf(p.writer, "%s[Resuming %s%s]%s\n", c.LabelDim, p.resumeSession, p.resumeDetail, c.Reset)
+		return
+	}
+	fmt.Fprintf(p.writer, "%s[Resuming session: %s]%s\n", c.SessionInfo, p.resumeSession, c.Reset)
+}
+
+// resetInterruptedStream discards streaming state after an error, so a message cut off
+// mid-stream doesn't bleed into the next one. An unfinished line is closed first.
+func (p *OutputProcessor) resetInterruptedStream() {
+	stream := p.state.Stream
+	if (stream.PartialText != "" || stream.PartialThinking != "") && p.mode != OutputModeQuiet {
+		p.flushStreamText()
+		fmt.Fprint(p.writer, p.colors.Reset)
+		fmt.Fprintln(p.writer)
+	}
+	p.pendingLine = ""
+	p.state.ClearStreamState()
+}
+
+// drainStderr prints the merged stderr lines still to come once stdout is done, until the
+// runner closes the channel. claude can write to stderr after its last message, and the
+// runner blocks on a full channel until it is read.
+func (p *OutputProcessor) drainStderr() {
+	if p.stderr == nil {
+		return
+	}
+	for line := range p.stderr {
+		p.printStderrLine(line)
+	}
+	p.stderr = nil
+}
+
+// rawOutput reports whether the format is machine-readable (json, ndjson, script), where
+// ccv's own notices must stay out of stdout
+func (p *OutputProcessor) rawOutput() bool {
+	return p.mode == OutputModeJSON || p.mode == OutputModeNDJSON || p.mode == OutputModeScript
+}
+
+// printStderrLine prints a merged stderr line as a dim [stderr] line
+func (p *OutputProcessor) printStderrLine(line string) {
+	// Keep JSON output parseable - stderr goes back to stderr there
+	if p.rawOutput() {
+		fmt.Fprintln(os.Stderr, line)
+		return
+	}
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s[stderr] %s%s\n", c.LabelDim, line, c.Reset)
+}
+
 // processMessage handles a single message based on its type
 func (p *OutputProcessor) processMessage(msg interface{}) {
 	// Add recovery to catch any panics during message processing
@@ -86,7 +387,30 @@ func (p *OutputProcessor) processMessage(msg interface{}) {
 		}
 	}()
 
-	// JSON mode: just output the raw message
+	p.seq++
+	p.stampMessage()
+
+	// Capture normalized events independently of the rendered format
+	if p.events != nil {
+		p.events.Observe(msg)
+	}
+
+	// The cost and token budgets apply whatever the format
+	p.trackCost(msg)
+	p.trackTokens(msg)
+
+	// NDJSON mode: the normalized events are the whole output
+	if p.mode == OutputModeNDJSON {
+		return
+	}
+
+	// Script mode: only commands and file changes, as a shell script
+	if p.mode == OutputModeScript {
+		p.scriptMessage(msg)
+		return
+	}
+
+	// JSON mode: output the raw message
 	if p.mode == OutputModeJSON {
 		data, err := json.Marshal(msg)
 		if err != nil {
@@ -97,56 +421,738 @@ func (p *OutputProcessor) processMessage(msg interface{}) {
 		return
 	}
 
-	// Process by type
-	switch m := msg.(type) {
-	case *SystemInit:
-		p.handleSystemInit(m)
-	case *AssistantMessage:
-		p.handleAssistantMessage(m)
-	case *StreamEvent:
-		p.handleStreamEvent(m)
-	case *Result:
-		p.handleResult(m)
-	case *CompactBoundary:
-		// Skip compact boundaries in text mode
+	// Keep the latest turn's text for --answer-only
+	if p.answerOut != nil {
+		p.trackAnswer(msg)
+	}
+
+	// Past --head nothing more renders, but state is still tracked for the summary
+	if p.pastHead() {
+		writer := p.writer
+		p.writer = io.Discard
+		defer func() { p.writer = writer }()
+	}
+
+	// Render only the selected agent's activity; state is still tracked for every agent
+	if !p.agentSelected() {
+		writer := p.writer
+		p.writer = io.Discard
+		defer func() { p.writer = writer }()
+	}
+
+	// The held-back tools of a finished turn go out before anything that follows it
+	if len(p.turnTools) > 0 && !p.sameTurn(msg) {
+		p.flushTurnTools()
+	}
+
+	// Tag the message's output with its position in the input stream (--seq)
+	// and its UUID (--show-uuids) for cross-referencing the raw transcript
+	prefix := ""
+	if p.seqTags {
+		prefix += fmt.Sprintf("%s#%d%s ", p.colors.LabelDim, p.seq, p.colors.Reset)
+	}
+	if uuid := messageUUID(msg); p.showUUIDs && uuid != "" {
+		if !p.fullUUIDs && len(uuid) > 8 {
+			uuid = uuid[:8]
+		}
+		prefix += fmt.Sprintf("%s%s%s ", p.colors.LabelDim, uuid, p.colors.Reset)
+	}
+	if (p.seqTags || p.showUUIDs) && p.writer != io.Discard {
+		// Messages without a tag still go through, so the next one knows where the line is
+		writer := p.writer
+		p.writer = &seqWriter{w: writer, prefix: prefix, midLine: &p.midLine}
+		defer func() { p.writer = writer }()
+	}
+
+	// Process by type
+	switch m := msg.(type) {
+	case *SystemInit:
+		p.handleSystemInit(m)
+	case *AssistantMessage:
+		p.handleAssistantMessage(m)
+	case *StreamEvent:
+		p.handleStreamEvent(m)
+	case *Result:
+		p.handleResult(m)
+	case *HookEvent:
+		p.handleHookEvent(m)
+	case *UserMessage:
+		p.handleUserMessage(m)
+	case *CompactBoundary:
+		// Skip compact boundaries in text mode
+	}
+}
+
+// trackAnswer keeps the text blocks of the main agent's latest turn. Tool results coming
+// back mean the turn that requested them wasn't the last, so they clear it.
+func (p *OutputProcessor) trackAnswer(msg interface{}) {
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		if m.ParentToolUseID != nil && *m.ParentToolUseID != "" {
+			return
+		}
+		if m.Message.ID != p.answerTurn {
+			p.answerTurn = m.Message.ID
+			p.answer = nil
+		}
+		for _, block := range m.Message.Content {
+			if block.Type == ContentBlockTypeText && strings.TrimSpace(block.Text) != "" {
+				p.answer = append(p.answer, block.Text)
+			}
+		}
+	case *UserMessage:
+		if m.ParentToolUseID == nil || *m.ParentToolUseID == "" {
+			p.answerTurn = ""
+			p.answer = nil
+		}
+	case *Result:
+		// The result repeats the final text; use it when no assistant text was seen
+		if len(p.answer) == 0 && strings.TrimSpace(m.Result) != "" {
+			p.answer = []string{m.Result}
+		}
+	}
+}
+
+// printAnswer prints the final turn's text, undecorated, for --answer-only
+func (p *OutputProcessor) printAnswer() {
+	if p.answerOut == nil || len(p.answer) == 0 {
+		return
+	}
+	fmt.Fprintln(p.answerOut, strings.TrimRight(strings.Join(p.answer, "\n\n"), "\n"))
+}
+
+// handleUserMessage renders the tool results claude sends back in user messages. Their other
+// blocks are the prompts claude or a Task sent, which were already shown.
+func (p *OutputProcessor) handleUserMessage(m *UserMessage) {
+	p.markImageResults(m)
+	for i := range m.Message.Content {
+		if m.Message.Content[i].Type == ContentBlockTypeToolResult {
+			p.processContentBlock(&m.Message.Content[i])
+		}
+	}
+}
+
+// markImageResults flags the tool calls whose results the message's tool_use_result marks
+// as images, so they render as an image line instead of their binary content
+func (p *OutputProcessor) markImageResults(m *UserMessage) {
+	if m.ToolUseResult == nil || !m.ToolUseResult.IsImage {
+		return
+	}
+	for _, block := range m.Message.Content {
+		if block.Type != ContentBlockTypeToolResult {
+			continue
+		}
+		if toolCall, ok := p.state.PendingTools[block.ToolUseID]; ok {
+			toolCall.IsImage = true
+		}
+	}
+}
+
+// pastHead reports whether --head events have already been rendered
+func (p *OutputProcessor) pastHead() bool {
+	return p.head > 0 && p.headCount >= p.head
+}
+
+// countHeadEvent counts a rendered assistant turn or tool call towards --head. The event
+// that reaches the limit stops the runner; the summary still covers what ran.
+func (p *OutputProcessor) countHeadEvent() {
+	if p.head == 0 || p.pastHead() {
+		return
+	}
+	p.headCount++
+	if !p.pastHead() {
+		return
+	}
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s[stopped after %d turns and tool calls (--head)]%s\n", c.LabelDim, p.head, c.Reset)
+	if p.stop != nil {
+		// Stop waits for the runner to drain, which needs this goroutine to keep reading
+		go p.stop()
+	}
+}
+
+// messageUUID returns the uuid a message carries, if any.
+// Stream events are unwrapped during parsing, so they have none.
+func messageUUID(msg interface{}) string {
+	switch m := msg.(type) {
+	case *SystemInit:
+		return m.UUID
+	case *HookEvent:
+		return m.UUID
+	case *AssistantMessage:
+		return m.UUID
+	case *UserMessage:
+		return m.UUID
+	case *Result:
+		return m.UUID
+	}
+	return ""
+}
+
+// stampMessage records when the current message is processed, for --timestamps
+func (p *OutputProcessor) stampMessage() {
+	if p.timestamps == "" {
+		return
+	}
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	p.msgTime = now()
+	if p.startTime.IsZero() {
+		p.startTime = p.msgTime
+	}
+}
+
+// printTimestamp starts a block of output with the time its message was processed: [14:03:07],
+// or [+1.2s] from the session start with --timestamps=relative
+func (p *OutputProcessor) printTimestamp() {
+	if p.timestamps == "" || p.mode == OutputModeQuiet || p.msgTime.IsZero() {
+		return
+	}
+	stamp := p.msgTime.Format("15:04:05")
+	if p.timestamps == timestampsRelative {
+		stamp = "+" + formatDurationMS(p.msgTime.Sub(p.startTime).Milliseconds())
+	}
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s[%s]%s ", c.LabelDim, stamp, c.Reset)
+}
+
+// seqWriter writes a sequence tag before the first output of a message, so messages that
+// render nothing stay untagged. Streamed text continues the line an earlier message started,
+// so a message whose output starts partway through a line gets its tag on a line of its own
+// once that line ends, e.g. the uuid of a complete message whose text already streamed.
+type seqWriter struct {
+	w       io.Writer
+	prefix  string
+	tagged  bool
+	midLine *bool // Shared across messages: the last write ended partway through a line
+}
+
+func (s *seqWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return s.w.Write(b)
+	}
+	rest := b
+	if !s.tagged && s.prefix != "" {
+		tag := s.prefix
+		if *s.midLine {
+			i := bytes.IndexByte(b, '\n')
+			if i < 0 {
+				return s.write(b)
+			}
+			if _, err := s.write(b[:i+1]); err != nil {
+				return 0, err
+			}
+			rest = b[i+1:]
+			tag = strings.TrimSuffix(tag, " ") + "\n"
+		}
+		s.tagged = true
+		if _, err := io.WriteString(s.w, tag); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := s.write(rest); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// write writes b untagged, noting whether it ends the line
+func (s *seqWriter) write(b []byte) (int, error) {
+	n, err := s.w.Write(b)
+	if n > 0 {
+		*s.midLine = b[n-1] != '\n'
+	}
+	return n, err
+}
+
+// nestUnderAgent indents output by the depth of the agent that called tc, so a subagent's tool
+// activity reads as a sub-block of its parent. Parallel agents interleave, so the depth comes
+// from the message that made the call rather than whichever agent started last. With
+// --group-by-turn tool activity sits one more level in, under the turn's text. The returned
+// func restores the writer.
+func (p *OutputProcessor) nestUnderAgent(tc *ToolCall) func() {
+	depth := 0
+	if tc.AgentID != "" {
+		// A Task run by a subagent may not have been tracked, but is at least one level in
+		depth = 1
+		if agent, ok := p.state.AgentsByID[tc.AgentID]; ok {
+			depth = agent.Depth
+		}
+	}
+	if p.groupByTurn {
+		depth++
+	}
+	if depth == 0 {
+		return func() {}
+	}
+
+	writer := p.writer
+	p.writer = &indentWriter{w: writer, indent: p.indent(depth)}
+	return func() { p.writer = writer }
+}
+
+// indentWriter prefixes every non-empty line with indent
+type indentWriter struct {
+	w       io.Writer
+	indent  string
+	midLine bool
+}
+
+func (iw *indentWriter) Write(b []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, ch := range b {
+		if !iw.midLine && ch != '\n' {
+			buf.WriteString(iw.indent)
+		}
+		buf.WriteByte(ch)
+		iw.midLine = ch != '\n'
+	}
+	if _, err := iw.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// agentSelected reports whether the current agent's output should render under --only-agent
+func (p *OutputProcessor) agentSelected() bool {
+	if p.onlyAgent == "" {
+		return true
+	}
+	agentType := "main"
+	if p.state.CurrentAgent != nil {
+		agentType = p.state.CurrentAgent.Type
+	}
+	return strings.EqualFold(agentType, p.onlyAgent)
+}
+
+// toolShown reports whether a tool's calls and results render under --only-tools and
+// --hide-tools. A tool in both lists is hidden.
+func (p *OutputProcessor) toolShown(name string) bool {
+	if p.hideTools[name] {
+		return false
+	}
+	return len(p.onlyTools) == 0 || p.onlyTools[name]
+}
+
+// handleSystemInit processes system initialization messages
+func (p *OutputProcessor) handleSystemInit(msg *SystemInit) {
+	p.state.InitializeSession(msg)
+
+	if p.promptLog != nil {
+		if err := p.promptLog.SessionStarted(msg.SessionID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error logging prompt: %v\n", err)
+		}
+	}
+
+	if p.mode == OutputModeQuiet || p.mode == OutputModePlain {
+		return
+	}
+
+	c := p.colors
+	p.printTimestamp()
+	fmt.Fprintf(p.writer, "%s[Session started: %s]%s\n", c.SessionInfo, msg.Model, c.Reset)
+	p.printCompatibility(msg.ClaudeCodeVersion)
+	p.printMCPServers(msg.McpServers)
+	// Show initial agent state
+	p.printAgentContext()
+	p.space(spacingAfterBanner)
+}
+
+// printCompatibility notes in verbose mode when claude is a version ccv wasn't tested with,
+// which explains rendering glitches after a claude upgrade
+func (p *OutputProcessor) printCompatibility(version string) {
+	if p.mode != OutputModeVerbose {
+		return
+	}
+	note, breaking := claudeCompatibility(version)
+	if note == "" {
+		return
+	}
+
+	c := p.colors
+	if breaking {
+		fmt.Fprintf(p.writer, "%s⚠ %s%s\n", c.Warning, note, c.Reset)
+		return
+	}
+	fmt.Fprintf(p.writer, "%s[%s]%s\n", c.LabelDim, note, c.Reset)
+}
+
+// mcpServerUp lists MCP server statuses in which the server's tools are available
+var mcpServerUp = map[string]bool{
+	"running":   true,
+	"connected": true,
+	"pending":   true, // Still connecting
+}
+
+// printMCPServers warns about MCP servers that aren't running, since their tools are
+// missing from the session. Verbose mode lists every server.
+func (p *OutputProcessor) printMCPServers(servers []MCPServer) {
+	c := p.colors
+	for _, server := range servers {
+		if !mcpServerUp[server.Status] {
+			fmt.Fprintf(p.writer, "%s⚠ MCP server '%s' is %s%s\n", c.Warning, server.Name, server.Status, c.Reset)
+		} else if p.mode == OutputModeVerbose {
+			fmt.Fprintf(p.writer, "%s[MCP server '%s': %s]%s\n", c.LabelDim, server.Name, server.Status, c.Reset)
+		}
+	}
+}
+
+// handleHookEvent prints a dim [hook: PreToolUse → blocked] line when --show-hooks is set.
+// Only completed hooks are shown; hook_started carries no outcome yet.
+func (p *OutputProcessor) handleHookEvent(msg *HookEvent) {
+	if !p.showHooks || p.mode == OutputModeQuiet || msg.Subtype == "hook_started" {
+		return
+	}
+
+	name := msg.HookEvent
+	if name == "" {
+		name = msg.HookName
+	}
+	outcome := msg.Decision
+	if outcome == "" {
+		outcome = msg.Outcome
+	}
+
+	c := p.colors
+	if outcome == "" {
+		fmt.Fprintf(p.writer, "%s[hook: %s]%s\n", c.LabelDim, name, c.Reset)
+		return
+	}
+	fmt.Fprintf(p.writer, "%s[hook: %s → %s]%s\n", c.LabelDim, name, outcome, c.Reset)
+}
+
+// modelPrices are list prices in dollars per million tokens, matched in order against the
+// model name. Cache writes cost 1.25x the input price (2x for the 1h tier) and cache reads 0.1x.
+var modelPrices = []struct {
+	match         string
+	input, output float64
+}{
+	{"opus-4-1", 15, 75},
+	{"opus-4-2", 15, 75}, // claude-opus-4-20250514
+	{"3-opus", 15, 75},
+	{"opus", 5, 25},
+	{"sonnet", 3, 15},
+	{"haiku", 1, 5},
+}
+
+// usageCost estimates what usage cost at a model's list price. Models not listed are priced
+// like Sonnet.
+func usageCost(model string, usage *TotalUsage) float64 {
+	if usage == nil {
+		return 0
+	}
+	input, output := 3.0, 15.0
+	for _, price := range modelPrices {
+		if strings.Contains(strings.ToLower(model), price.match) {
+			input, output = price.input, price.output
+			break
+		}
+	}
+
+	cacheWrite := 1.25 * float64(usage.CacheCreationInputTokens)
+	if created := usage.CacheCreation; created != nil {
+		// The breakdown covers the same tokens, with the 1h tier priced higher
+		cacheWrite += 0.75 * float64(created.Ephemeral1hInputTokens)
+	}
+	tokens := float64(usage.InputTokens) + cacheWrite + 0.1*float64(usage.CacheReadInputTokens)
+	return (tokens*input + float64(usage.OutputTokens)*output) / 1e6
+}
+
+// defaultContextWindow is the context window of current Claude models, in tokens
+const defaultContextWindow = 200000
+
+// modelContextWindow returns the context window for a model. Models selected with
+// the [1m] suffix (e.g. claude-sonnet-4-5[1m]) run with the 1M token window.
+func modelContextWindow(model string) int {
+	if strings.HasSuffix(strings.ToLower(model), "[1m]") {
+		return 1000000
+	}
+	return defaultContextWindow
+}
+
+// checkContextWindow warns once per session when the latest request's input
+// crosses the --context-window-warning fraction of the model's context window
+func (p *OutputProcessor) checkContextWindow() {
+	if p.contextWarnAt <= 0 || p.contextWarned || p.mode == OutputModeQuiet {
+		return
+	}
+
+	window := modelContextWindow(p.state.Model)
+	used := p.state.ContextTokens
+	if float64(used) < p.contextWarnAt*float64(window) {
+		return
+	}
+	p.contextWarned = true
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s⚠ approaching context limit (%dk/%dk)%s\n", c.Warning, used/1000, window/1000, c.Reset)
+}
+
+// checkTokenBudget stops the runner once the session's total tokens pass --max-tokens. What
+// is already on its way still renders, and the summary covers it.
+func (p *OutputProcessor) checkTokenBudget() {
+	if p.maxTokens <= 0 || p.tokensExceeded {
+		return
+	}
+	used := p.state.TotalTokens.TotalTokens
+	if used <= p.maxTokens {
+		return
+	}
+	p.tokensExceeded = true
+
+	if p.rawOutput() {
+		// Keep JSON output parseable - the notice goes to stderr there
+		fmt.Fprintf(os.Stderr, "Error: the run has used %d tokens, over --max-tokens %d; stopping claude\n", used, p.maxTokens)
+	} else if p.mode != OutputModeQuiet {
+		c := p.colors
+		fmt.Fprintf(p.writer, "%s[Token budget exceeded: %d/%d]%s\n", c.Warning, used, p.maxTokens, c.Reset)
+	}
+	if p.stop != nil {
+		// Stop waits for the runner to drain, which needs this goroutine to keep reading
+		go p.stop()
+	}
+}
+
+// trackTokens counts tokens for --max-tokens and --max-cost in the formats that don't render
+// messages, where nothing else updates the session's usage
+func (p *OutputProcessor) trackTokens(msg interface{}) {
+	if (p.maxTokens <= 0 && p.maxCost <= 0) || !p.rawOutput() {
+		return
+	}
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		p.state.RecordUsage(m.Message.ID, m.AgentID(), m.Message.Usage)
+	case *StreamEvent:
+		switch m.Type {
+		case StreamEventMessageStart:
+			// message_delta doesn't carry the message ID, so remember it from here
+			if m.Message != nil {
+				p.streamMessageID = m.Message.ID
+			}
+			return
+		case StreamEventMessageDelta:
+			p.state.RecordUsage(p.streamMessageID, "", m.Usage)
+		default:
+			return
+		}
+	default:
+		return
+	}
+	p.checkTokenBudget()
+	p.checkCostBudget()
+}
+
+// handleAssistantMessage processes complete assistant messages
+func (p *OutputProcessor) handleAssistantMessage(msg *AssistantMessage) {
+	// Update tokens
+	if msg.Message.Usage != nil {
+		p.state.RecordUsage(msg.Message.ID, msg.AgentID(), msg.Message.Usage)
+		p.checkContextWindow()
+		p.checkTokenBudget()
+		p.checkCostBudget()
+	}
+
+	// Clear streaming state
+	p.state.ClearStreamState()
+
+	if p.groupByTurn {
+		p.turnID = msg.Message.ID
+	}
+
+	// Text is only merged within a turn
+	if msg.Message.ID != p.textTurn {
+		p.closeText()
+		p.textTurn = msg.Message.ID
+	}
+
+	// Thinking deferred from an earlier turn goes out before this turn starts
+	if msg.Message.ID != p.deferredTurn {
+		p.flushDeferredThinking()
+		p.deferredTurn = msg.Message.ID
+	}
+
+	// Process content blocks
+	hasText := false
+	for _, block := range msg.Message.Content {
+		if tc, ok := p.state.PendingTools[block.ID]; ok && block.Type == ContentBlockTypeToolUse {
+			tc.AgentID = msg.AgentID()
+		}
+		p.processContentBlock(&block)
+		if block.Type == ContentBlockTypeText && strings.TrimSpace(block.Text) != "" {
+			hasText = true
+		}
+	}
+
+	// The turn's answer is out, so its reasoning can follow
+	if hasText {
+		p.flushDeferredThinking()
+	}
+
+	if msg.Message.StopReason == "stop_sequence" {
+		p.noteStopSequence(msg.Message.ID, msg.Message.StopSequence)
+	}
+
+	// Without partial messages there is no message_delta, so the complete message's usage is all there is
+	if msg.Message.Usage != nil && p.streamMessageID == "" {
+		p.printTurnTokens(msg.Message.ID)
+	}
+	p.printMessageCost(msg)
+
+	// A background agent's last message is the end of its task
+	if msg.ParentToolUseID != nil && msg.Message.StopReason == "end_turn" {
+		p.finishBackgroundTask(*msg.ParentToolUseID)
+	}
+}
+
+// trackCost keeps a running total of the cost claude reports on assistant messages, for
+// --max-cost. A message repeated with the same ID replaces its earlier cost instead of adding
+// to it. claude rarely reports it, so checkCostBudget also estimates the cost from usage.
+func (p *OutputProcessor) trackCost(msg interface{}) {
+	m, ok := msg.(*AssistantMessage)
+	if p.maxCost <= 0 || !ok || m.CostUSD <= 0 {
+		return
+	}
+	if p.messageCosts == nil {
+		p.messageCosts = make(map[string]float64)
+	}
+	p.spent += m.CostUSD - p.messageCosts[m.Message.ID]
+	p.messageCosts[m.Message.ID] = m.CostUSD
+	p.checkCostBudget()
+}
+
+// checkCostBudget stops the runner once the session has cost more than --max-cost: the cost
+// claude reported, or the cost of the tokens used so far at the model's list price if that is
+// more. The result's total arrives once the run is over, so it isn't checked.
+func (p *OutputProcessor) checkCostBudget() {
+	if p.maxCost <= 0 || p.costExceeded {
+		return
+	}
+	spent := max(p.spent, usageCost(p.state.Model, p.state.TotalTokens))
+	if spent <= p.maxCost {
+		return
+	}
+	p.costExceeded = true
+	fmt.Fprintf(os.Stderr, "Error: the run has cost about $%.4f, over --max-cost $%.4f; stopping claude\n", spent, p.maxCost)
+	if p.stop != nil {
+		// Stop waits for the runner to drain, which needs this goroutine to keep reading
+		go p.stop()
+	}
+}
+
+// printMessageCost prints what a single assistant message cost and how long it took, for
+// --per-message-cost and verbose mode. Messages without either are skipped.
+func (p *OutputProcessor) printMessageCost(msg *AssistantMessage) {
+	if !p.perMessageCost && p.mode != OutputModeVerbose {
+		return
+	}
+	if p.mode == OutputModeQuiet || (msg.CostUSD <= 0 && msg.DurationMS <= 0) {
+		return
+	}
+
+	var parts []string
+	if msg.CostUSD > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f", msg.CostUSD))
+	}
+	if msg.DurationMS > 0 {
+		parts = append(parts, formatDurationMS(msg.DurationMS))
+	}
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s(%s)%s\n", c.LabelDim, strings.Join(parts, ", "), c.Reset)
+}
+
+// printTurnTokens prints the tokens a turn's message used, for --per-turn-tokens. Its usage is
+// repeated on each content block and only complete in message_delta, so each message prints once.
+func (p *OutputProcessor) printTurnTokens(messageID string) {
+	if !p.perTurnTokens || p.mode == OutputModeQuiet || messageID == "" || messageID == p.turnTokensID {
+		return
+	}
+	usage, ok := p.state.MessageUsage(messageID)
+	if !ok || (usage.InputTokens == 0 && usage.OutputTokens == 0) {
+		return
+	}
+	p.turnTokensID = messageID
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s[+%s in, %s out]%s\n", c.LabelDim, formatCount(usage.InputTokens), formatCount(usage.OutputTokens), c.Reset)
+}
+
+// noteStopSequence prints a dim note when generation halted on a custom stop sequence.
+// The stop reason can arrive both streamed and on the complete message, so each message is noted once.
+func (p *OutputProcessor) noteStopSequence(messageID, sequence string) {
+	if p.mode == OutputModeQuiet || (messageID != "" && messageID == p.stopNotedID) {
+		return
+	}
+	p.stopNotedID = messageID
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s[stopped at sequence: %s]%s\n", c.LabelDim, strconv.Quote(sequence), c.Reset)
+}
+
+// thinkingOutput returns where thinking content is written and the colors and glyphs to use
+// there. A --thinking-out sidecar gets plain text with the default labels, since it is usually a file.
+func (p *OutputProcessor) thinkingOutput() (io.Writer, *ColorScheme, *Glyphs) {
+	if p.thinkingWriter != nil {
+		return p.thinkingWriter, NoColorScheme(), DefaultGlyphs()
 	}
+	return p.writer, p.colors, p.glyphSet()
 }
 
-// handleSystemInit processes system initialization messages
-func (p *OutputProcessor) handleSystemInit(msg *SystemInit) {
-	p.state.InitializeSession(msg)
+// spaceAfterThinking adds the spacing after a thinking block, unless thinking went to a sidecar
+func (p *OutputProcessor) spaceAfterThinking() {
+	if p.thinkingWriter == nil {
+		p.space(spacingAfterThinking)
+	}
+}
 
-	if p.mode == OutputModeQuiet {
+// gistThinking reports whether thinking is reduced to a one-line gist. Verbose mode keeps it whole.
+func (p *OutputProcessor) gistThinking() bool {
+	return p.thinkingGist && p.mode != OutputModeVerbose
+}
+
+// printThinkingGist prints the first sentence of a complete thinking block. A --thinking-out
+// sidecar still gets the whole block.
+func (p *OutputProcessor) printThinkingGist(thinking string) {
+	if p.mode == OutputModeQuiet || strings.TrimSpace(thinking) == "" {
 		return
 	}
+	if p.thinkingWriter != nil {
+		fmt.Fprintf(p.thinkingWriter, "[THINKING] %s\n", thinking)
+	}
 
 	c := p.colors
-	fmt.Fprintf(p.writer, "%s[Session started: %s]%s\n", c.SessionInfo, msg.Model, c.Reset)
-	// Show initial agent state
-	p.printAgentContext()
-	// Add spacing after session info
-	fmt.Fprintln(p.writer)
+	g := p.glyphSet()
+	fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ThinkingPrefix, g.Gist, c.Reset, c.ThinkingText, thinkingGist(thinking), c.Reset)
+	p.space(spacingAfterThinking)
 }
 
-// handleAssistantMessage processes complete assistant messages
-func (p *OutputProcessor) handleAssistantMessage(msg *AssistantMessage) {
-	// Update tokens
-	if msg.Message.Usage != nil {
-		p.state.UpdateTokens(msg.Message.Usage)
+// flushDeferredThinking prints thinking held back by --thinking-last under a [reasoning] footer
+func (p *OutputProcessor) flushDeferredThinking() {
+	if len(p.deferred) == 0 {
+		return
 	}
 
-	// Clear streaming state
-	p.state.ClearStreamState()
-
-	// Process content blocks
-	for _, block := range msg.Message.Content {
-		p.processContentBlock(&block)
+	w, c, _ := p.thinkingOutput()
+	fmt.Fprintf(w, "%s[reasoning]%s\n", c.ThinkingPrefix, c.Reset)
+	for _, thinking := range p.deferred {
+		fmt.Fprintf(w, "%s%s%s\n", c.ThinkingText, thinking, c.Reset)
 	}
+	p.spaceAfterThinking()
+	p.deferred = nil
 }
 
 // handleStreamEvent processes streaming events
 func (p *OutputProcessor) handleStreamEvent(event *StreamEvent) {
 	switch event.Type {
+	case StreamEventMessageStart:
+		p.closeText()
+		if event.Message != nil {
+			p.streamMessageID = event.Message.ID
+		}
+
 	case StreamEventContentBlockStart:
 		p.handleContentBlockStart(event)
 
@@ -155,16 +1161,38 @@ func (p *OutputProcessor) handleStreamEvent(event *StreamEvent) {
 
 	case StreamEventContentBlockStop:
 		// Content block finished streaming
+		p.flushStreamText()
 		// Reset colors after thinking blocks
-		if p.state.Stream.PartialThinking != "" {
-			fmt.Fprint(p.writer, p.colors.Reset)
-			fmt.Fprintln(p.writer)
+		if p.state.Stream.PartialThinking != "" && p.gistThinking() {
+			p.printThinkingGist(p.state.Stream.PartialThinking)
+			p.streamedThinking = true
+		} else if p.state.Stream.PartialThinking != "" && !p.thinkingLast && !p.noStream {
+			// Thinking held back for the complete message has no streamed line to close
+			w, c, g := p.thinkingOutput()
+			// Cleaned thinking is held back until complete, since tags can span deltas
+			if p.cleanThinking && p.mode != OutputModeQuiet {
+				fmt.Fprintf(w, "%s%s%s%s%s", c.ThinkingPrefix, g.Thinking, c.Reset, c.ThinkingText, cleanThinkingText(p.state.Stream.PartialThinking))
+			}
+			fmt.Fprint(w, c.Reset)
+			fmt.Fprintln(w)
+			p.streamedThinking = true
 		}
+		// The thinking block is done, so the blocks that stop after it aren't closed again
+		p.state.Stream.PartialThinking = ""
 
 	case StreamEventMessageDelta:
 		// Update usage if provided
 		if event.Usage != nil {
-			p.state.UpdateTokens(event.Usage)
+			p.state.RecordUsage(p.streamMessageID, "", event.Usage)
+			p.checkContextWindow()
+			p.checkTokenBudget()
+			p.checkCostBudget()
+		}
+		if event.Delta != nil && event.Delta.StopReason == "stop_sequence" {
+			p.noteStopSequence(p.streamMessageID, event.Delta.StopSequence)
+		}
+		if event.Usage != nil {
+			p.printTurnTokens(p.streamMessageID)
 		}
 
 	case StreamEventMessageStop:
@@ -179,25 +1207,25 @@ func (p *OutputProcessor) handleContentBlockStart(event *StreamEvent) {
 	}
 
 	block := event.ContentBlock
+	if block.Type != ContentBlockTypeText {
+		p.closeText()
+	}
 
 	// Handle tool_use blocks
 	if block.Type == ContentBlockTypeToolUse {
 		toolCall := &ToolCall{
-			ID:     block.ID,
-			Name:   block.Name,
-			Input:  block.Input,
-			Status: ToolCallStatusPending,
+			ID:        block.ID,
+			Name:      block.Name,
+			Input:     block.Input,
+			Status:    ToolCallStatusPending,
+			StartTime: time.Now().UnixMilli(),
 		}
 		p.state.AddOrUpdateToolCall(toolCall)
 
 		// If this is a Task tool call, it spawns a child agent
 		if block.Name == "Task" {
 			// Parse input to extract subagent_type and description
-			var inputMap map[string]interface{}
-			if len(block.Input) > 0 {
-				// Ignore error - continue with empty map on failure (graceful degradation)
-				_ = json.Unmarshal(block.Input, &inputMap)
-			}
+			inputMap := toolCall.InputMap()
 
 			agentType := "task"
 			if subtype, ok := inputMap["subagent_type"].(string); ok {
@@ -227,23 +1255,32 @@ func (p *OutputProcessor) handleContentBlockDelta(event *StreamEvent) {
 	delta := event.Delta
 
 	// Stream text content
-	if delta.Text != "" {
+	if delta.Text != "" && p.noStream {
+		p.state.AppendStreamText(delta.Text)
+	} else if delta.Text != "" {
+		p.flushReads()
 		p.state.AppendStreamText(delta.Text)
+		p.streamedText = true
+		p.textShown = true
+		// A new text block starts with its timestamp, unless it continues merged text
+		if p.state.Stream.PartialText == delta.Text && !p.textOpen {
+			p.printTimestamp()
+		}
 		// Output text in real-time
-		fmt.Fprint(p.writer, delta.Text)
+		p.writeStreamText(delta.Text)
 	}
 
 	// Stream thinking content
 	if delta.Thinking != "" {
 		p.state.AppendStreamThinking(delta.Thinking)
 
-		if p.mode != OutputModeQuiet {
-			c := p.colors
+		if p.mode != OutputModeQuiet && !p.thinkingLast && !p.cleanThinking && !p.noStream && !p.gistThinking() {
+			w, c, g := p.thinkingOutput()
 			// First thinking chunk - print prefix
 			if p.state.Stream.PartialThinking == delta.Thinking {
-				fmt.Fprintf(p.writer, "%s[THINKING]%s %s", c.ThinkingPrefix, c.Reset, c.ThinkingText)
+				fmt.Fprintf(w, "%s%s%s%s", c.ThinkingPrefix, g.Thinking, c.Reset, c.ThinkingText)
 			}
-			fmt.Fprint(p.writer, delta.Thinking)
+			fmt.Fprint(w, delta.Thinking)
 		}
 	}
 
@@ -254,37 +1291,132 @@ func (p *OutputProcessor) handleContentBlockDelta(event *StreamEvent) {
 	}
 }
 
+// writeStreamText writes streamed assistant text. When highlighting, text is held
+// back until a full line is available so matches spanning deltas aren't missed.
+func (p *OutputProcessor) writeStreamText(text string) {
+	if p.highlighter == nil {
+		fmt.Fprint(p.writer, text)
+		return
+	}
+
+	p.pendingLine += text
+	if idx := strings.LastIndex(p.pendingLine, "\n"); idx >= 0 {
+		fmt.Fprint(p.writer, p.highlight(p.pendingLine[:idx+1]))
+		p.pendingLine = p.pendingLine[idx+1:]
+	}
+}
+
+// flushStreamText writes any streamed text still held back for highlighting
+func (p *OutputProcessor) flushStreamText() {
+	if p.pendingLine == "" {
+		return
+	}
+	fmt.Fprint(p.writer, p.highlight(p.pendingLine))
+	p.pendingLine = ""
+}
+
+// closeText adds the spacing held back after text by --merge-text. Anything other than
+// more text from the same turn ends the run of merged text blocks.
+func (p *OutputProcessor) closeText() {
+	if !p.textOpen {
+		return
+	}
+	p.textOpen = false
+	p.space(spacingAfterText)
+}
+
+// highlight wraps --highlight matches in the highlight color
+func (p *OutputProcessor) highlight(text string) string {
+	return HighlightMatches(text, p.highlighter, p.colors)
+}
+
+// resultLine formats a line of a tool result body. With --dim-results the line's own
+// colors are dropped and it is shown dim, with highlighted terms still standing out.
+func (p *OutputProcessor) resultLine(line string) string {
+	c := p.colors
+	if !p.dimResults || c.LabelDim == "" {
+		return p.highlight(line)
+	}
+	line = p.highlight(ansiPattern.ReplaceAllString(line, ""))
+	return c.LabelDim + strings.ReplaceAll(line, c.Reset, c.Reset+c.LabelDim) + c.Reset
+}
+
 // processContentBlock processes a complete content block
 func (p *OutputProcessor) processContentBlock(block *ContentBlock) {
+	// --head can be reached partway through a message; its remaining blocks don't render
+	if p.pastHead() {
+		writer := p.writer
+		p.writer = io.Discard
+		defer func() { p.writer = writer }()
+	}
+
 	switch block.Type {
 	case ContentBlockTypeText:
-		// Text already streamed, just ensure newline and spacing
-		if block.Text != "" && p.mode != OutputModeQuiet {
+		if strings.TrimSpace(block.Text) != "" {
+			p.flushReads()
+		}
+		p.flushStreamText()
+		// Without partial messages nothing streams, so the complete block is the only copy
+		if !p.streamedText && strings.TrimSpace(block.Text) != "" {
+			if !p.textOpen {
+				p.printTimestamp()
+			}
+			fmt.Fprint(p.writer, p.highlight(strings.TrimRight(block.Text, "\n")))
+			p.textShown = true
+		}
+		// Text already streamed, just ensure newline and spacing.
+		// Blank text blocks (common in tool-only turns) get no spacing at all
+		if strings.TrimSpace(block.Text) != "" && p.mode != OutputModeQuiet {
 			fmt.Fprintln(p.writer)
-			fmt.Fprintln(p.writer) // Add extra blank line after text blocks
+			if p.mergeText {
+				p.textOpen = true
+			} else {
+				p.space(spacingAfterText)
+			}
+			p.countHeadEvent()
 		}
 
 	case ContentBlockTypeThinking:
-		if p.mode != OutputModeQuiet {
-			c := p.colors
-			fmt.Fprintf(p.writer, "%s[THINKING]%s %s%s%s\n", c.ThinkingPrefix, c.Reset, c.ThinkingText, block.Thinking, c.Reset)
-			fmt.Fprintln(p.writer) // Add spacing after thinking blocks
+		p.closeText()
+		if strings.TrimSpace(block.Thinking) != "" && p.mode != OutputModeQuiet {
+			thinking := block.Thinking
+			if p.cleanThinking {
+				thinking = cleanThinkingText(thinking)
+			}
+			if p.gistThinking() {
+				if !p.streamedThinking {
+					p.printThinkingGist(thinking)
+				}
+				return
+			}
+			if p.thinkingLast {
+				p.deferred = append(p.deferred, thinking)
+				return
+			}
+			if p.streamedThinking {
+				// Already written as it streamed
+				p.spaceAfterThinking()
+				return
+			}
+			w, c, g := p.thinkingOutput()
+			fmt.Fprintf(w, "%s%s%s%s%s%s\n", c.ThinkingPrefix, g.Thinking, c.Reset, c.ThinkingText, thinking, c.Reset)
+			p.spaceAfterThinking()
 		}
 
 	case ContentBlockTypeToolUse:
+		p.closeText()
 		// Print tool use now that we have complete input
 		if p.mode != OutputModeQuiet {
 			// Update the tool call with complete input
 			if tc, ok := p.state.PendingTools[block.ID]; ok {
 				tc.Input = block.Input
 
-				// If this is a Task tool, switch to child agent and show context
-				if tc.Name == "Task" {
-					p.state.SetCurrentAgent(block.ID)
-					p.printAgentContext()
+				// --group-by-turn holds tools back until the turn's text is out
+				if p.groupByTurn {
+					p.turnTools = append(p.turnTools, tc)
+					return
 				}
-
-				p.printToolCall(tc)
+				p.renderToolUse(tc)
 			}
 		}
 
@@ -293,6 +1425,126 @@ func (p *OutputProcessor) processContentBlock(block *ContentBlock) {
 	}
 }
 
+// renderToolUse prints a tool call whose input is complete, followed by its result if
+// that arrived first
+func (p *OutputProcessor) renderToolUse(tc *ToolCall) {
+	// Consecutive reads are batched into one line; anything else ends the batch
+	if p.collapseReads && tc.Name == "Read" && !p.confirmTools[tc.Name] && p.toolShown(tc.Name) {
+		p.pendingReads = append(p.pendingReads, tc)
+		if p.collapsedReads == nil {
+			p.collapsedReads = make(map[string]bool)
+		}
+		p.collapsedReads[tc.ID] = true
+		if orphan, ok := p.state.TakeOrphanResult(tc.ID); ok {
+			p.processToolResult(orphan)
+		}
+		return
+	}
+	p.flushReads()
+
+	// If this is a Task tool, switch to child agent and show context
+	if tc.Name == "Task" {
+		p.state.SetCurrentAgent(tc.ID)
+		p.printAgentContext()
+		if background, _ := tc.InputMap()["run_in_background"].(bool); background {
+			p.state.StartBackgroundTask(tc.ID)
+		}
+	}
+
+	// --only-tools and --hide-tools leave the call out of the output; it is still tracked
+	if p.toolShown(tc.Name) {
+		restore := p.nestUnderAgent(tc)
+		p.printTimestamp()
+		if p.confirmTools[tc.Name] {
+			p.printConfirmWarning(tc)
+		}
+		p.printToolCall(tc)
+		if p.copyable {
+			p.printCopyable(tc)
+		}
+		if tc.Name == "Task" && p.state.BackgroundTasks[tc.ID] {
+			p.printBackgroundTasks(len(p.state.BackgroundTasks))
+		}
+		restore()
+		p.countHeadEvent()
+	} else {
+		p.trackFile(tc)
+	}
+
+	// Render a result that arrived before this tool_use
+	if orphan, ok := p.state.TakeOrphanResult(tc.ID); ok {
+		p.processToolResult(orphan)
+	}
+}
+
+// flushTurnTools prints the tool calls --group-by-turn held back, as a block indented
+// under the turn's text
+func (p *OutputProcessor) flushTurnTools() {
+	tools := p.turnTools
+	p.turnTools = nil
+	p.turnID = ""
+
+	for _, tc := range tools {
+		p.renderToolUse(tc)
+	}
+}
+
+// sameTurn reports whether msg continues the turn whose tools --group-by-turn is holding.
+// Stream events don't render in this mode, so only another turn or a message ends it.
+func (p *OutputProcessor) sameTurn(msg interface{}) bool {
+	switch m := msg.(type) {
+	case *StreamEvent:
+		return true
+	case *AssistantMessage:
+		return m.Message.ID == p.turnID
+	}
+	return false
+}
+
+// flushReads prints the Read calls batched by --collapse-reads as one line listing their files
+func (p *OutputProcessor) flushReads() {
+	if len(p.pendingReads) == 0 {
+		return
+	}
+	reads := p.pendingReads
+	p.pendingReads = nil
+
+	defer p.nestUnderAgent(reads[0])()
+
+	// A lone read renders as usual
+	if len(reads) == 1 {
+		p.printToolCall(reads[0])
+	} else {
+		for _, tc := range reads {
+			p.trackFile(tc)
+		}
+
+		names := make([]string, 0, maxCollapsedReadNames+1)
+		for i, tc := range reads {
+			if i == maxCollapsedReadNames {
+				names = append(names, "…")
+				break
+			}
+			path, _ := tc.InputMap()["file_path"].(string)
+			names = append(names, filepath.Base(path))
+		}
+
+		c := p.colors
+		g := p.glyphSet()
+		p.printTimestamp()
+		fmt.Fprintf(p.writer, "%s%s%s%sRead%s: %d files %s(%s)%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, c.Reset, len(reads), c.FilePath, strings.Join(names, ", "), c.Reset)
+	}
+
+	if p.copyable {
+		for _, tc := range reads {
+			p.printCopyable(tc)
+		}
+	}
+}
+
+// maxCollapsedReadNames caps the file names listed on a collapsed read line
+const maxCollapsedReadNames = 5
+
 // toolResultHandler handles the output for a specific tool result type
 type toolResultHandler func(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock)
 
@@ -300,14 +1552,45 @@ type toolResultHandler func(p *OutputProcessor, toolCall *ToolCall, block *Conte
 var toolResultHandlers = map[string]toolResultHandler{
 	"Bash":       handleBashResult,
 	"Glob":       handleGlobResult,
+	"Read":       handleReadResult,
 	"Grep":       handleGrepResult,
 	"WebSearch":  handleWebSearchResult,
 	"KillShell":  handleKillShellResult,
 	"TaskOutput": handleTaskOutputResult,
 }
 
+// flushOrphanResults prints results whose tool_use never arrived so nothing is lost
+func (p *OutputProcessor) flushOrphanResults() {
+	if p.mode == OutputModeQuiet || len(p.state.OrphanResults) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(p.state.OrphanResults))
+	for id := range p.state.OrphanResults {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	c := p.colors
+	for _, id := range ids {
+		block, _ := p.state.TakeOrphanResult(id)
+		fmt.Fprintf(p.writer, "%s[orphan result]%s %s\n", c.LabelDim, c.Reset, id)
+		for _, line := range strings.Split(strings.TrimRight(block.Content, "\n"), "\n") {
+			fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), line)
+		}
+	}
+}
+
 // processToolResult processes a tool result
 func (p *OutputProcessor) processToolResult(block *ContentBlock) {
+	// Stray carriage returns from Windows tools would corrupt the terminal. Invalid UTF-8
+	// never gets this far: JSON decoding already replaced it with �.
+	if strings.Contains(block.Content, "\r") {
+		normalized := *block
+		normalized.Content = normalizeLineEndings(block.Content)
+		block = &normalized
+	}
+
 	p.state.CompleteToolCall(block.ToolUseID, block.Content, block.IsError)
 
 	if p.mode == OutputModeQuiet {
@@ -317,15 +1600,34 @@ func (p *OutputProcessor) processToolResult(block *ContentBlock) {
 	// Find the tool call to get its name
 	toolCall, ok := p.state.PendingTools[block.ToolUseID]
 	if !ok {
+		// Hold the result until its tool_use shows up
+		p.state.AddOrphanResult(block)
 		return
 	}
 
+	// Collapsed reads only surface their result when it is an error
+	if p.collapsedReads[block.ToolUseID] {
+		delete(p.collapsedReads, block.ToolUseID)
+		if !block.IsError {
+			return
+		}
+		p.flushReads()
+	}
+
 	// If this is a Task tool result, switch back to parent agent
 	if toolCall.Name == "Task" {
 		// Find the child agent
 		if childAgent, ok := p.state.AgentsByID[block.ToolUseID]; ok {
-			// Mark child as completed
-			childAgent.Status = AgentStatusCompleted
+			// A background Task's result only acknowledges the launch; the agent keeps running
+			background := p.state.BackgroundTasks[childAgent.ID] && !block.IsError
+
+			// Mark child as completed, or failed when the Task result is an error
+			if !background {
+				childAgent.Status = AgentStatusCompleted
+				if block.IsError {
+					childAgent.Status = AgentStatusFailed
+				}
+			}
 
 			// Switch back to parent
 			if childAgent.ParentID != "" {
@@ -334,42 +1636,273 @@ func (p *OutputProcessor) processToolResult(block *ContentBlock) {
 					p.printAgentContext()
 				}
 			}
+			if !background {
+				if childAgent.Status == AgentStatusFailed {
+					p.printAgentFailed(childAgent)
+				}
+				p.printAgentTokens(childAgent)
+				if running, ok := p.state.FinishBackgroundTask(childAgent.ID); ok {
+					p.printBackgroundTasks(running)
+				}
+			}
+		}
+	}
+
+	// A blocking TaskOutput returns once the background task it waits on is done
+	if toolCall.Name == "TaskOutput" && !block.IsError {
+		input := toolCall.InputMap()
+		nonBlocking := input["block"] == false || input["block"] == "false"
+		if taskID, _ := input["task_id"].(string); taskID != "" && !nonBlocking {
+			p.finishBackgroundTask(taskID)
 		}
 	}
 
+	if !p.toolShown(toolCall.Name) {
+		return
+	}
+
+	// Images get a line of their own whatever the result filters, also when only the message's
+	// tool_use_result says the result is one
+	if desc, text, ok := imageResult(block); ok || toolCall.IsImage {
+		defer p.nestUnderAgent(toolCall)()
+		defer p.printSlowMarker(toolCall)
+		p.printTimestamp()
+		p.printImageResult(block, desc, text)
+		return
+	}
+
+	if !p.resultWorthShowing(block) {
+		return
+	}
+
+	// Results render at the depth of the agent that ran the tool
+	defer p.nestUnderAgent(toolCall)()
+	defer p.printSlowMarker(toolCall)
+	p.printTimestamp()
+
+	// Folded results show a one-line summary; verbose mode still shows everything
+	if p.foldResults && p.mode != OutputModeVerbose {
+		p.printFoldedResult(toolCall, block)
+		return
+	}
+
 	// Dispatch to tool-specific handler if available
 	if handler, exists := toolResultHandlers[toolCall.Name]; exists {
 		handler(p, toolCall, block)
 		return
 	}
 
-	// Default handling for other tools (including Read/Write)
+	// Default handling for other tools (including Write)
 	// Note: tool_result blocks are not streamed by claude CLI, so this
 	// is mainly for any future tools that do expose results
 	handleDefaultResult(p, toolCall, block)
 }
 
+// defaultSlowToolThreshold is how long a tool runs before --slow-tool-threshold flags it
+const defaultSlowToolThreshold = 30 * time.Second
+
+// printSlowMarker follows a tool's result with a warning when the tool ran longer than
+// the slow threshold, e.g. a hung Bash command or a slow web fetch
+func (p *OutputProcessor) printSlowMarker(toolCall *ToolCall) {
+	elapsed := toolCall.Elapsed()
+	if p.slowToolThreshold <= 0 || elapsed <= p.slowToolThreshold {
+		return
+	}
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s%s⚠ slow (%s)%s\n", p.indent(1), c.Warning, elapsed.Round(time.Second), c.Reset)
+}
+
+// printAgentFailed marks a subagent whose Task ended in an error, e.g. ✗ [Explore] failed
+func (p *OutputProcessor) printAgentFailed(agent *AgentState) {
+	c := p.colors
+	g := p.glyphSet()
+	fmt.Fprintf(p.writer, "%s%s%s[%s] failed%s\n", p.indent(agent.Depth-1), c.Error, g.Failure, agent.Type, c.Reset)
+}
+
+// finishBackgroundTask marks a background Task agent completed once its work is done: its
+// final message arrives or a TaskOutput waiting on it returns. Tasks not running in the
+// background are left alone.
+func (p *OutputProcessor) finishBackgroundTask(id string) {
+	running, ok := p.state.FinishBackgroundTask(id)
+	if !ok {
+		return
+	}
+	agent := p.state.AgentsByID[id]
+	if agent != nil {
+		agent.Status = AgentStatusCompleted
+	}
+	if p.mode == OutputModeQuiet {
+		return
+	}
+	if agent != nil {
+		p.printAgentTokens(agent)
+	}
+	p.printBackgroundTasks(running)
+}
+
+// printBackgroundTasks shows how many background Task agents are running, e.g. [2 background tasks running]
+func (p *OutputProcessor) printBackgroundTasks(running int) {
+	c := p.colors
+	label := fmt.Sprintf("%d background tasks running", running)
+	switch running {
+	case 0:
+		label = "no background tasks running"
+	case 1:
+		label = "1 background task running"
+	}
+	fmt.Fprintf(p.writer, "%s%s[%s]%s\n", p.indent(1), c.LabelDim, label, c.Reset)
+}
+
+// printAgentTokens shows how many tokens a finished subagent used, e.g. [Explore] used ~4,200 tokens.
+// The count covers the usage of the messages the agent sent.
+func (p *OutputProcessor) printAgentTokens(agent *AgentState) {
+	if agent.Tokens == 0 {
+		return
+	}
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s%s[%s] used ~%s tokens%s\n", p.indent(agent.Depth-1), c.LabelDim, agent.Type, formatCount(agent.Tokens), c.Reset)
+}
+
+// resultWorthShowing decides whether a tool result renders at all. Successful results with
+// no content only confirm the call happened, so --no-result-on-empty and folded results skip them.
+func (p *OutputProcessor) resultWorthShowing(block *ContentBlock) bool {
+	if block.IsError || strings.TrimSpace(block.Content) != "" {
+		return true
+	}
+	return !p.noEmptyResults && !(p.foldResults && p.mode != OutputModeVerbose)
+}
+
+// imageContent is an image block of array-form tool result content. Dimensions aren't part of
+// the API's image blocks, but some tools add them to the block or its source. Text blocks
+// sent alongside the image decode into the same struct.
+type imageContent struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Source struct {
+		MediaType string `json:"media_type"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+	} `json:"source"`
+}
+
+// imageResult reports whether a tool result holds an image and describes the first one from
+// whatever metadata it has, e.g. "png, 1280×720". desc is empty when there is none. text
+// gathers the text blocks that came with the image, such as a screenshot tool's caption.
+func imageResult(block *ContentBlock) (desc, text string, ok bool) {
+	if len(block.RawContent) == 0 {
+		return "", "", false
+	}
+	var blocks []imageContent
+	if err := json.Unmarshal(block.RawContent, &blocks); err != nil {
+		var single imageContent
+		if err := json.Unmarshal(block.RawContent, &single); err != nil {
+			return "", "", false
+		}
+		blocks = []imageContent{single}
+	}
+
+	var texts []string
+	for _, part := range blocks {
+		switch {
+		case part.Type == "text" && strings.TrimSpace(part.Text) != "":
+			texts = append(texts, part.Text)
+		case part.Type == "image" && !ok:
+			var parts []string
+			if format := strings.TrimPrefix(part.Source.MediaType, "image/"); format != "" {
+				parts = append(parts, format)
+			}
+			width, height := max(part.Width, part.Source.Width), max(part.Height, part.Source.Height)
+			if width > 0 && height > 0 {
+				parts = append(parts, fmt.Sprintf("%d×%d", width, height))
+			}
+			desc, ok = strings.Join(parts, ", "), true
+		}
+	}
+	return desc, strings.Join(texts, "\n"), ok
+}
+
+// printImageResult prints an image result as one line, e.g. "✓ image captured [png, 1280×720]",
+// in place of its base64 data, followed by any text that came with it
+func (p *OutputProcessor) printImageResult(block *ContentBlock, desc, text string) {
+	c := p.colors
+	g := p.glyphSet()
+	statusColor := c.Success
+	status := g.Success
+	if block.IsError {
+		statusColor = c.Error
+		status = g.Failure
+	}
+	if desc == "" {
+		desc = "image"
+	}
+	fmt.Fprintf(p.writer, "%s%s%s%simage captured %s[%s]%s\n", p.indent(1), statusColor, status, c.Reset, c.LabelDim, desc, c.Reset)
+
+	for _, line := range strings.Split(text, "\n") {
+		if line != "" {
+			fmt.Fprintf(p.writer, "%s%s\n", p.indent(2), p.resultLine(line))
+		}
+	}
+}
+
+// printFoldedResult prints a one-line summary of a tool result instead of its content
+func (p *OutputProcessor) printFoldedResult(toolCall *ToolCall, block *ContentBlock) {
+	c := p.colors
+	g := p.glyphSet()
+	statusColor := c.Success
+	status := g.Success
+	if block.IsError {
+		statusColor = c.Error
+		status = g.Failure
+	}
+
+	summary := "no output"
+	if content := strings.TrimRight(block.Content, "\n"); content != "" {
+		lineCount := strings.Count(content, "\n") + 1
+		if lineCount == 1 {
+			summary = fmt.Sprintf("1 line of output, %d bytes (hidden)", len(content))
+		} else {
+			summary = fmt.Sprintf("%d lines of output (hidden)", lineCount)
+		}
+	}
+
+	fmt.Fprintf(p.writer, "%s%s%s%s%s: %s%s%s\n", p.indent(1), statusColor, status, c.Reset, p.toolDisplayName(toolCall.Name), c.LabelDim, summary, c.Reset)
+}
+
+// toolDisplayName returns the name a tool is shown under: MCP names are shortened, and
+// with --normalize-tool-names every name gets consistent casing
+func (p *OutputProcessor) toolDisplayName(name string) string {
+	if p.normalizeToolNames {
+		return normalizeToolName(name)
+	}
+	return FormatMCPToolName(name)
+}
+
 // handleBashResult handles Bash tool results - always show output
 func handleBashResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
 	c := p.colors
+	g := p.glyphSet()
 	if block.Content != "" {
 		// Indent and display output, preserving ANSI colors
 		lines := strings.Split(block.Content, "\n")
 		for _, line := range lines {
 			// Show all lines, even empty ones, to preserve output structure
-			fmt.Fprintf(p.writer, "  %s\n", line)
+			fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), p.resultLine(line))
 		}
 	}
 
 	// Show error indicator if it failed
 	if block.IsError {
-		fmt.Fprintf(p.writer, "  %s✗ Command failed%s\n", c.Error, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%sCommand failed%s\n", p.indent(1), c.Error, g.Failure, c.Reset)
 	}
 }
 
 // handleGlobResult handles Glob tool results - show file paths found
 func handleGlobResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
 	c := p.colors
+	g := p.glyphSet()
 	if block.Content != "" {
 		lines := strings.Split(block.Content, "\n")
 		fileCount := 0
@@ -378,26 +1911,31 @@ func handleGlobResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBloc
 			if strings.TrimSpace(line) == "" {
 				continue
 			}
-			fmt.Fprintf(p.writer, "  %s%s%s\n", c.FilePath, line, c.Reset)
+			pathColor := c.FilePath
+			if p.dimResults {
+				pathColor = c.LabelDim
+			}
+			fmt.Fprintf(p.writer, "%s%s%s%s\n", p.indent(1), pathColor, line, c.Reset)
 			fileCount++
 		}
 
 		// Show count summary if no files or error
 		if fileCount == 0 && !block.IsError {
-			fmt.Fprintf(p.writer, "  %s(no matches)%s\n", c.LabelDim, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s(no matches)%s\n", p.indent(1), c.LabelDim, c.Reset)
 		}
 	} else if !block.IsError {
-		fmt.Fprintf(p.writer, "  %s(no matches)%s\n", c.LabelDim, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s(no matches)%s\n", p.indent(1), c.LabelDim, c.Reset)
 	}
 
 	if block.IsError {
-		fmt.Fprintf(p.writer, "  %s✗ Search failed%s\n", c.Error, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%sSearch failed%s\n", p.indent(1), c.Error, g.Failure, c.Reset)
 	}
 }
 
 // handleGrepResult handles Grep tool results - show matches with file:line format
 func handleGrepResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
 	c := p.colors
+	g := p.glyphSet()
 	if block.Content != "" {
 		lines := strings.Split(block.Content, "\n")
 		matchCount := 0
@@ -406,51 +1944,140 @@ func handleGrepResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBloc
 			if strings.TrimSpace(line) == "" {
 				continue
 			}
-			fmt.Fprintf(p.writer, "  %s\n", line)
+			fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), p.resultLine(line))
 			matchCount++
 		}
 
 		// Show count summary if no matches or error
 		if matchCount == 0 && !block.IsError {
-			fmt.Fprintf(p.writer, "  %s(no matches)%s\n", c.LabelDim, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s(no matches)%s\n", p.indent(1), c.LabelDim, c.Reset)
 		}
 	} else if !block.IsError {
-		fmt.Fprintf(p.writer, "  %s(no matches)%s\n", c.LabelDim, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s(no matches)%s\n", p.indent(1), c.LabelDim, c.Reset)
 	}
 
 	if block.IsError {
-		fmt.Fprintf(p.writer, "  %s✗ Search failed%s\n", c.Error, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%sSearch failed%s\n", p.indent(1), c.Error, g.Failure, c.Reset)
 	}
 }
 
 // handleWebSearchResult handles WebSearch tool results - show search results summary
 func handleWebSearchResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
 	c := p.colors
-	if block.Content != "" {
+	g := p.glyphSet()
+	if items, rest, ok := parseWebSearchResults(block.Content); ok && !block.IsError {
+		p.printWebSearchItems(items)
+		for _, line := range rest {
+			fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), p.resultLine(line))
+		}
+	} else if block.Content != "" {
 		lines := strings.Split(block.Content, "\n")
 		for _, line := range lines {
 			// Skip empty lines
 			if strings.TrimSpace(line) == "" {
 				continue
 			}
-			fmt.Fprintf(p.writer, "  %s\n", line)
+			fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), p.resultLine(line))
 		}
 	} else if !block.IsError {
-		fmt.Fprintf(p.writer, "  %s(no results)%s\n", c.LabelDim, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s(no results)%s\n", p.indent(1), c.LabelDim, c.Reset)
 	}
 
 	if block.IsError {
-		fmt.Fprintf(p.writer, "  %s✗ Search failed%s\n", c.Error, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%sSearch failed%s\n", p.indent(1), c.Error, g.Failure, c.Reset)
+	}
+}
+
+// webSearchItem is one result of a web search
+type webSearchItem struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// webSearchHeader starts claude's WebSearch results; the query is already on the tool call line
+const webSearchHeader = "Web search results for query:"
+
+// parseWebSearchResults picks the result items out of WebSearch output. It understands a
+// "Links: [{"title":..., "url":...}]" line, and blocks of "Title:", "URL:" and "Snippet:" (or
+// "Description:") lines separated by blank lines. rest holds the other non-empty lines, such
+// as claude's summary of the results. ok is false when no items were found.
+func parseWebSearchResults(content string) (items []webSearchItem, rest []string, ok bool) {
+	for _, chunk := range strings.Split(normalizeLineEndings(content), "\n\n") {
+		var item webSearchItem
+		var kept, other []string // All lines but parsed links, and those that aren't item fields
+		for _, line := range strings.Split(chunk, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, webSearchHeader) {
+				continue
+			}
+
+			key, value, _ := strings.Cut(line, ":")
+			value = strings.TrimSpace(value)
+			field := true
+			switch strings.ToLower(key) {
+			case "links":
+				var links []webSearchItem
+				if err := json.Unmarshal([]byte(value), &links); err == nil {
+					for _, link := range links {
+						if link.Title != "" || link.URL != "" {
+							items = append(items, link)
+						}
+					}
+					continue
+				}
+				field = false
+			case "title":
+				item.Title = value
+			case "url":
+				item.URL = value
+			case "snippet", "description":
+				item.Snippet = value
+			default:
+				field = false
+			}
+			kept = append(kept, line)
+			if !field {
+				other = append(other, line)
+			}
+		}
+
+		// A block without both a title and a URL wasn't a result after all
+		if item.Title != "" && item.URL != "" {
+			items = append(items, item)
+			rest = append(rest, other...)
+		} else {
+			rest = append(rest, kept...)
+		}
+	}
+	return items, rest, len(items) > 0
+}
+
+// printWebSearchItems prints search results as a numbered list: the title, then the URL and
+// snippet indented under it
+func (p *OutputProcessor) printWebSearchItems(items []webSearchItem) {
+	c := p.colors
+	for i, item := range items {
+		number := fmt.Sprintf("%d. ", i+1)
+		under := p.indent(1) + strings.Repeat(" ", len(number))
+		fmt.Fprintf(p.writer, "%s%s%s%s%s\n", p.indent(1), number, c.ValueBright, item.Title, c.Reset)
+		if item.URL != "" {
+			fmt.Fprintf(p.writer, "%s%s%s%s\n", under, c.FilePath, item.URL, c.Reset)
+		}
+		if item.Snippet != "" {
+			fmt.Fprintf(p.writer, "%s%s\n", under, p.resultLine(item.Snippet))
+		}
 	}
 }
 
 // handleKillShellResult handles KillShell tool results - show termination status
 func handleKillShellResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
 	c := p.colors
+	g := p.glyphSet()
 	if block.IsError {
-		fmt.Fprintf(p.writer, "  %s✗ Shell termination failed%s\n", c.Error, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%sShell termination failed%s\n", p.indent(1), c.Error, g.Failure, c.Reset)
 	} else {
-		fmt.Fprintf(p.writer, "  %s✓ Shell terminated%s\n", c.Success, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%sShell terminated%s\n", p.indent(1), c.Success, g.Success, c.Reset)
 	}
 
 	// Show output content if present (typically includes success/failure details)
@@ -458,7 +2085,7 @@ func handleKillShellResult(p *OutputProcessor, toolCall *ToolCall, block *Conten
 		lines := strings.Split(block.Content, "\n")
 		for _, line := range lines {
 			if strings.TrimSpace(line) != "" {
-				fmt.Fprintf(p.writer, "  %s\n", line)
+				fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), p.resultLine(line))
 			}
 		}
 	}
@@ -467,6 +2094,7 @@ func handleKillShellResult(p *OutputProcessor, toolCall *ToolCall, block *Conten
 // handleTaskOutputResult handles TaskOutput tool results - show task output or status
 func handleTaskOutputResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
 	c := p.colors
+	g := p.glyphSet()
 	if block.Content != "" {
 		// Display the task output
 		lines := strings.Split(block.Content, "\n")
@@ -475,25 +2103,76 @@ func handleTaskOutputResult(p *OutputProcessor, toolCall *ToolCall, block *Conte
 			if strings.TrimSpace(line) == "" {
 				continue
 			}
-			fmt.Fprintf(p.writer, "  %s\n", line)
+			fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), p.resultLine(line))
 		}
 	} else if block.IsError {
-		fmt.Fprintf(p.writer, "  %s✗ Failed to retrieve task output%s\n", c.Error, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%sFailed to retrieve task output%s\n", p.indent(1), c.Error, g.Failure, c.Reset)
 	}
 	// No output case is silent - the tool just returns nothing useful to display
 }
 
+// readPreviewLines is how many lines of a Read result verbose mode previews
+const readPreviewLines = 10
+
+// readLineNumber matches the line number Read prefixes to each line, e.g. "    12→"
+var readLineNumber = regexp.MustCompile(`^\s*(\d+)(→|\t)`)
+
+// handleReadResult handles Read tool results - the number of lines read, and in verbose
+// mode a numbered preview of the first few
+func handleReadResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
+	if block.IsError {
+		handleDefaultResult(p, toolCall, block)
+		return
+	}
+
+	c := p.colors
+	g := p.glyphSet()
+	name := p.toolDisplayName(toolCall.Name)
+
+	var lines []string
+	if content := strings.TrimRight(block.Content, "\n"); content != "" {
+		lines = strings.Split(content, "\n")
+	}
+	count := fmt.Sprintf("%d lines", len(lines))
+	if len(lines) == 1 {
+		count = "1 line"
+	}
+	fmt.Fprintf(p.writer, "%s%s%s%s%s %s\n", p.indent(1), c.Success, g.Success, c.Reset, name, count)
+
+	if p.mode != OutputModeVerbose || len(lines) == 0 {
+		return
+	}
+	preview := lines[:min(len(lines), readPreviewLines)]
+	code := make([]string, len(preview))
+	for i, line := range preview {
+		code[i] = readLineNumber.ReplaceAllString(line, "")
+	}
+	// Read with an offset starts partway into the file, so keep its numbering
+	start := 1
+	if m := readLineNumber.FindStringSubmatch(preview[0]); m != nil {
+		start, _ = strconv.Atoi(m[1])
+	}
+	formatted := FormatCodeBlock(strings.Join(code, "\n"), &FormatConfig{Colors: c, ShowLineNo: true, StartLine: start})
+	for _, line := range strings.Split(strings.TrimSuffix(formatted, "\n"), "\n") {
+		fmt.Fprintf(p.writer, "%s%s\n", p.indent(2), line)
+	}
+	if more := len(lines) - len(preview); more > 0 {
+		fmt.Fprintf(p.writer, "%s%s… %d more lines%s\n", p.indent(2), c.LabelDim, more, c.Reset)
+	}
+}
+
 // handleDefaultResult handles tool results for tools without specific handlers
 func handleDefaultResult(p *OutputProcessor, toolCall *ToolCall, block *ContentBlock) {
 	c := p.colors
+	g := p.glyphSet()
 	statusColor := c.Success
-	status := "✓"
+	status := g.Success
 	if block.IsError {
 		statusColor = c.Error
-		status = "✗"
+		status = g.Failure
 	}
 
-	fmt.Fprintf(p.writer, "  %s%s%s %s completed\n", statusColor, status, c.Reset, toolCall.Name)
+	fmt.Fprintf(p.writer, "%s%s%s%s%s completed\n", p.indent(1), statusColor, status, c.Reset, toolCall.Name)
 
 	// Show result in verbose mode
 	if p.mode == OutputModeVerbose && block.Content != "" {
@@ -501,7 +2180,7 @@ func handleDefaultResult(p *OutputProcessor, toolCall *ToolCall, block *ContentB
 		lines := strings.Split(block.Content, "\n")
 		for _, line := range lines {
 			if line != "" {
-				fmt.Fprintf(p.writer, "    %s\n", line)
+				fmt.Fprintf(p.writer, "%s%s\n", p.indent(2), p.resultLine(line))
 			}
 		}
 	}
@@ -511,6 +2190,36 @@ func handleDefaultResult(p *OutputProcessor, toolCall *ToolCall, block *ContentB
 func (p *OutputProcessor) printDiff(oldStr, newStr string) {
 	c := p.colors
 
+	if p.diffMode == diffModeWord && p.printWordDiff(oldStr, newStr) {
+		return
+	}
+
+	for _, d := range diffLines(oldStr, newStr) {
+		color := c.DiffAdd
+		if d.Op == DiffOpRemove {
+			color = c.DiffRemove
+		}
+		fmt.Fprintf(p.writer, "%s%s%s %s%s\n", p.indent(1), color, d.Op, d.Line, c.Reset)
+	}
+}
+
+// DiffOp marks a diff line as removed or added
+type DiffOp string
+
+const (
+	DiffOpRemove DiffOp = "-"
+	DiffOpAdd    DiffOp = "+"
+	DiffOpSame   DiffOp = " " // Session comparisons and word diffs; line diffs of edits have no context lines
+)
+
+// DiffLine is one line of an Edit diff
+type DiffLine struct {
+	Op   DiffOp `json:"op"`
+	Line string `json:"line"`
+}
+
+// diffLines computes the diff shown for an edit: every old line removed, then every new line added
+func diffLines(oldStr, newStr string) []DiffLine {
 	// Split into lines for diff display
 	oldLines := strings.Split(oldStr, "\n")
 	newLines := strings.Split(newStr, "\n")
@@ -523,51 +2232,310 @@ func (p *OutputProcessor) printDiff(oldStr, newStr string) {
 		newLines = newLines[:len(newLines)-1]
 	}
 
-	// Print removed lines (old)
+	diff := make([]DiffLine, 0, len(oldLines)+len(newLines))
 	for _, line := range oldLines {
-		fmt.Fprintf(p.writer, "  %s- %s%s\n", c.DiffRemove, line, c.Reset)
+		diff = append(diff, DiffLine{Op: DiffOpRemove, Line: line})
 	}
-
-	// Print added lines (new)
 	for _, line := range newLines {
-		fmt.Fprintf(p.writer, "  %s+ %s%s\n", c.DiffAdd, line, c.Reset)
+		diff = append(diff, DiffLine{Op: DiffOpAdd, Line: line})
+	}
+	return diff
+}
+
+// diffToken matches the units a word diff compares: words, runs of whitespace, and single
+// punctuation characters
+var diffToken = regexp.MustCompile(`\w+|\s+|[^\w\s]`)
+
+// maxWordDiffTokens caps the tokens on either side of a word diff. Aligning them takes a table
+// the size of both sides multiplied, so a larger edit falls back to the line diff.
+const maxWordDiffTokens = 1000
+
+// diffWords computes a word-level diff of an edit, aligning the words of old and new on their
+// longest common subsequence. Consecutive words with the same op are merged into one span.
+// ok is false when either side has more than maxWordDiffTokens tokens.
+func diffWords(oldStr, newStr string) (spans []DiffLine, ok bool) {
+	a, b := diffToken.FindAllString(oldStr, -1), diffToken.FindAllString(newStr, -1)
+	if len(a) > maxWordDiffTokens || len(b) > maxWordDiffTokens {
+		return nil, false
+	}
+	for _, d := range alignSteps(a, b) {
+		if n := len(spans); n > 0 && spans[n-1].Op == d.Op {
+			spans[n-1].Line += d.Line
+			continue
+		}
+		spans = append(spans, d)
+	}
+	return spans, true
+}
+
+// printWordDiff prints an edit as its new text with the changed words highlighted inline:
+// removed words in the remove color, added words in the add color. Without colors the changes
+// are marked [-removed-] and {+added+}. It prints nothing and returns false for an edit too
+// large to diff word by word.
+func (p *OutputProcessor) printWordDiff(oldStr, newStr string) bool {
+	c := p.colors
+
+	spans, ok := diffWords(strings.TrimSuffix(oldStr, "\n"), strings.TrimSuffix(newStr, "\n"))
+	if !ok {
+		return false
+	}
+	var line strings.Builder
+	for _, span := range spans {
+		color, open, close := "", "", ""
+		switch span.Op {
+		case DiffOpRemove:
+			color, open, close = c.DiffRemove, "[-", "-]"
+		case DiffOpAdd:
+			color, open, close = c.DiffAdd, "{+", "+}"
+		}
+		if c.Reset != "" {
+			open, close = color, c.Reset
+		}
+
+		// A span can cross lines; each line gets its own markers
+		for i, part := range strings.Split(span.Line, "\n") {
+			if i > 0 {
+				fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), line.String())
+				line.Reset()
+			}
+			if part == "" {
+				continue
+			}
+			if span.Op == DiffOpSame {
+				line.WriteString(part)
+			} else {
+				line.WriteString(open + part + close)
+			}
+		}
+	}
+	fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), line.String())
+	return true
+}
+
+// editPair is the old_string and new_string of one edit, and whether it replaces every
+// occurrence (replace_all) rather than the first
+type editPair struct {
+	Old, New   string
+	ReplaceAll bool
+}
+
+// unifiedHunks computes the unified diff hunks of one edit, with context lines around each
+// change. The edit's first line is line base+1 of the old and new file; without the file
+// around it those numbers are synthetic.
+func unifiedHunks(oldStr, newStr string, context, oldBase, newBase int) []string {
+	diff := alignSteps(splitDiffLines(oldStr), splitDiffLines(newStr))
+
+	var hunks []string
+	for start := 0; start < len(diff); {
+		// Find the next change, then extend the hunk while changes are close enough to share context
+		first := start
+		for first < len(diff) && diff[first].Op == DiffOpSame {
+			first++
+		}
+		if first == len(diff) {
+			break
+		}
+		last := first
+		for i := first + 1; i < len(diff) && i <= last+2*context+1; i++ {
+			if diff[i].Op != DiffOpSame {
+				last = i
+			}
+		}
+		from, to := max(first-context, start), min(last+context+1, len(diff))
+
+		// Line numbers count the lines each side has before the hunk
+		oldStart, newStart := oldBase+1, newBase+1
+		for _, d := range diff[:from] {
+			if d.Op != DiffOpAdd {
+				oldStart++
+			}
+			if d.Op != DiffOpRemove {
+				newStart++
+			}
+		}
+		var lines []string
+		oldCount, newCount := 0, 0
+		for _, d := range diff[from:to] {
+			if d.Op != DiffOpAdd {
+				oldCount++
+			}
+			if d.Op != DiffOpRemove {
+				newCount++
+			}
+			lines = append(lines, string(d.Op)+d.Line)
+		}
+		// An empty side is numbered by the line before it
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		hunks = append(hunks, fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, oldCount, newStart, newCount))
+		hunks = append(hunks, lines...)
+		start = to
+	}
+	return hunks
+}
+
+// splitDiffLines splits text into lines for a diff, dropping the empty line after a final newline
+func splitDiffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// printUnifiedDiff prints the edits to a file as one unified diff patch (--diff=unified), with
+// git's a/ and b/ headers naming the path relative to the session's working directory, so the
+// patch applies with git apply. Hunks are numbered by where each edit sits in the file when it
+// can be read; otherwise each edit's lines are numbered after the previous edit's.
+func (p *OutputProcessor) printUnifiedDiff(path string, edits []editPair) {
+	c := p.colors
+
+	context := p.diffContext
+	if context == 0 {
+		context = defaultDiffContext
+	}
+	context = max(context, 0)
+
+	hunks, ok := p.fileHunks(path, edits, context)
+	if !ok {
+		hunks = nil
+		oldBase, newBase := 0, 0
+		for _, edit := range edits {
+			hunks = append(hunks, unifiedHunks(edit.Old, edit.New, context, oldBase, newBase)...)
+			oldBase += len(splitDiffLines(edit.Old))
+			newBase += len(splitDiffLines(edit.New))
+		}
+	}
+
+	rel := p.patchPath(path)
+	fmt.Fprintf(p.writer, "--- a/%s\n+++ b/%s\n", rel, rel)
+	for _, line := range hunks {
+		color := ""
+		switch line[0] {
+		case '-':
+			color = c.DiffRemove
+		case '+':
+			color = c.DiffAdd
+		case '@':
+			color = c.LabelDim
+		}
+		if color == "" {
+			fmt.Fprintln(p.writer, line)
+			continue
+		}
+		fmt.Fprintf(p.writer, "%s%s%s\n", color, line, c.Reset)
+	}
+}
+
+// patchPath names a file the way a patch header does: relative to the session's working
+// directory, with forward slashes and no leading slash
+func (p *OutputProcessor) patchPath(path string) string {
+	if cwd := p.state.Cwd; cwd != "" && filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(cwd, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			path = rel
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+// fileHunks computes the hunks of a file's edits against the file itself, so they carry its real
+// line numbers and context. The tool call renders before claude runs it, so the file still holds
+// each old_string. ok is false when the file can't be read or an edit isn't found in it.
+func (p *OutputProcessor) fileHunks(path string, edits []editPair, context int) (hunks []string, ok bool) {
+	if !filepath.IsAbs(path) && p.state.Cwd != "" {
+		path = filepath.Join(p.state.Cwd, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	edited := string(data)
+	for _, edit := range edits {
+		if edit.Old == "" || !strings.Contains(edited, edit.Old) {
+			return nil, false
+		}
+		if edit.ReplaceAll {
+			edited = strings.ReplaceAll(edited, edit.Old, edit.New)
+		} else {
+			edited = strings.Replace(edited, edit.Old, edit.New, 1)
+		}
+	}
+
+	// Only the lines between the first and last change, with their context, need aligning
+	oldLines, newLines := splitDiffLines(string(data)), splitDiffLines(edited)
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix && oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	from, trim := max(prefix-context, 0), max(suffix-context, 0)
+	return unifiedHunks(joinDiffLines(oldLines[from:len(oldLines)-trim]), joinDiffLines(newLines[from:len(newLines)-trim]), context, from, from), true
+}
+
+// joinDiffLines reverses splitDiffLines
+func joinDiffLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
 	}
+	return strings.Join(lines, "\n") + "\n"
 }
 
 // printToolCall prints a tool call
 func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	c := p.colors
+	g := p.glyphSet()
+
+	p.trackFile(toolCall)
 
 	// Format tool name - shorten MCP tool names
-	displayName := FormatMCPToolName(toolCall.Name)
+	displayName := p.toolDisplayName(toolCall.Name)
 
-	// Parse input to extract parameters
-	var inputMap map[string]interface{}
-	if len(toolCall.Input) > 0 {
-		// Ignore error - continue with empty map on failure (graceful degradation)
-		_ = json.Unmarshal(toolCall.Input, &inputMap)
-	}
+	// Parse input to extract parameters (cached on the tool call)
+	inputMap := toolCall.InputMap()
 
 	// Handle Bash tool specially
 	if toolCall.Name == "Bash" {
 		if command, ok := inputMap["command"].(string); ok {
+			// Background commands get a marker since their output arrives later via BashOutput.
+			// The timeout matters most there, so it shows for them even outside verbose mode
+			markers := ""
+			background, _ := inputMap["run_in_background"].(bool)
+			if background {
+				markers += fmt.Sprintf(" %s[background]%s", c.LabelDim, c.Reset)
+			}
+			if timeout, ok := inputMap["timeout"].(float64); ok && timeout > 0 && (background || p.mode == OutputModeVerbose) {
+				markers += fmt.Sprintf(" %s[timeout: %s]%s", c.LabelDim, formatTimeout(timeout), c.Reset)
+			}
+
 			// Show command as the primary info
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, command)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, command, markers)
 
 			// In verbose mode, also show description if available
 			if p.mode == OutputModeVerbose {
 				if desc, ok := inputMap["description"].(string); ok && desc != "" {
-					fmt.Fprintf(p.writer, "  %sDescription:%s %s\n", c.LabelDim, c.Reset, desc)
+					fmt.Fprintf(p.writer, "%s%sDescription:%s %s\n", p.indent(1), c.LabelDim, c.Reset, desc)
 				}
 			}
 			return
 		}
+
+		// Without a command (partially parsed input), the description still says what it does
+		if desc, ok := inputMap["description"].(string); ok && desc != "" {
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.LabelDim, desc, c.Reset)
+			return
+		}
 	}
 
 	// Handle Read tool specially
 	if toolCall.Name == "Read" {
 		if filePath, ok := inputMap["file_path"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
 			return
 		}
 	}
@@ -586,9 +2554,9 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 			}
 
 			if lineCount > 0 {
-				fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s %s(%d lines)%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset, c.LabelDim, lineCount, c.Reset)
+				fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s %s(%d lines)%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset, c.LabelDim, lineCount, c.Reset)
 			} else {
-				fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
+				fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
 			}
 			return
 		}
@@ -597,13 +2565,18 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle Edit tool specially
 	if toolCall.Name == "Edit" {
 		if filePath, ok := inputMap["file_path"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
 
 			// Show diff if we have old and new strings
 			oldStr, hasOld := inputMap["old_string"].(string)
 			newStr, hasNew := inputMap["new_string"].(string)
 
 			if hasOld && hasNew {
+				if p.diffMode == diffModeUnified {
+					replaceAll, _ := inputMap["replace_all"].(bool)
+					p.printUnifiedDiff(filePath, []editPair{{oldStr, newStr, replaceAll}})
+					return
+				}
 				p.printDiff(oldStr, newStr)
 			}
 			return
@@ -613,10 +2586,29 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle MultiEdit tool specially
 	if toolCall.Name == "MultiEdit" {
 		if filePath, ok := inputMap["file_path"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, filePath, c.Reset)
 
 			// Show diff for each edit if we have edits array
-			if edits, ok := inputMap["edits"].([]interface{}); ok {
+			edits, ok := inputMap["edits"].([]interface{})
+			if ok && p.diffMode == diffModeUnified {
+				// One patch for the file, combining all the edits
+				var pairs []editPair
+				for _, edit := range edits {
+					if editMap, ok := edit.(map[string]interface{}); ok {
+						oldStr, hasOld := editMap["old_string"].(string)
+						newStr, hasNew := editMap["new_string"].(string)
+						replaceAll, _ := editMap["replace_all"].(bool)
+						if hasOld && hasNew {
+							pairs = append(pairs, editPair{oldStr, newStr, replaceAll})
+						}
+					}
+				}
+				if len(pairs) > 0 {
+					p.printUnifiedDiff(filePath, pairs)
+				}
+				return
+			}
+			if ok {
 				for i, edit := range edits {
 					if editMap, ok := edit.(map[string]interface{}); ok {
 						oldStr, hasOld := editMap["old_string"].(string)
@@ -624,7 +2616,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 
 						if hasOld && hasNew {
 							if i > 0 {
-								fmt.Fprintf(p.writer, "  %s---%s\n", c.LabelDim, c.Reset)
+								fmt.Fprintf(p.writer, "%s%s---%s\n", p.indent(1), c.LabelDim, c.Reset)
 							}
 							p.printDiff(oldStr, newStr)
 						}
@@ -638,7 +2630,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle Glob tool specially
 	if toolCall.Name == "Glob" {
 		if pattern, ok := inputMap["pattern"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, pattern)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, pattern)
 			return
 		}
 	}
@@ -658,7 +2650,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 				filters += fmt.Sprintf(" %s[path: %s]%s", c.LabelDim, path, c.Reset)
 			}
 
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, pattern, filters)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, pattern, filters)
 			return
 		}
 	}
@@ -666,12 +2658,12 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle LS tool specially - display path
 	if toolCall.Name == "LS" {
 		if path, ok := inputMap["path"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, path, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, path, c.Reset)
 
 			// In verbose mode, show stat details if present
 			if p.mode == OutputModeVerbose {
 				if stat, ok := inputMap["stat"].(bool); ok && stat {
-					fmt.Fprintf(p.writer, "  %s[with file stats]%s\n", c.LabelDim, c.Reset)
+					fmt.Fprintf(p.writer, "%s%s[with file stats]%s\n", p.indent(1), c.LabelDim, c.Reset)
 				}
 			}
 			return
@@ -681,7 +2673,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle NotebookRead tool specially - display notebook path
 	if toolCall.Name == "NotebookRead" {
 		if notebookPath, ok := inputMap["notebook_path"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, notebookPath, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, notebookPath, c.Reset)
 
 			// Show offset and limit if present (for partial reads)
 			offset, hasOffset := inputMap["offset"].(float64)
@@ -697,7 +2689,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 					}
 					rangeInfo += fmt.Sprintf("limit: %.0f", limit)
 				}
-				fmt.Fprintf(p.writer, "  %s[%s]%s\n", c.LabelDim, rangeInfo, c.Reset)
+				fmt.Fprintf(p.writer, "%s%s[%s]%s\n", p.indent(1), c.LabelDim, rangeInfo, c.Reset)
 			}
 			return
 		}
@@ -706,14 +2698,14 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle NotebookEdit tool specially - display notebook path, cell ID, and edit mode
 	if toolCall.Name == "NotebookEdit" {
 		if notebookPath, ok := inputMap["notebook_path"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, notebookPath, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.FilePath, notebookPath, c.Reset)
 
 			// Show cell ID and edit mode
 			cellID, hasCellID := inputMap["cell_id"].(string)
 			editMode, hasEditMode := inputMap["edit_mode"].(string)
 
 			if hasCellID {
-				fmt.Fprintf(p.writer, "  %sCell:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, cellID, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sCell:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, cellID, c.Reset)
 			}
 
 			if hasEditMode {
@@ -727,13 +2719,13 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 				case "delete":
 					modeDisplay = "delete"
 				}
-				fmt.Fprintf(p.writer, "  %sMode:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, modeDisplay, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sMode:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, modeDisplay, c.Reset)
 			}
 
 			// In verbose mode, show cell type if present
 			if p.mode == OutputModeVerbose {
 				if cellType, ok := inputMap["cell_type"].(string); ok && cellType != "" {
-					fmt.Fprintf(p.writer, "  %sType:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, cellType, c.Reset)
+					fmt.Fprintf(p.writer, "%s%sType:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, cellType, c.Reset)
 				}
 			}
 			return
@@ -748,9 +2740,9 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 
 			// Include args if provided
 			if args, ok := inputMap["args"].(string); ok && args != "" {
-				fmt.Fprintf(p.writer, "%s→%s %s%s%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset, c.LabelDim, args, c.Reset)
+				fmt.Fprintf(p.writer, "%s%s%s%s%s%s %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset, c.LabelDim, args, c.Reset)
 			} else {
-				fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+				fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 			}
 			return
 		}
@@ -761,22 +2753,19 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 		url, hasURL := inputMap["url"].(string)
 		prompt, hasPrompt := inputMap["prompt"].(string)
 
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
 
 		if hasURL {
-			fmt.Fprintf(p.writer, "  %sURL:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, url, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sURL:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, url, c.Reset)
 		}
 
 		if hasPrompt {
-			// Truncate prompt if too long (show first 120 chars)
-			displayPrompt := prompt
-			if len(prompt) > 120 {
-				displayPrompt = prompt[:117] + "..."
-			}
-			fmt.Fprintf(p.writer, "  %sPrompt:%s %s\n", c.LabelDim, c.Reset, displayPrompt)
+			// Truncate prompt if too long
+			displayPrompt, truncated := p.truncate(prompt)
+			fmt.Fprintf(p.writer, "%s%sPrompt:%s %s\n", p.indent(1), c.LabelDim, c.Reset, displayPrompt)
 
 			// In verbose mode, show full prompt if it was truncated
-			if p.mode == OutputModeVerbose && len(prompt) > 120 {
+			if p.mode == OutputModeVerbose && truncated {
 				// Wrap long prompts to 80 chars per line
 				words := strings.Fields(prompt)
 				var lines []string
@@ -796,9 +2785,9 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 					lines = append(lines, currentLine.String())
 				}
 
-				fmt.Fprintf(p.writer, "  %sFull prompt:%s\n", c.LabelDim, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sFull prompt:%s\n", p.indent(1), c.LabelDim, c.Reset)
 				for _, line := range lines {
-					fmt.Fprintf(p.writer, "    %s\n", line)
+					fmt.Fprintf(p.writer, "%s%s\n", p.indent(2), line)
 				}
 			}
 		}
@@ -809,10 +2798,10 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	if toolCall.Name == "WebSearch" {
 		query, hasQuery := inputMap["query"].(string)
 
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
 
 		if hasQuery {
-			fmt.Fprintf(p.writer, "  %sQuery:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, query, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sQuery:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, query, c.Reset)
 		}
 
 		// Show allowed domains if present
@@ -824,7 +2813,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 				}
 			}
 			if len(domains) > 0 {
-				fmt.Fprintf(p.writer, "  %sAllowed:%s %s\n", c.LabelDim, c.Reset, strings.Join(domains, ", "))
+				fmt.Fprintf(p.writer, "%s%sAllowed:%s %s\n", p.indent(1), c.LabelDim, c.Reset, strings.Join(domains, ", "))
 			}
 		}
 
@@ -837,7 +2826,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 				}
 			}
 			if len(domains) > 0 {
-				fmt.Fprintf(p.writer, "  %sBlocked:%s %s\n", c.LabelDim, c.Reset, strings.Join(domains, ", "))
+				fmt.Fprintf(p.writer, "%s%sBlocked:%s %s\n", p.indent(1), c.LabelDim, c.Reset, strings.Join(domains, ", "))
 			}
 		}
 		return
@@ -846,7 +2835,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle AskUserQuestion tool specially - display questions with numbered options
 	if toolCall.Name == "AskUserQuestion" {
 		if questionsRaw, ok := inputMap["questions"].([]interface{}); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
 
 			// Print each question with its options
 			for i, questionRaw := range questionsRaw {
@@ -859,21 +2848,21 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 						// Print question header with index if multiple questions
 						if len(questionsRaw) > 1 {
 							if hasHeader {
-								fmt.Fprintf(p.writer, "  %s[%s]%s %s\n", c.LabelDim, header, c.Reset, question)
+								fmt.Fprintf(p.writer, "%s%s[%s]%s %s\n", p.indent(1), c.LabelDim, header, c.Reset, question)
 							} else {
-								fmt.Fprintf(p.writer, "  %s[Q%d]%s %s\n", c.LabelDim, i+1, c.Reset, question)
+								fmt.Fprintf(p.writer, "%s%s[Q%d]%s %s\n", p.indent(1), c.LabelDim, i+1, c.Reset, question)
 							}
 						} else {
 							if hasHeader {
-								fmt.Fprintf(p.writer, "  %s[%s]%s %s\n", c.LabelDim, header, c.Reset, question)
+								fmt.Fprintf(p.writer, "%s%s[%s]%s %s\n", p.indent(1), c.LabelDim, header, c.Reset, question)
 							} else {
-								fmt.Fprintf(p.writer, "  %s\n", question)
+								fmt.Fprintf(p.writer, "%s%s\n", p.indent(1), question)
 							}
 						}
 
 						// Show multi-select indicator if enabled
 						if multiSelect {
-							fmt.Fprintf(p.writer, "  %s(multiple selections allowed)%s\n", c.LabelDim, c.Reset)
+							fmt.Fprintf(p.writer, "%s%s(multiple selections allowed)%s\n", p.indent(1), c.LabelDim, c.Reset)
 						}
 
 						// Print options with numbers
@@ -884,11 +2873,11 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 									description, hasDesc := optionMap["description"].(string)
 
 									if hasLabel {
-										fmt.Fprintf(p.writer, "    %s%d.%s %s\n", c.LabelDim, j+1, c.Reset, label)
+										fmt.Fprintf(p.writer, "%s%s%d.%s %s\n", p.indent(2), c.LabelDim, j+1, c.Reset, label)
 
 										// Show description in verbose mode
 										if p.mode == OutputModeVerbose && hasDesc && description != "" {
-											fmt.Fprintf(p.writer, "       %s%s%s\n", c.LabelDim, description, c.Reset)
+											fmt.Fprintf(p.writer, "%s %s%s%s\n", p.indent(3), c.LabelDim, description, c.Reset)
 										}
 									}
 								}
@@ -909,15 +2898,18 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle TodoWrite tool specially - display todos in a prettified list format
 	if toolCall.Name == "TodoWrite" {
 		if todosRaw, ok := inputMap["todos"].([]interface{}); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
 
 			// Print each todo item with status indicator
+			var todos []TodoItem
 			for _, todoRaw := range todosRaw {
 				if todoMap, ok := todoRaw.(map[string]interface{}); ok {
 					content, hasContent := todoMap["content"].(string)
 					status, hasStatus := todoMap["status"].(string)
 
 					if hasContent && hasStatus {
+						todos = append(todos, TodoItem{Content: content, Status: status})
+
 						// Choose status indicator
 						statusIcon := "○" // pending
 						statusColor := c.LabelDim
@@ -931,10 +2923,15 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 						}
 
 						// Print the todo item
-						fmt.Fprintf(p.writer, "  %s%s%s %s\n", statusColor, statusIcon, c.Reset, content)
+						fmt.Fprintf(p.writer, "%s%s%s%s %s\n", p.indent(1), statusColor, statusIcon, c.Reset, content)
 					}
 				}
 			}
+
+			p.state.Todos = todos
+			if p.todoProgress {
+				p.printTodoProgress()
+			}
 			return
 		}
 	}
@@ -952,7 +2949,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 		}
 
 		// Build the output line
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset)
 
 		// Show subagent type if present
 		if subagentType != "" {
@@ -968,17 +2965,17 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 
 		// Show model override if present
 		if model, ok := inputMap["model"].(string); ok && model != "" {
-			fmt.Fprintf(p.writer, "  %sModel:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, model, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sModel:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, model, c.Reset)
 		}
 
 		// Show background flag if true
 		if runInBackground, ok := inputMap["run_in_background"].(bool); ok && runInBackground {
-			fmt.Fprintf(p.writer, "  %sBackground:%s %srunning%s\n", c.LabelDim, c.Reset, c.LabelDim, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sBackground:%s %srunning%s\n", p.indent(1), c.LabelDim, c.Reset, c.LabelDim, c.Reset)
 		}
 
 		// Show max_turns if present
 		if maxTurns, ok := inputMap["max_turns"].(float64); ok && maxTurns > 0 {
-			fmt.Fprintf(p.writer, "  %sMax turns:%s %s%.0f%s\n", c.LabelDim, c.Reset, c.ValueBright, maxTurns, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sMax turns:%s %s%.0f%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, maxTurns, c.Reset)
 		}
 
 		return
@@ -987,7 +2984,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle KillShell tool specially - display shell ID being terminated
 	if toolCall.Name == "KillShell" {
 		if shellID, ok := inputMap["shell_id"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.ValueBright, shellID, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.ValueBright, shellID, c.Reset)
 			return
 		}
 	}
@@ -995,7 +2992,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle TaskOutput tool specially - display task ID and blocking mode
 	if toolCall.Name == "TaskOutput" {
 		if taskID, ok := inputMap["task_id"].(string); ok {
-			fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s%s%s", c.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.ValueBright, taskID, c.Reset)
+			fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s%s%s", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, toolCall.Name, c.Reset, c.ValueBright, taskID, c.Reset)
 
 			// Show blocking mode if present
 			if block, ok := inputMap["block"].(bool); ok && block {
@@ -1008,7 +3005,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 			// Show timeout if present (in verbose mode only)
 			if p.mode == OutputModeVerbose {
 				if timeout, ok := inputMap["timeout"].(float64); ok && timeout > 0 {
-					fmt.Fprintf(p.writer, "  %sTimeout:%s %s%.0fms%s\n", c.LabelDim, c.Reset, c.ValueBright, timeout, c.Reset)
+					fmt.Fprintf(p.writer, "%s%sTimeout:%s %s%.0fms%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, timeout, c.Reset)
 				}
 			}
 			return
@@ -1017,22 +3014,22 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 
 	// Handle EnterPlanMode tool specially - display plan mode entry
 	if toolCall.Name == "EnterPlanMode" {
-		fmt.Fprintf(p.writer, "%s→%s %s[PLAN MODE]%s Entering plan mode\n", c.ToolArrow, c.Reset, c.ValueBright, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s[PLAN MODE]%s Entering plan mode\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ValueBright, c.Reset)
 		return
 	}
 
 	// Handle ExitPlanMode tool specially - display plan status and requested permissions
 	if toolCall.Name == "ExitPlanMode" {
-		fmt.Fprintf(p.writer, "%s→%s %s[PLAN MODE]%s Exiting plan mode\n", c.ToolArrow, c.Reset, c.ValueBright, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s[PLAN MODE]%s Exiting plan mode\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ValueBright, c.Reset)
 
 		// Show requested permissions if present
 		if allowedPrompts, ok := inputMap["allowedPrompts"].([]interface{}); ok && len(allowedPrompts) > 0 {
-			fmt.Fprintf(p.writer, "  %sRequested permissions:%s\n", c.LabelDim, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sRequested permissions:%s\n", p.indent(1), c.LabelDim, c.Reset)
 			for _, promptRaw := range allowedPrompts {
 				if promptMap, ok := promptRaw.(map[string]interface{}); ok {
 					if tool, ok := promptMap["tool"].(string); ok {
 						if prompt, ok := promptMap["prompt"].(string); ok {
-							fmt.Fprintf(p.writer, "    %s%s:%s %s\n", c.ToolName, tool, c.Reset, prompt)
+							fmt.Fprintf(p.writer, "%s%s%s:%s %s\n", p.indent(2), c.ToolName, tool, c.Reset, prompt)
 						}
 					}
 				}
@@ -1041,12 +3038,12 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 
 		// Show remote push info if present
 		if pushToRemote, ok := inputMap["pushToRemote"].(bool); ok && pushToRemote {
-			fmt.Fprintf(p.writer, "  %sRemote sync:%s enabled\n", c.LabelDim, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sRemote sync:%s enabled\n", p.indent(1), c.LabelDim, c.Reset)
 			if sessionID, ok := inputMap["remoteSessionId"].(string); ok && sessionID != "" {
-				fmt.Fprintf(p.writer, "    %sSession ID:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, sessionID, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sSession ID:%s %s%s%s\n", p.indent(2), c.LabelDim, c.Reset, c.ValueBright, sessionID, c.Reset)
 			}
 			if sessionURL, ok := inputMap["remoteSessionUrl"].(string); ok && sessionURL != "" {
-				fmt.Fprintf(p.writer, "    %sSession URL:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, sessionURL, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sSession URL:%s %s%s%s\n", p.indent(2), c.LabelDim, c.Reset, c.ValueBright, sessionURL, c.Reset)
 			}
 		}
 
@@ -1059,66 +3056,63 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 
 	// Playwright navigate - display URL
 	if toolCall.Name == "navigate" || strings.HasSuffix(toolCall.Name, "__navigate") {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 
 		if url, ok := inputMap["url"].(string); ok {
-			fmt.Fprintf(p.writer, "  %sURL:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, url, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sURL:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, url, c.Reset)
 		}
 		if timeout, ok := inputMap["timeout"].(float64); ok && timeout > 0 && p.mode == OutputModeVerbose {
-			fmt.Fprintf(p.writer, "  %sTimeout:%s %s%.0fms%s\n", c.LabelDim, c.Reset, c.ValueBright, timeout, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sTimeout:%s %s%.0fms%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, timeout, c.Reset)
 		}
 		return
 	}
 
 	// Playwright click - display element selector
 	if toolCall.Name == "click" || strings.HasSuffix(toolCall.Name, "__click") {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 
 		if selector, ok := inputMap["selector"].(string); ok {
-			fmt.Fprintf(p.writer, "  %sElement:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, selector, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sElement:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, selector, c.Reset)
 		}
 		return
 	}
 
 	// Playwright type/fill - display element and text
 	if toolCall.Name == "type" || toolCall.Name == "fill" || strings.HasSuffix(toolCall.Name, "__type") || strings.HasSuffix(toolCall.Name, "__fill") {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 
 		if selector, ok := inputMap["selector"].(string); ok {
-			fmt.Fprintf(p.writer, "  %sElement:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, selector, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sElement:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, selector, c.Reset)
 		}
 		if text, ok := inputMap["text"].(string); ok {
-			// Show truncated text (first 80 chars)
-			displayText := text
-			if len(text) > 80 {
-				displayText = text[:77] + "..."
-			}
-			fmt.Fprintf(p.writer, "  %sText:%s %s\n", c.LabelDim, c.Reset, displayText)
+			// Show truncated text
+			displayText, _ := p.truncate(text)
+			fmt.Fprintf(p.writer, "%s%sText:%s %s\n", p.indent(1), c.LabelDim, c.Reset, displayText)
 		}
 		return
 	}
 
 	// Playwright screenshot - display filename and options
 	if toolCall.Name == "screenshot" || strings.HasSuffix(toolCall.Name, "__screenshot") {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 
 		if path, ok := inputMap["path"].(string); ok {
-			fmt.Fprintf(p.writer, "  %sFile:%s %s%s%s\n", c.LabelDim, c.Reset, c.FilePath, path, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sFile:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.FilePath, path, c.Reset)
 		}
 		// Show screenshot type if present
 		if screenshotType, ok := inputMap["type"].(string); ok && p.mode == OutputModeVerbose {
-			fmt.Fprintf(p.writer, "  %sType:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, screenshotType, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sType:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, screenshotType, c.Reset)
 		}
 		return
 	}
 
 	// Playwright snapshot - display that we're capturing page state
 	if toolCall.Name == "snapshot" || strings.HasSuffix(toolCall.Name, "__snapshot") {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 
 		// In verbose mode, show what we're snapshotting
 		if p.mode == OutputModeVerbose {
-			fmt.Fprintf(p.writer, "  %sCapturing page state...%s\n", c.LabelDim, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sCapturing page state...%s\n", p.indent(1), c.LabelDim, c.Reset)
 		}
 		return
 	}
@@ -1126,22 +3120,22 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	// Handle Context7 MCP tools - specialized rendering for library documentation lookups
 	// Tools: mcp__context7__resolve-library-id, mcp__context7__query-docs
 	if toolCall.Name == "mcp__context7__resolve-library-id" {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 
 		// Show library name if present
 		if libraryName, ok := inputMap["libraryName"].(string); ok && libraryName != "" {
-			fmt.Fprintf(p.writer, "  %sLibrary:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, libraryName, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sLibrary:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, libraryName, c.Reset)
 		}
 
 		// Show library ID if present
 		if libraryID, ok := inputMap["id"].(string); ok && libraryID != "" {
-			fmt.Fprintf(p.writer, "  %sID:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, libraryID, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sID:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, libraryID, c.Reset)
 		}
 
 		// Show version if present (in verbose mode)
 		if p.mode == OutputModeVerbose {
 			if version, ok := inputMap["version"].(string); ok && version != "" {
-				fmt.Fprintf(p.writer, "  %sVersion:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, version, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sVersion:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, version, c.Reset)
 			}
 		}
 
@@ -1149,24 +3143,21 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	}
 
 	if toolCall.Name == "mcp__context7__query-docs" {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset)
 
 		// Show library ID if present
 		if libraryID, ok := inputMap["id"].(string); ok && libraryID != "" {
-			fmt.Fprintf(p.writer, "  %sLibrary ID:%s %s%s%s\n", c.LabelDim, c.Reset, c.ValueBright, libraryID, c.Reset)
+			fmt.Fprintf(p.writer, "%s%sLibrary ID:%s %s%s%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, libraryID, c.Reset)
 		}
 
 		// Show query if present
 		if query, ok := inputMap["query"].(string); ok && query != "" {
-			// Truncate query if too long (show first 120 chars)
-			displayQuery := query
-			if len(query) > 120 {
-				displayQuery = query[:117] + "..."
-			}
-			fmt.Fprintf(p.writer, "  %sQuery:%s %s\n", c.LabelDim, c.Reset, displayQuery)
+			// Truncate query if too long
+			displayQuery, truncated := p.truncate(query)
+			fmt.Fprintf(p.writer, "%s%sQuery:%s %s\n", p.indent(1), c.LabelDim, c.Reset, displayQuery)
 
 			// In verbose mode, show full query if it was truncated
-			if p.mode == OutputModeVerbose && len(query) > 120 {
+			if p.mode == OutputModeVerbose && truncated {
 				// Wrap long queries to 80 chars per line
 				words := strings.Fields(query)
 				var lines []string
@@ -1186,9 +3177,9 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 					lines = append(lines, currentLine.String())
 				}
 
-				fmt.Fprintf(p.writer, "  %sFull query:%s\n", c.LabelDim, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sFull query:%s\n", p.indent(1), c.LabelDim, c.Reset)
 				for _, line := range lines {
-					fmt.Fprintf(p.writer, "    %s\n", line)
+					fmt.Fprintf(p.writer, "%s%s\n", p.indent(2), line)
 				}
 			}
 		}
@@ -1196,7 +3187,7 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 		// Show limit if present (in verbose mode)
 		if p.mode == OutputModeVerbose {
 			if limit, ok := inputMap["limit"].(float64); ok && limit > 0 {
-				fmt.Fprintf(p.writer, "  %sLimit:%s %s%.0f%s\n", c.LabelDim, c.Reset, c.ValueBright, limit, c.Reset)
+				fmt.Fprintf(p.writer, "%s%sLimit:%s %s%.0f%s\n", p.indent(1), c.LabelDim, c.Reset, c.ValueBright, limit, c.Reset)
 			}
 		}
 
@@ -1213,24 +3204,193 @@ func (p *OutputProcessor) printToolCall(toolCall *ToolCall) {
 	statusStr := string(toolCall.Status)
 
 	if description != "" {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s: %s %s[%s]%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset, description, c.ToolStatus, statusStr, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s: %s %s[%s]%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset, description, c.ToolStatus, statusStr, c.Reset)
 	} else {
-		fmt.Fprintf(p.writer, "%s→%s %s%s%s %s[%s]%s\n", c.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset, c.ToolStatus, statusStr, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s%s %s[%s]%s\n", c.ToolArrow, g.ToolArrow, c.Reset, c.ToolName, displayName, c.Reset, c.ToolStatus, statusStr, c.Reset)
+	}
+
+	// Show full input in verbose mode, unless --verbose-no-raw asked to skip the dump
+	if p.mode == OutputModeVerbose && !p.noRawInput && len(toolCall.Input) > 0 {
+		// Reuse one buffer across calls - sessions can have thousands of tool calls
+		p.indentBuf.Reset()
+		if err := json.Indent(&p.indentBuf, toolCall.Input, p.indent(1), p.indent(1)); err == nil {
+			fmt.Fprintf(p.writer, "%sInput:\n%s\n", p.indent(1), p.indentBuf.Bytes())
+		}
+	}
+}
+
+// maxTodoBarWidth caps the --todo-progress bar; longer lists are scaled down to fit
+const maxTodoBarWidth = 20
+
+// printTodoProgress prints a completion bar for the last TodoWrite list, e.g. [███░░] 3/5 done
+func (p *OutputProcessor) printTodoProgress() {
+	completed, total := p.state.TodoProgress()
+	if total == 0 {
+		return
+	}
+
+	width := min(total, maxTodoBarWidth)
+	filled := completed * width / total
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%s[%s%s%s%s%s%s] %d/%d done\n", p.indent(1),
+		c.Success, strings.Repeat("█", filled), c.Reset,
+		c.LabelDim, strings.Repeat("░", width-filled), c.Reset,
+		completed, total)
+}
+
+// formatTimeout formats a tool timeout given in milliseconds, e.g. 120s or 1500ms
+func formatTimeout(ms float64) string {
+	if ms >= 1000 && int64(ms)%1000 == 0 {
+		return fmt.Sprintf("%ds", int64(ms)/1000)
+	}
+	return fmt.Sprintf("%.0fms", ms)
+}
+
+// toolPathKeys maps file tools to the input key holding their path
+var toolPathKeys = map[string]string{
+	"Read":         "file_path",
+	"Write":        "file_path",
+	"Edit":         "file_path",
+	"MultiEdit":    "file_path",
+	"LS":           "path",
+	"NotebookRead": "notebook_path",
+	"NotebookEdit": "notebook_path",
+}
+
+// fileToolOps maps the file tools that --files-summary lists to how they use the file
+var fileToolOps = map[string]FileOp{
+	"Read":         FileOpRead,
+	"NotebookRead": FileOpRead,
+	"Write":        FileOpWrite,
+	"Edit":         FileOpEdit,
+	"MultiEdit":    FileOpEdit,
+	"NotebookEdit": FileOpEdit,
+}
+
+// trackFile records the file a file tool call uses, for --files-summary
+func (p *OutputProcessor) trackFile(toolCall *ToolCall) {
+	op, ok := fileToolOps[toolCall.Name]
+	if !ok {
+		return
+	}
+	path, _ := toolCall.InputMap()[toolPathKeys[toolCall.Name]].(string)
+	p.state.TouchFile(path, op)
+}
+
+// printFilesSummary lists the files the session's file tools used, sorted, each tagged with
+// how it was used: R(ead), W(rite) or E(dit)
+func (p *OutputProcessor) printFilesSummary() {
+	if !p.filesSummary || p.mode == OutputModeQuiet || len(p.state.Files) == 0 {
+		return
+	}
+
+	paths := make([]string, 0, len(p.state.Files))
+	for path := range p.state.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	c := p.colors
+	fmt.Fprintf(p.writer, "%sFiles touched:%s\n", c.LabelDim, c.Reset)
+	for _, path := range paths {
+		fmt.Fprintf(p.writer, "%s%s%-3s%s %s%s%s\n", p.indent(1), c.ValueBright, p.state.Files[path].Tags(), c.Reset, c.FilePath, path, c.Reset)
+	}
+}
+
+// toolTarget returns what a tool call acts on: the command for Bash, or the path for file tools.
+// isPath reports which one it is; an empty target means the tool has neither.
+func toolTarget(toolCall *ToolCall) (target string, isPath bool) {
+	inputMap := toolCall.InputMap()
+
+	if toolCall.Name == "Bash" {
+		command, _ := inputMap["command"].(string)
+		return command, false
+	}
+
+	if key, ok := toolPathKeys[toolCall.Name]; ok {
+		path, _ := inputMap[key].(string)
+		return path, true
+	}
+	return "", false
+}
+
+// printCopyable prints a Bash command as "$ <command>", or a file tool's resolved path,
+// on its own uncolored line so it can be selected and pasted as-is
+func (p *OutputProcessor) printCopyable(toolCall *ToolCall) {
+	target, isPath := toolTarget(toolCall)
+	if target == "" {
+		return
+	}
+
+	if !isPath {
+		fmt.Fprintf(p.writer, "$ %s\n", target)
+		return
+	}
+	if abs, err := filepath.Abs(target); err == nil {
+		target = abs
 	}
+	fmt.Fprintln(p.writer, target)
+}
+
+// printConfirmWarning prints a prominent "about to run" line for tools listed in --confirm-tools.
+// This is advisory only: claude runs the tool regardless, ccv just makes it stand out.
+func (p *OutputProcessor) printConfirmWarning(toolCall *ToolCall) {
+	c := p.colors
+	target, _ := toolTarget(toolCall)
+	if target == "" {
+		fmt.Fprintf(p.writer, "%s⚠ about to run %s%s\n", c.Warning, toolCall.Name, c.Reset)
+		return
+	}
+	fmt.Fprintf(p.writer, "%s⚠ about to run %s: %s%s\n", c.Warning, toolCall.Name, target, c.Reset)
+}
+
+// denialRecord is one line of the --denials-out log
+type denialRecord struct {
+	Timestamp string `json:"timestamp"` // RFC 3339, when the result arrived
+	SessionID string `json:"session_id,omitempty"`
+	ToolName  string `json:"tool_name"`
+	Reason    string `json:"reason,omitempty"`
+}
 
-	// Show full input in verbose mode
-	if p.mode == OutputModeVerbose && len(toolCall.Input) > 0 {
-		var prettyJSON bytes.Buffer
-		if err := json.Indent(&prettyJSON, toolCall.Input, "  ", "  "); err == nil {
-			fmt.Fprintf(p.writer, "  Input:\n%s\n", prettyJSON.String())
+// writeDenials appends a JSONL record for each permission denial in a result
+func writeDenials(w io.Writer, result *Result) error {
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	for _, denial := range result.PermissionDenials {
+		data, err := json.Marshal(denialRecord{
+			Timestamp: timestamp,
+			SessionID: result.SessionID,
+			ToolName:  denial.ToolName,
+			Reason:    denial.Reason,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 // handleResult processes the final result message
 func (p *OutputProcessor) handleResult(msg *Result) {
 	// Store the result for final summary
 	p.result = msg
+	p.flushReads()
+	p.closeText()
+
+	if p.denialsOut != nil {
+		if err := writeDenials(p.denialsOut, msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing permission denials: %v\n", err)
+		}
+	}
+
+	// Without streamed text (e.g. a one-shot --print run) the answer only exists in the result
+	if msg.Result != "" && !p.textShown {
+		fmt.Fprintln(p.writer, p.highlight(strings.TrimRight(msg.Result, "\n")))
+		p.space(spacingAfterText)
+	}
 
 	if msg.Usage != nil {
 		p.state.TotalTokens = msg.Usage
@@ -1239,7 +3399,8 @@ func (p *OutputProcessor) handleResult(msg *Result) {
 
 // printAgentContext prints the current agent context with indentation
 func (p *OutputProcessor) printAgentContext() {
-	if p.mode == OutputModeQuiet {
+	// Plain output leaves nesting to indentation alone
+	if p.mode == OutputModeQuiet || p.mode == OutputModePlain {
 		return
 	}
 
@@ -1248,23 +3409,28 @@ func (p *OutputProcessor) printAgentContext() {
 		return
 	}
 
+	// The root agent's context is noise until a subagent exists to distinguish it from
+	if agent.Depth == 0 && (p.hideRootAgent || !p.state.HasSubagents) {
+		return
+	}
+
 	c := p.colors
 
 	// Create indentation based on depth
-	indent := strings.Repeat("  ", agent.Depth)
+	indent := p.indent(agent.Depth)
 
 	// Format agent context
 	fmt.Fprintf(p.writer, "%s%s[%s%s%s: %s%s%s]%s\n", indent, c.AgentBrackets, c.AgentType, agent.Type, c.AgentBrackets, c.AgentStatus, agent.Status, c.AgentBrackets, c.Reset)
 
 	// Show description if present and in verbose mode
 	if p.mode == OutputModeVerbose && agent.Description != "" {
-		fmt.Fprintf(p.writer, "%s  %s%s%s\n", indent, c.LabelDim, agent.Description, c.Reset)
+		fmt.Fprintf(p.writer, "%s%s%s%s%s\n", indent, p.indent(1), c.LabelDim, agent.Description, c.Reset)
 	}
 }
 
 // printFinalSummary prints the final result summary with tokens, cost, duration, and turns
 func (p *OutputProcessor) printFinalSummary() {
-	if p.mode == OutputModeQuiet {
+	if p.mode == OutputModeQuiet || p.rawOutput() {
 		return
 	}
 
@@ -1277,10 +3443,23 @@ func (p *OutputProcessor) printFinalSummary() {
 		return
 	}
 
-	c := p.colors
+	// A custom template replaces the default layout
+	if p.summaryTemplate != nil {
+		p.space(spacingBeforeSummary)
+		var buf bytes.Buffer
+		if err := p.summaryTemplate.Execute(&buf, p.summaryData()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rendering summary template: %v\n", err)
+			return
+		}
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprint(p.writer, buf.String())
+		return
+	}
 
-	fmt.Fprintln(p.writer)
-	fmt.Fprintf(p.writer, "%s───────────────────────────────────────%s\n", c.Separator, c.Reset)
+	c := p.colors
+	var rows []summaryRow
 
 	// Token summary
 	if hasTokens {
@@ -1289,21 +3468,28 @@ func (p *OutputProcessor) printFinalSummary() {
 			tokens.TotalTokens = tokens.InputTokens + tokens.OutputTokens
 		}
 
-		fmt.Fprintf(p.writer, "%sTokens:%s %s%d%s total %s(%d in, %d out)%s\n",
-			c.LabelDim, c.Reset, c.ValueBright, tokens.TotalTokens, c.Reset, c.LabelDim, tokens.InputTokens, tokens.OutputTokens, c.Reset)
+		rows = append(rows, summaryRow{"Tokens", fmt.Sprintf("%s%d%s total %s(%d in, %d out)%s",
+			c.ValueBright, tokens.TotalTokens, c.Reset, c.LabelDim, tokens.InputTokens, tokens.OutputTokens, c.Reset)})
 
 		// Cache info
 		if tokens.CacheReadInputTokens > 0 || tokens.CacheCreationInputTokens > 0 {
-			fmt.Fprintf(p.writer, "%sCache:%s ", c.LabelDim, c.Reset)
+			var cache string
 			if tokens.CacheReadInputTokens > 0 {
-				fmt.Fprintf(p.writer, "%s%d%s read", c.ValueBright, tokens.CacheReadInputTokens, c.Reset)
+				cache = fmt.Sprintf("%s%d%s read", c.ValueBright, tokens.CacheReadInputTokens, c.Reset)
 				if tokens.CacheCreationInputTokens > 0 {
-					fmt.Fprintf(p.writer, ", %s%d%s created", c.ValueBright, tokens.CacheCreationInputTokens, c.Reset)
+					cache += fmt.Sprintf(", %s%d%s created", c.ValueBright, tokens.CacheCreationInputTokens, c.Reset)
 				}
 			} else if tokens.CacheCreationInputTokens > 0 {
-				fmt.Fprintf(p.writer, "%s%d%s created", c.ValueBright, tokens.CacheCreationInputTokens, c.Reset)
+				cache = fmt.Sprintf("%s%d%s created", c.ValueBright, tokens.CacheCreationInputTokens, c.Reset)
 			}
-			fmt.Fprintln(p.writer)
+			rows = append(rows, summaryRow{"Cache", cache})
+		}
+
+		// The cache TTL tiers are priced differently, so verbose mode breaks creation down by tier
+		if created := tokens.CacheCreation; p.mode == OutputModeVerbose && created != nil &&
+			(created.Ephemeral5mInputTokens > 0 || created.Ephemeral1hInputTokens > 0) {
+			rows = append(rows, summaryRow{"Cache created", fmt.Sprintf("%s%d%s (5m), %s%d%s (1h)",
+				c.ValueBright, created.Ephemeral5mInputTokens, c.Reset, c.ValueBright, created.Ephemeral1hInputTokens, c.Reset)})
 		}
 	}
 
@@ -1311,29 +3497,167 @@ func (p *OutputProcessor) printFinalSummary() {
 	if p.result != nil {
 		// Cost
 		if p.result.TotalCost > 0 {
-			fmt.Fprintf(p.writer, "%sCost:%s %s$%.4f%s\n", c.LabelDim, c.Reset, c.ValueBright, p.result.TotalCost, c.Reset)
+			rows = append(rows, summaryRow{"Cost", fmt.Sprintf("%s$%.4f%s", c.ValueBright, p.result.TotalCost, c.Reset)})
 		}
 
 		// Duration
 		if p.result.DurationMS > 0 {
-			duration := p.result.DurationMS
-			if duration >= 60000 {
-				// Show as minutes:seconds for durations >= 1 minute
-				mins := duration / 60000
-				secs := (duration % 60000) / 1000
-				fmt.Fprintf(p.writer, "%sDuration:%s %s%dm %ds%s\n", c.LabelDim, c.Reset, c.ValueBright, mins, secs, c.Reset)
-			} else if duration >= 1000 {
-				// Show as seconds for durations >= 1 second
-				fmt.Fprintf(p.writer, "%sDuration:%s %s%.1fs%s\n", c.LabelDim, c.Reset, c.ValueBright, float64(duration)/1000, c.Reset)
-			} else {
-				// Show as milliseconds for very short durations
-				fmt.Fprintf(p.writer, "%sDuration:%s %s%dms%s\n", c.LabelDim, c.Reset, c.ValueBright, duration, c.Reset)
-			}
+			rows = append(rows, summaryRow{"Duration", fmt.Sprintf("%s%s%s", c.ValueBright, formatDurationMS(p.result.DurationMS), c.Reset)})
 		}
 
 		// Turns
 		if p.result.NumTurns > 0 {
-			fmt.Fprintf(p.writer, "%sTurns:%s %s%d%s\n", c.LabelDim, c.Reset, c.ValueBright, p.result.NumTurns, c.Reset)
+			rows = append(rows, summaryRow{"Turns", fmt.Sprintf("%s%d%s", c.ValueBright, p.result.NumTurns, c.Reset)})
+		}
+
+		// Tools the user's permission settings blocked
+		if len(p.result.PermissionDenials) > 0 {
+			names := make([]string, len(p.result.PermissionDenials))
+			for i, denial := range p.result.PermissionDenials {
+				names[i] = FormatMCPToolName(denial.ToolName)
+			}
+			rows = append(rows, summaryRow{"Denied", fmt.Sprintf("%s%s%s", c.Warning, strings.Join(names, ", "), c.Reset)})
+		}
+
+		// Service tier affects pricing - show non-default tiers, or any tier in verbose mode
+		if p.result.Usage != nil && p.result.Usage.ServiceTier != "" {
+			tier := p.result.Usage.ServiceTier
+			if (tier != "standard" && tier != "default") || p.mode == OutputModeVerbose {
+				rows = append(rows, summaryRow{"Tier", fmt.Sprintf("%s%s%s", c.ValueBright, tier, c.Reset)})
+			}
+		}
+	}
+
+	// What the session did: calls of each tool, most used first
+	for _, usage := range p.state.ToolUsage() {
+		value := fmt.Sprintf("%s%d%s", c.ValueBright, usage.Calls, c.Reset)
+		if usage.Failed > 0 {
+			value += fmt.Sprintf(" %s(%d failed)%s", c.Error, usage.Failed, c.Reset)
+		}
+		rows = append(rows, summaryRow{p.toolDisplayName(usage.Name), value})
+	}
+
+	p.space(spacingBeforeSummary)
+	p.printTimestamp()
+	p.printSummaryRows(rows)
+}
+
+// summaryRow is one label/value line of the final summary
+type summaryRow struct {
+	label string
+	value string // May contain color codes
+}
+
+// minSummaryValueWidth keeps summary values readable on very narrow terminals
+const minSummaryValueWidth = 20
+
+// printSummaryRows prints the summary separator and rows. Once the terminal width is known
+// (--safe-width or --width), the separator spans it, values line up in a second column, and
+// values too long for the line wrap beneath that column.
+func (p *OutputProcessor) printSummaryRows(rows []summaryRow) {
+	c := p.colors
+	width := p.summaryWidth
+
+	if width <= 0 {
+		if p.mode != OutputModePlain {
+			fmt.Fprintf(p.writer, "%s───────────────────────────────────────%s\n", c.Separator, c.Reset)
+		}
+		for _, row := range rows {
+			fmt.Fprintf(p.writer, "%s%s:%s %s\n", c.LabelDim, row.label, c.Reset, row.value)
+		}
+		return
+	}
+
+	if p.mode != OutputModePlain {
+		fmt.Fprintf(p.writer, "%s%s%s\n", c.Separator, strings.Repeat("─", width), c.Reset)
+	}
+
+	labelWidth := 0
+	for _, row := range rows {
+		labelWidth = max(labelWidth, len(row.label)+1)
+	}
+	valueWidth := max(width-labelWidth-1, minSummaryValueWidth)
+	for _, row := range rows {
+		lines := wrapWords(row.value, valueWidth)
+		fmt.Fprintf(p.writer, "%s%-*s%s %s\n", c.LabelDim, labelWidth, row.label+":", c.Reset, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(p.writer, "%s %s\n", strings.Repeat(" ", labelWidth), line)
+		}
+	}
+}
+
+// formatDurationMS formats a duration for the summary: 500ms, 5.0s, or 2m 5s
+func formatDurationMS(duration int64) string {
+	if duration >= 60000 {
+		// Show as minutes:seconds for durations >= 1 minute
+		return fmt.Sprintf("%dm %ds", duration/60000, (duration%60000)/1000)
+	}
+	if duration >= 1000 {
+		// Show as seconds for durations >= 1 second
+		return fmt.Sprintf("%.1fs", float64(duration)/1000)
+	}
+	// Show as milliseconds for very short durations
+	return fmt.Sprintf("%dms", duration)
+}
+
+// SummaryData holds the final summary values available to --summary-template
+type SummaryData struct {
+	TotalTokens         int
+	InputTokens         int
+	OutputTokens        int
+	CacheReadTokens     int
+	CacheCreationTokens int
+	CacheHitRate        float64 // Percentage of input tokens served from cache
+	Cost                float64 // USD
+	Duration            string  // Formatted like the default summary, e.g. 2.5s
+	DurationMS          int64
+	Turns               int
+	ServiceTier         string
+	SessionID           string
+	Model               string
+}
+
+// ParseSummaryTemplate parses a --summary-template and checks it against SummaryData,
+// so unknown fields are reported at startup rather than after the session
+func ParseSummaryTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("summary").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, SummaryData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// summaryData collects the values shown in the final summary
+func (p *OutputProcessor) summaryData() SummaryData {
+	data := SummaryData{
+		SessionID: p.state.SessionID,
+		Model:     p.state.Model,
+	}
+
+	if tokens := p.state.TotalTokens; tokens != nil {
+		data.InputTokens = tokens.InputTokens
+		data.OutputTokens = tokens.OutputTokens
+		data.TotalTokens = tokens.TotalTokens
+		if data.TotalTokens == 0 {
+			data.TotalTokens = tokens.InputTokens + tokens.OutputTokens
+		}
+		data.CacheReadTokens = tokens.CacheReadInputTokens
+		data.CacheCreationTokens = tokens.CacheCreationInputTokens
+		if allInput := tokens.InputTokens + tokens.CacheReadInputTokens + tokens.CacheCreationInputTokens; allInput > 0 {
+			data.CacheHitRate = float64(tokens.CacheReadInputTokens) / float64(allInput) * 100
 		}
+		data.ServiceTier = tokens.ServiceTier
 	}
+
+	if p.result != nil {
+		data.Cost = p.result.TotalCost
+		data.DurationMS = p.result.DurationMS
+		data.Duration = formatDurationMS(p.result.DurationMS)
+		data.Turns = p.result.NumTurns
+	}
+
+	return data
 }
@@ -3,8 +3,15 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestNewOutputProcessor(t *testing.T) {
@@ -57,6 +64,13 @@ func TestNewOutputProcessor(t *testing.T) {
 			quiet:    true,
 			expected: OutputModeQuiet,
 		},
+		{
+			name:     "plain format",
+			format:   "plain",
+			verbose:  false,
+			quiet:    false,
+			expected: OutputModePlain,
+		},
 	}
 
 	for _, tt := range tests {
@@ -222,6 +236,21 @@ func TestPrintToolCall_Bash(t *testing.T) {
 	}
 }
 
+func TestPrintToolCall_BashDescriptionOnly(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+
+	toolCall := createTestToolCall("tool_1", "Bash", map[string]interface{}{
+		"description": "List files",
+	})
+
+	p.printToolCall(toolCall)
+
+	output := w.String()
+	if output != "→ Bash: List files\n" {
+		t.Errorf("expected the description under the Bash tool, got: %q", output)
+	}
+}
+
 func TestPrintToolCall_Read(t *testing.T) {
 	p, w := newTestOutputProcessor(OutputModeText)
 
@@ -580,6 +609,29 @@ func TestHandleResult(t *testing.T) {
 	}
 }
 
+// TestHandleResult_RendersResultText tests the result's text is shown when nothing was streamed
+func TestHandleResult_RendersResultText(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+
+	result := createTestResult(0.05, 5000, 1)
+	result.Result = "The project is a CLI wrapper for claude.\n"
+	p.handleResult(result)
+	p.printFinalSummary()
+
+	output := w.String()
+	if !strings.HasPrefix(output, "The project is a CLI wrapper for claude.\n") {
+		t.Errorf("expected result text before the summary, got: %q", output)
+	}
+
+	// Text that already streamed is not repeated
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "The project is a CLI wrapper for claude."}, nil))
+	p.handleResult(result)
+	if strings.Count(w.String(), "CLI wrapper") != 1 {
+		t.Errorf("expected streamed text not to be printed again, got: %q", w.String())
+	}
+}
+
 func TestPrintFinalSummary(t *testing.T) {
 	p, w := newTestOutputProcessor(OutputModeText)
 
@@ -652,11 +704,132 @@ func TestPrintDiff(t *testing.T) {
 	}
 }
 
+// TestPrintDiff_Word tests --diff=word highlights only the changed words of an edit
+func TestPrintDiff_Word(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.diffMode = diffModeWord
+
+	p.printDiff("total := count * price\nreturn total", "total := qty * price\nreturn total, nil")
+	want := "  total := [-count-]{+qty+} * price\n  return total{+, nil+}\n"
+	if w.String() != want {
+		t.Errorf("expected inline word changes\nwant: %q\ngot:  %q", want, w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.colors = DefaultScheme()
+	p.diffMode = diffModeWord
+	c := p.colors
+	p.printDiff("x := 1", "y := 1")
+	want = "  " + c.DiffRemove + "x" + c.Reset + c.DiffAdd + "y" + c.Reset + " := 1\n"
+	if w.String() != want {
+		t.Errorf("expected colored spans\nwant: %q\ngot:  %q", want, w.String())
+	}
+
+	// An edit too large to align word by word falls back to the line diff
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.diffMode = diffModeWord
+	large := strings.Repeat("word ", maxWordDiffTokens)
+	p.printDiff(large, large+"more")
+	if want := "  - " + large + "\n  + " + large + "more\n"; w.String() != want {
+		t.Errorf("expected the line diff for a large edit\nwant: %q\ngot:  %q", want, w.String())
+	}
+}
+
+// TestPrintToolCall_UnifiedDiff tests --diff=unified prints one patch per file, combining a MultiEdit's edits
+func TestPrintToolCall_UnifiedDiff(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.diffMode = diffModeUnified
+	p.diffContext = 1
+
+	p.printToolCall(createTestToolCall("tool_1", "MultiEdit", map[string]interface{}{
+		"file_path": "cmd/main.go",
+		"edits": []interface{}{
+			map[string]interface{}{"old_string": "a\nb\nc\nd\ne\nf\ng", "new_string": "a\nB\nc\nd\ne\nF\ng"},
+			map[string]interface{}{"old_string": "return nil", "new_string": "log.Print(err)\nreturn err"},
+		},
+	}))
+
+	want := "→ MultiEdit: cmd/main.go\n" +
+		"--- a/cmd/main.go\n+++ b/cmd/main.go\n" +
+		"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n" +
+		"@@ -5,3 +5,3 @@\n e\n-f\n+F\n g\n" +
+		"@@ -8,1 +8,2 @@\n-return nil\n+log.Print(err)\n+return err\n"
+	if w.String() != want {
+		t.Errorf("unexpected patch\nwant: %q\ngot:  %q", want, w.String())
+	}
+}
+
+// TestPrintToolCall_UnifiedDiffApplies tests a --diff=unified patch is numbered against the file
+// and named relative to the session's directory, so git apply takes it
+func TestPrintToolCall_UnifiedDiffApplies(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cmd", "main.go")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	source := "package main\n\nimport \"log\"\n\nfunc run() error {\n\terr := step()\n\tif err != nil {\n\t\treturn nil\n\t}\n\treturn nil\n}\n\nfunc step() error {\n\treturn nil\n}\n"
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.diffMode = diffModeUnified
+	init := createTestSystemInit("test", "model")
+	init.CwdPath = dir
+	p.state.InitializeSession(init)
+	p.printToolCall(createTestToolCall("tool_1", "MultiEdit", map[string]interface{}{
+		"file_path": path,
+		"edits": []interface{}{
+			map[string]interface{}{"old_string": "\t\treturn nil", "new_string": "\t\tlog.Print(err)\n\t\treturn err"},
+			map[string]interface{}{"old_string": "func step() error {\n\treturn nil", "new_string": "func step() error {\n\treturn log.Output(1, \"step\")"},
+		},
+	}))
+
+	_, patch, _ := strings.Cut(w.String(), "\n")
+	if !strings.HasPrefix(patch, "--- a/cmd/main.go\n+++ b/cmd/main.go\n@@ -5,") {
+		t.Fatalf("expected a patch for cmd/main.go numbered by the file, got: %q", patch)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "edit.patch"), []byte(patch), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "apply", "--check", "edit.patch")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("git apply --check failed: %v\n%s\npatch:\n%s", err, out, patch)
+	}
+}
+
+// TestPrintToolCall_UnifiedDiffReplaceAll tests a replace_all edit's patch covers every occurrence
+func TestPrintToolCall_UnifiedDiffReplaceAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("a := oldName()\nb\nc\nd\ne\nf\nreturn oldName\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.diffMode = diffModeUnified
+	p.diffContext = -1
+	p.printToolCall(createTestToolCall("tool_1", "Edit", map[string]interface{}{
+		"file_path": path, "old_string": "oldName", "new_string": "newName", "replace_all": true,
+	}))
+
+	_, patch, _ := strings.Cut(w.String(), "\n")
+	_, hunks, _ := strings.Cut(patch, "@@")
+	want := " -1,1 +1,1 @@\n-a := oldName()\n+a := newName()\n@@ -7,1 +7,1 @@\n-return oldName\n+return newName\n"
+	if hunks != want {
+		t.Errorf("expected a hunk for each occurrence\nwant: %q\ngot:  %q", want, hunks)
+	}
+}
+
 func TestPrintAgentContext(t *testing.T) {
 	p, w := newTestOutputProcessor(OutputModeText)
 
 	// Initialize session to create root agent
 	p.state.InitializeSession(createTestSystemInit("test", "model"))
+	p.state.HasSubagents = true
 	w.Reset()
 
 	p.printAgentContext()
@@ -1127,6 +1300,32 @@ func TestPrintToolCall_WebFetch_Verbose(t *testing.T) {
 	}
 }
 
+// TestPrintToolCall_Truncate tests --truncate sets where long tool inputs are cut, and 0 disables it
+func TestPrintToolCall_Truncate(t *testing.T) {
+	prompt := strings.Repeat("word ", 50)
+	toolCall := createTestToolCall("tool_fetch", "WebFetch", map[string]interface{}{"url": "https://example.com", "prompt": prompt})
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.printToolCall(toolCall)
+	if !strings.Contains(w.String(), "Prompt: "+prompt[:117]+"...\n") {
+		t.Errorf("expected the prompt cut at 120 characters by default, got: %q", w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.truncateAt = 20
+	p.printToolCall(toolCall)
+	if !strings.Contains(w.String(), "Prompt: word word word wo...\n") {
+		t.Errorf("expected the prompt cut at 20 characters, got: %q", w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.truncateAt = -1
+	p.printToolCall(toolCall)
+	if !strings.Contains(w.String(), "Prompt: "+prompt+"\n") {
+		t.Errorf("expected the whole prompt with truncation off, got: %q", w.String())
+	}
+}
+
 // TestPrintToolCall_LS tests the LS tool formatting
 func TestPrintToolCall_LS(t *testing.T) {
 	p, w := newTestOutputProcessor(OutputModeText)
@@ -1446,6 +1645,7 @@ func TestPrintAgentContext_VerboseMode(t *testing.T) {
 
 	p.state.InitializeSession(createTestSystemInit("test", "model"))
 	p.state.RootAgent.Description = "Main agent doing work"
+	p.state.HasSubagents = true
 	w.Reset()
 
 	p.printAgentContext()
@@ -1551,6 +1751,99 @@ func TestPrintFinalSummary_CacheInfo(t *testing.T) {
 	}
 }
 
+// TestPrintFinalSummary_CacheCreationTiers tests verbose mode breaks cache creation down by TTL
+func TestPrintFinalSummary_CacheCreationTiers(t *testing.T) {
+	for _, mode := range []OutputMode{OutputModeVerbose, OutputModeText} {
+		p, w := newTestOutputProcessor(mode)
+		for i, created := range []CacheCreation{{100, 50}, {50, 0}} {
+			msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Done."}})
+			msg.Message.ID = fmt.Sprintf("msg_%d", i)
+			msg.Message.Usage = &Usage{InputTokens: 10, OutputTokens: 5, CacheCreationInputTokens: 150, CacheCreation: &created}
+			p.handleAssistantMessage(msg)
+		}
+
+		p.printFinalSummary()
+
+		hasTiers := strings.Contains(w.String(), "Cache created: 150 (5m), 50 (1h)\n")
+		if mode == OutputModeVerbose && !hasTiers {
+			t.Errorf("expected the 5m/1h breakdown in verbose mode, got: %q", w.String())
+		}
+		if mode == OutputModeText && strings.Contains(w.String(), "(5m)") {
+			t.Errorf("expected no breakdown outside verbose mode, got: %q", w.String())
+		}
+	}
+}
+
+// TestPrintFilesSummary tests the files the file tools used are listed sorted, tagged by operation
+func TestPrintFilesSummary(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.filesSummary = true
+
+	p.printToolCall(createTestToolCall("tool_1", "Read", map[string]interface{}{"file_path": "/src/main.go"}))
+	p.printToolCall(createTestToolCall("tool_2", "Edit", map[string]interface{}{"file_path": "/src/app.go", "old_string": "a", "new_string": "b"}))
+	p.printToolCall(createTestToolCall("tool_3", "Bash", map[string]interface{}{"command": "go test"}))
+	w.Reset()
+
+	p.printFilesSummary()
+
+	want := "Files touched:\n  E   /src/app.go\n  R   /src/main.go\n"
+	if w.String() != want {
+		t.Errorf("expected %q, got: %q", want, w.String())
+	}
+
+	// Off unless asked for
+	p.filesSummary = false
+	w.Reset()
+	p.printFilesSummary()
+	if w.String() != "" {
+		t.Errorf("expected no summary without --files-summary, got: %q", w.String())
+	}
+}
+
+// TestProcessMessage_Timestamps tests --timestamps stamps each block with when its message was processed
+func TestProcessMessage_Timestamps(t *testing.T) {
+	for _, tt := range []struct {
+		style string
+		want  []string
+	}{
+		{timestampsClock, []string{"[14:03:07] [Session started: claude-sonnet-4-5]", "[14:03:08] Checking.", "[14:03:08] → Bash: ls", "[14:03:10]   main.go"}},
+		{timestampsRelative, []string{"[+0ms] [Session started: claude-sonnet-4-5]", "[+1.2s] Checking.", "[+1.2s] → Bash: ls", "[+3.5s]   main.go"}},
+	} {
+		p, w := newTestOutputProcessor(OutputModeText)
+		p.timestamps = tt.style
+		start := time.Date(2025, 1, 22, 14, 3, 7, 0, time.Local)
+		times := []time.Duration{0, 1200 * time.Millisecond, 3500 * time.Millisecond}
+		p.now = func() time.Time {
+			next := start.Add(times[0])
+			times = times[1:]
+			return next
+		}
+
+		p.processMessage(createTestSystemInit("session-ts", "claude-sonnet-4-5"))
+		p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", map[string]interface{}{"command": "ls"}))
+		p.processMessage(createTestAssistantMessage([]ContentBlock{
+			{Type: ContentBlockTypeText, Text: "Checking."},
+			*createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls"}),
+		}))
+		p.processMessage(createTestToolResultMessage(createTestToolResultBlock("tool_1", "main.go", false)))
+
+		for _, want := range tt.want {
+			if !strings.Contains(w.String(), want+"\n") {
+				t.Errorf("%s: expected %q, got: %q", tt.style, want, w.String())
+			}
+		}
+	}
+
+	// Quiet mode shows no stamps
+	p, w := newTestOutputProcessor(OutputModeQuiet)
+	p.timestamps = timestampsClock
+	p.processMessage(createTestSystemInit("session-ts", "claude-sonnet-4-5"))
+	p.printTimestamp()
+	if w.String() != "" {
+		t.Errorf("expected no timestamps in quiet mode, got: %q", w.String())
+	}
+}
+
 // TestHandleProcessMessages_PanicRecovery tests panic recovery in ProcessMessages
 func TestHandleProcessMessages_PanicRecovery(t *testing.T) {
 	messages := make(chan interface{}, 10)
@@ -1605,6 +1898,50 @@ func TestHandleContentBlock_ToolUseWithNilInput(t *testing.T) {
 	p.processContentBlock(block)
 }
 
+// TestHandleReadResult tests Read results show a line count, a numbered preview in verbose mode,
+// and no content when flagged as an image
+func TestHandleReadResult(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 12; i++ {
+		lines = append(lines, fmt.Sprintf("%6d→line %d", i, i))
+	}
+	content := strings.Join(lines, "\n") + "\n"
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	toolCall := createTestToolCall("tool_1", "Read", map[string]interface{}{"file_path": "main.go"})
+	handleReadResult(p, toolCall, createTestToolResultBlock("tool_1", content, false))
+	if w.String() != "  ✓ Read 12 lines\n" {
+		t.Errorf("expected a line count, got: %q", w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeVerbose)
+	handleReadResult(p, toolCall, createTestToolResultBlock("tool_1", content, false))
+	output := w.String()
+	if !strings.Contains(output, "     1 line 1\n") || !strings.Contains(output, "    10 line 10\n") {
+		t.Errorf("expected the first lines renumbered without Read's prefixes, got: %q", output)
+	}
+	if strings.Contains(output, "line 11") || !strings.Contains(output, "… 2 more lines") {
+		t.Errorf("expected the preview capped at %d lines, got: %q", readPreviewLines, output)
+	}
+
+	// Read from an offset keeps the file's line numbers
+	p, w = newTestOutputProcessor(OutputModeVerbose)
+	handleReadResult(p, toolCall, createTestToolResultBlock("tool_1", "    98→func main() {\n    99→\trun()\n   100→}\n", false))
+	if want := "     98 func main() {\n     99 \trun()\n    100 }\n"; !strings.HasSuffix(w.String(), want) {
+		t.Errorf("expected lines numbered from 98\nwant suffix: %q\ngot: %q", want, w.String())
+	}
+
+	// The image flag arrives on the user message carrying the result
+	p, w = newTestOutputProcessor(OutputModeVerbose)
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_2", "Read", map[string]interface{}{"file_path": "logo.png"}))
+	image := createTestToolResultMessage(createTestToolResultBlock("tool_2", "\x89PNG\x1a", false))
+	image.ToolUseResult = &ToolUseResult{IsImage: true}
+	p.processMessage(image)
+	if w.String() != "  ✓ image captured [image]\n" {
+		t.Errorf("expected image content left out, got: %q", w.String())
+	}
+}
+
 // TestHandleDefaultResult tests the default tool result handler
 func TestHandleDefaultResult(t *testing.T) {
 	p, w := newTestOutputProcessor(OutputModeText)
@@ -1688,6 +2025,79 @@ func TestProcessToolResult_TaskResultSwitchesParent(t *testing.T) {
 	}
 }
 
+// TestProcessToolResult_TaskResultFailed tests a Task error result marks the child agent failed
+func TestProcessToolResult_TaskResultFailed(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+	p.state.AddOrUpdateToolCall(createTestToolCall("task_tool", "Task", map[string]interface{}{"subagent_type": "Explore"}))
+	child := p.state.CreateChildAgent("task_tool", "Explore", "Find the config loader")
+	p.state.SetCurrentAgent("task_tool")
+	w.Reset()
+
+	p.processMessage(createTestToolResultMessage(createTestToolResultBlock("task_tool", "agent crashed", true)))
+
+	if child.Status != AgentStatusFailed {
+		t.Errorf("expected child status 'failed', got '%s'", child.Status)
+	}
+	output := w.String()
+	if !strings.Contains(output, "[main: ") || !strings.Contains(output, "✗ [Explore] failed\n") {
+		t.Errorf("expected the switch back to main and a failed marker, got: %q", output)
+	}
+}
+
+// TestRenderToolUse_BackgroundTasks tests the running count of background Tasks as they start and complete
+func TestRenderToolUse_BackgroundTasks(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.handleSystemInit(createTestSystemInit("test", "model"))
+
+	for _, id := range []string{"task_1", "task_2"} {
+		block := createTestToolUseBlock(id, "Task", map[string]interface{}{
+			"subagent_type":     "Explore",
+			"description":       "Search " + id,
+			"run_in_background": true,
+		})
+		p.processMessage(createTestStreamEvent(StreamEventContentBlockStart, nil, block))
+		p.processContentBlock(block)
+	}
+	output := w.String()
+	if !strings.Contains(output, "[1 background task running]") || !strings.Contains(output, "[2 background tasks running]") {
+		t.Errorf("expected the running count to rise with each background Task, got: %q", output)
+	}
+
+	// The Task results only acknowledge the launches
+	w.Reset()
+	p.processToolResult(createTestToolResultBlock("task_1", "Launched agent in the background", false))
+	p.processToolResult(createTestToolResultBlock("task_2", "Launched agent in the background", false))
+	if strings.Contains(w.String(), "background task") || len(p.state.BackgroundTasks) != 2 {
+		t.Errorf("expected both Tasks still running after their launch results, got: %q", w.String())
+	}
+
+	// task_2's agent finishes with its final message
+	w.Reset()
+	parent := "task_2"
+	final := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Found it"}})
+	final.ParentToolUseID = &parent
+	final.Message.StopReason = "end_turn"
+	p.processMessage(final)
+	if !strings.Contains(w.String(), "[1 background task running]") {
+		t.Errorf("expected the running count to drop when a Task's agent finishes, got: %q", w.String())
+	}
+	if len(p.state.BackgroundTasks) != 1 || !p.state.BackgroundTasks["task_1"] {
+		t.Errorf("expected only task_1 still running, got: %v", p.state.BackgroundTasks)
+	}
+
+	// A blocking TaskOutput on task_1 returns once it is done
+	w.Reset()
+	taskOutput := createTestToolUseBlock("output_1", "TaskOutput", map[string]interface{}{"task_id": "task_1", "block": true})
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockStart, nil, taskOutput))
+	p.processContentBlock(taskOutput)
+	p.processToolResult(createTestToolResultBlock("output_1", "All done", false))
+	if !strings.Contains(w.String(), "[no background tasks running]") || len(p.state.BackgroundTasks) != 0 {
+		t.Errorf("expected no Tasks running after TaskOutput returned, got: %q", w.String())
+	}
+}
+
 // TestProcessMessages_ErrorChannelDoesNotStopProcessing tests that errors on the error channel don't stop message processing
 func TestProcessMessages_ErrorChannelDoesNotStopProcessing(t *testing.T) {
 	messages := make(chan interface{}, 10)
@@ -1712,6 +2122,43 @@ func TestProcessMessages_ErrorChannelDoesNotStopProcessing(t *testing.T) {
 	p.ProcessMessages(messages, errors)
 }
 
+// TestProcessMessages_ErrorsClosedFirst tests a closed errors channel is dropped from the select
+// rather than received from in a busy loop while messages is still open
+func TestProcessMessages_ErrorsClosedFirst(t *testing.T) {
+	messages := make(chan interface{})
+	errors := make(chan error)
+	close(errors)
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	done := make(chan struct{})
+	go func() {
+		p.ProcessMessages(messages, errors)
+		close(done)
+	}()
+
+	// A loop that spins never parks, so the goroutine must show up blocked in its select
+	parked := false
+	for i := 0; i < 100 && !parked; i++ {
+		time.Sleep(10 * time.Millisecond)
+		buf := make([]byte, 1<<20)
+		for _, g := range strings.Split(string(buf[:runtime.Stack(buf, true)]), "\n\n") {
+			if strings.Contains(g, "[select") && strings.Contains(g, ").ProcessMessages(") {
+				parked = true
+			}
+		}
+	}
+	if !parked {
+		t.Error("expected ProcessMessages to block waiting for messages once errors is closed")
+	}
+
+	messages <- createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Still rendering."}})
+	close(messages)
+	<-done
+	if !strings.Contains(w.String(), "Still rendering.") {
+		t.Errorf("expected messages after errors closed to render, got: %q", w.String())
+	}
+}
+
 // TestProcessMessages_MessagesChannelCloseTriggersFinalSummary tests that closing messages channel triggers printFinalSummary
 func TestProcessMessages_MessagesChannelCloseTriggersFinalSummary(t *testing.T) {
 	messages := make(chan interface{}, 10)
@@ -1845,6 +2292,43 @@ func TestHandleWebSearchResult_WithResults(t *testing.T) {
 	}
 }
 
+// TestHandleWebSearchResult_Structured tests search results render as a numbered list of title, URL and snippet
+func TestHandleWebSearchResult_Structured(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	toolCall := createTestToolCall("web_1", "WebSearch", map[string]interface{}{"query": "golang testing"})
+
+	content := "Web search results for query: \"golang testing\"\n\n" +
+		"Title: Testing in Go\nURL: https://go.dev/doc/testing\nSnippet: How to write tests with the testing package.\n\n" +
+		"Title: Table-driven tests\nURL: https://go.dev/wiki/TableDrivenTests\nDescription: A common pattern for test cases."
+	handleWebSearchResult(p, toolCall, createTestToolResultBlock("web_1", content, false))
+
+	want := "  1. Testing in Go\n" +
+		"     https://go.dev/doc/testing\n" +
+		"     How to write tests with the testing package.\n" +
+		"  2. Table-driven tests\n" +
+		"     https://go.dev/wiki/TableDrivenTests\n" +
+		"     A common pattern for test cases.\n"
+	if w.String() != want {
+		t.Errorf("expected numbered results\n%s\ngot:\n%s", want, w.String())
+	}
+
+	// Claude's links line, followed by its summary of the results
+	p, w = newTestOutputProcessor(OutputModeText)
+	content = "Web search results for query: \"golang testing\"\n\n" +
+		`Links: [{"title":"Testing in Go","url":"https://go.dev/doc/testing"},{"title":"testing package","url":"https://pkg.go.dev/testing"}]` +
+		"\n\nGo has built-in testing support."
+	handleWebSearchResult(p, toolCall, createTestToolResultBlock("web_1", content, false))
+
+	want = "  1. Testing in Go\n" +
+		"     https://go.dev/doc/testing\n" +
+		"  2. testing package\n" +
+		"     https://pkg.go.dev/testing\n" +
+		"  Go has built-in testing support.\n"
+	if w.String() != want {
+		t.Errorf("expected numbered links then the summary\n%s\ngot:\n%s", want, w.String())
+	}
+}
+
 // TestHandleWebSearchResult_EmptyResults tests WebSearch result handler with empty results
 func TestHandleWebSearchResult_EmptyResults(t *testing.T) {
 	p, w := newTestOutputProcessor(OutputModeText)
@@ -2527,3 +3011,1454 @@ func TestHandleStreamEvent_ContentBlockDelta_NilContentBlock(t *testing.T) {
 
 	p.handleContentBlockDelta(event)
 }
+
+// TestProcessMessages_LateStderr tests stderr written after claude's last message still renders
+func TestProcessMessages_LateStderr(t *testing.T) {
+	messages := make(chan interface{})
+	errors := make(chan error)
+	stderr := make(chan string)
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.stderr = stderr
+
+	go func() {
+		messages <- createTestSystemInit("test", "model")
+		close(messages)
+		// More lines than a buffered channel holds, all after stdout closed
+		for i := 0; i < 150; i++ {
+			stderr <- fmt.Sprintf("late line %d", i)
+		}
+		close(stderr)
+	}()
+
+	p.ProcessMessages(messages, errors)
+
+	if !strings.Contains(w.String(), "[stderr] late line 149\n") {
+		t.Errorf("expected stderr after the last message rendered, got: %q", w.String())
+	}
+}
+
+// TestProcessMessages_MergedStderr tests merged stderr lines render inline as dim [stderr] lines
+func TestProcessMessages_MergedStderr(t *testing.T) {
+	messages := make(chan interface{})
+	errors := make(chan error)
+	stderr := make(chan string)
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.colors = DefaultScheme()
+	p.stderr = stderr
+
+	// Unbuffered channels keep the feed order deterministic
+	go func() {
+		messages <- createTestSystemInit("test", "model")
+		stderr <- "warning: rate limited"
+		messages <- createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Text: "Hello"}, nil)
+		close(stderr)
+		close(messages)
+	}()
+
+	p.ProcessMessages(messages, errors)
+
+	output := w.String()
+	styled := Dim + "[stderr] warning: rate limited" + Reset
+	if !strings.Contains(output, styled) {
+		t.Fatalf("expected dim [stderr] line, got: %q", output)
+	}
+	sessionIdx := strings.Index(output, "Session started")
+	stderrIdx := strings.Index(output, styled)
+	textIdx := strings.Index(output, "Hello")
+	if !(sessionIdx < stderrIdx && stderrIdx < textIdx) {
+		t.Errorf("expected stderr line between session start and text, got: %q", output)
+	}
+}
+
+// TestHandleSystemInit_NoBannerNewline tests the banner spacing can be disabled via the spacing policy
+func TestHandleSystemInit_NoBannerNewline(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.spacing = defaultSpacing()
+	p.spacing[spacingAfterBanner] = 0
+
+	p.processMessage(createTestSystemInit("test", "claude-opus"))
+
+	output := w.String()
+	if !strings.Contains(output, "[Session started: claude-opus]") {
+		t.Errorf("expected banner, got: %q", output)
+	}
+	if strings.HasSuffix(output, "\n\n") {
+		t.Errorf("expected no trailing blank line after banner, got: %q", output)
+	}
+
+	// Default policy keeps the blank line
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.processMessage(createTestSystemInit("test", "claude-opus"))
+	if !strings.HasSuffix(w.String(), "\n\n") {
+		t.Errorf("expected trailing blank line with default spacing, got: %q", w.String())
+	}
+}
+
+// TestPrintFinalSummary_ServiceTier tests the service tier line renders from the result usage
+func TestPrintFinalSummary_ServiceTier(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"result","subtype":"success","total_cost_usd":0.02,"duration_ms":1200,"num_turns":1,"usage":{"input_tokens":100,"output_tokens":50,"service_tier":"priority"}}`))
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeVerbose)
+	p.processMessage(msg)
+	p.printFinalSummary()
+
+	if !strings.Contains(w.String(), "Tier: priority") {
+		t.Errorf("expected tier line in verbose summary, got: %q", w.String())
+	}
+
+	// The default tier is only worth mentioning in verbose mode
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.result = createTestResult(0.02, 1200, 1)
+	p.result.Usage.ServiceTier = "standard"
+	p.printFinalSummary()
+	if strings.Contains(w.String(), "Tier:") {
+		t.Errorf("expected default tier hidden outside verbose mode, got: %q", w.String())
+	}
+}
+
+// TestProcessToolResult_Folded tests folded results print a one-line summary instead of the body
+func TestProcessToolResult_Folded(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.foldResults = true
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", map[string]interface{}{"command": "ls"}))
+
+	p.processToolResult(createTestToolResultBlock("tool_1", "main.go\ntypes.go\noutput.go\n", false))
+
+	output := w.String()
+	if !strings.Contains(output, "✓ Bash: 3 lines of output (hidden)") {
+		t.Errorf("expected folded one-liner, got: %q", output)
+	}
+	if strings.Contains(output, "types.go") {
+		t.Errorf("expected result body to be hidden, got: %q", output)
+	}
+
+	// Verbose mode still shows the full output
+	p.mode = OutputModeVerbose
+	w.Reset()
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_2", "Bash", map[string]interface{}{"command": "ls"}))
+	p.processToolResult(createTestToolResultBlock("tool_2", "main.go\ntypes.go\n", false))
+	if !strings.Contains(w.String(), "types.go") {
+		t.Errorf("expected full output in verbose mode, got: %q", w.String())
+	}
+}
+
+// TestHandleAssistantMessage_ToolOnlyTurnsNoBlankLines tests tool-only turns don't accumulate blank lines
+func TestHandleAssistantMessage_ToolOnlyTurnsNoBlankLines(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("tool_%d", i)
+		p.state.AddOrUpdateToolCall(createTestToolCall(id, "Bash", nil))
+		p.handleAssistantMessage(createTestAssistantMessage([]ContentBlock{
+			{Type: ContentBlockTypeText, Text: "\n"},
+			{Type: ContentBlockTypeThinking, Thinking: ""},
+			*createTestToolUseBlock(id, "Bash", map[string]interface{}{"command": "echo " + id}),
+		}))
+	}
+
+	output := w.String()
+	if strings.Contains(output, "\n\n") {
+		t.Errorf("expected no blank lines between tool-only turns, got: %q", output)
+	}
+	if strings.Count(output, "→ Bash:") != 5 {
+		t.Errorf("expected 5 tool lines, got: %q", output)
+	}
+}
+
+// TestHandleStreamEvent_Highlight tests --highlight terms are marked even when split across deltas
+func TestHandleStreamEvent_Highlight(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.colors = DefaultScheme()
+	p.highlighter = NewHighlighter([]string{"needle"}, true)
+
+	for _, text := range []string{"Found the nee", "dle here\nand a NEEDLE", " there"} {
+		p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: text}, nil))
+	}
+	if strings.Contains(w.String(), "NEEDLE") {
+		t.Errorf("expected partial line to be held back until complete, got: %q", w.String())
+	}
+
+	p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockStop, nil, nil))
+
+	c := p.colors
+	expected := "Found the " + c.Highlight + "needle" + c.Reset + " here\nand a " + c.Highlight + "NEEDLE" + c.Reset + " there"
+	if w.String() != expected {
+		t.Errorf("expected %q, got %q", expected, w.String())
+	}
+}
+
+// TestProcessContentBlock_Copyable tests --copyable emits bare command and path lines
+func TestProcessContentBlock_Copyable(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.colors = DefaultScheme()
+	p.copyable = true
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls -la"}))
+	if !strings.Contains(w.String(), "\n$ ls -la\n") {
+		t.Errorf("expected bare copyable command line, got: %q", w.String())
+	}
+
+	w.Reset()
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_2", "Read", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_2", "Read", map[string]interface{}{"file_path": "/tmp/main.go"}))
+	if !strings.HasSuffix(w.String(), "\n/tmp/main.go\n") {
+		t.Errorf("expected bare copyable path line, got: %q", w.String())
+	}
+
+	// Other tools have nothing to copy
+	w.Reset()
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_3", "Glob", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_3", "Glob", map[string]interface{}{"pattern": "*.go"}))
+	if strings.Count(w.String(), "\n") != 1 {
+		t.Errorf("expected only the tool line for Glob, got: %q", w.String())
+	}
+}
+
+// TestRenderToolUse_OnlyHideTools tests --only-tools and --hide-tools silence other tools' calls
+// and results while their state is still tracked
+func TestRenderToolUse_OnlyHideTools(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.onlyTools = map[string]bool{"Bash": true, "Read": true}
+	p.hideTools = map[string]bool{"Read": true}
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+
+	calls := []struct {
+		id, name string
+		input    map[string]interface{}
+	}{
+		{"tool_1", "Bash", map[string]interface{}{"command": "go test ./..."}},
+		{"tool_2", "Read", map[string]interface{}{"file_path": "/tmp/main.go"}},
+		{"tool_3", "Grep", map[string]interface{}{"pattern": "func run"}},
+	}
+	for _, call := range calls {
+		p.state.AddOrUpdateToolCall(createTestToolCall(call.id, call.name, nil))
+		p.processContentBlock(createTestToolUseBlock(call.id, call.name, call.input))
+		p.processContentBlock(createTestToolResultBlock(call.id, "result of "+call.name, false))
+	}
+
+	output := w.String()
+	if !strings.Contains(output, "Bash: go test ./...") || !strings.Contains(output, "result of Bash") {
+		t.Errorf("expected the Bash call and result, got: %q", output)
+	}
+	for _, hidden := range []string{"Read", "main.go", "Grep", "func run"} {
+		if strings.Contains(output, hidden) {
+			t.Errorf("expected %q hidden (--hide-tools wins over --only-tools for Read), got: %q", hidden, output)
+		}
+	}
+	for _, call := range calls {
+		if tc := p.state.PendingTools[call.id]; tc.Status != ToolCallStatusCompleted {
+			t.Errorf("expected %s still tracked as completed, got %q", call.name, tc.Status)
+		}
+	}
+}
+
+// TestAgentContext_HiddenUntilSubagent tests the root agent context only shows once a Task spawns a subagent
+func TestAgentContext_HiddenUntilSubagent(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.handleSystemInit(createTestSystemInit("test", "model"))
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls"}))
+	p.processToolResult(createTestToolResultBlock("tool_1", "main.go", false))
+
+	if strings.Contains(w.String(), "[main:") {
+		t.Errorf("expected no agent context in a single-agent session, got: %q", w.String())
+	}
+
+	// A Task spawns a subagent, so returning to the root agent shows its context
+	taskInput := map[string]interface{}{"subagent_type": "Explore", "description": "Find files"}
+	p.handleStreamEvent(&StreamEvent{
+		Type:         StreamEventContentBlockStart,
+		ContentBlock: createTestToolUseBlock("task_1", "Task", taskInput),
+	})
+	p.processContentBlock(createTestToolUseBlock("task_1", "Task", taskInput))
+	p.processToolResult(createTestToolResultBlock("task_1", "done", false))
+
+	output := w.String()
+	if !strings.Contains(output, "[Explore: running]") {
+		t.Errorf("expected subagent context, got: %q", output)
+	}
+	if !strings.Contains(output, "[main: idle]") {
+		t.Errorf("expected root agent context after subagent returns, got: %q", output)
+	}
+}
+
+// TestAgentContext_HideRootAgent tests --hide-root-agent keeps root context hidden even with subagents
+func TestAgentContext_HideRootAgent(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.hideRootAgent = true
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+	p.state.CreateChildAgent("task_1", "Explore", "Find files")
+
+	p.printAgentContext()
+	if w.String() != "" {
+		t.Errorf("expected root context hidden, got: %q", w.String())
+	}
+
+	p.state.SetCurrentAgent("task_1")
+	p.printAgentContext()
+	if !strings.Contains(w.String(), "[Explore: running]") {
+		t.Errorf("expected subagent context, got: %q", w.String())
+	}
+}
+
+// TestProcessToolResult_OrphanBeforeToolUse tests a result arriving before its tool_use renders once the call appears
+func TestProcessToolResult_OrphanBeforeToolUse(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+
+	p.processToolResult(createTestToolResultBlock("tool_1", "file1.go\nfile2.go", false))
+	if w.String() != "" {
+		t.Fatalf("expected orphan result to be buffered, got: %q", w.String())
+	}
+
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls"}))
+
+	output := w.String()
+	callIdx := strings.Index(output, "→ Bash: ls")
+	resultIdx := strings.Index(output, "file2.go")
+	if callIdx == -1 || resultIdx < callIdx {
+		t.Errorf("expected buffered result rendered after its tool call, got: %q", output)
+	}
+	if len(p.state.OrphanResults) != 0 {
+		t.Errorf("expected orphan buffer to be empty, got %d", len(p.state.OrphanResults))
+	}
+}
+
+// TestProcessMessages_FlushesOrphanResults tests results that never find their tool_use print at session end
+func TestProcessMessages_FlushesOrphanResults(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	messages := make(chan interface{}, 2)
+	errors := make(chan error)
+
+	messages <- createTestSystemInit("test", "model")
+	messages <- createTestToolResultMessage(createTestToolResultBlock("tool_lost", "lost output", false))
+	close(messages)
+
+	p.ProcessMessages(messages, errors)
+
+	if !strings.Contains(w.String(), "[orphan result] tool_lost\n  lost output\n") {
+		t.Errorf("expected orphan result flushed at session end, got: %q", w.String())
+	}
+}
+
+// TestHandleAssistantMessage_ThinkingLast tests --thinking-last renders a turn's text before its thinking
+func TestHandleAssistantMessage_ThinkingLast(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.thinkingLast = true
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+
+	// Streamed thinking is held back, streamed text is not
+	p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "thinking_delta", Thinking: "Weighing options"}, nil))
+	p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockStop, nil, nil))
+	p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "The answer is 42."}, nil))
+	if w.String() != "The answer is 42." {
+		t.Fatalf("expected only streamed text so far, got: %q", w.String())
+	}
+
+	p.handleAssistantMessage(createTestAssistantMessage([]ContentBlock{
+		{Type: ContentBlockTypeThinking, Thinking: "Weighing options"},
+		{Type: ContentBlockTypeText, Text: "The answer is 42."},
+	}))
+
+	output := w.String()
+	textIdx := strings.Index(output, "The answer is 42.")
+	footerIdx := strings.Index(output, "[reasoning]\nWeighing options\n")
+	if footerIdx == -1 || footerIdx < textIdx {
+		t.Errorf("expected text followed by a [reasoning] footer, got: %q", output)
+	}
+	if strings.Count(output, "Weighing options") != 1 {
+		t.Errorf("expected thinking rendered once, got: %q", output)
+	}
+}
+
+// TestProcessMessage_OnlyAgent tests --only-agent renders just the selected agent's output
+func TestProcessMessage_OnlyAgent(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.onlyAgent = "Plan"
+	p.processMessage(createTestSystemInit("test", "model"))
+	p.state.CreateChildAgent("task_explore", "Explore", "Look around")
+	p.state.CreateChildAgent("task_plan", "Plan", "Make a plan")
+
+	say := func(text string) {
+		p.processMessage(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: text}, nil))
+	}
+
+	say("main output\n")
+	p.state.SetCurrentAgent("task_explore")
+	say("explore output\n")
+	p.state.SetCurrentAgent("task_plan")
+	say("plan output\n")
+
+	if w.String() != "plan output\n" {
+		t.Errorf("expected only the Plan agent's output, got: %q", w.String())
+	}
+	if !strings.Contains(p.state.Stream.PartialText, "explore output") {
+		t.Errorf("expected state tracked for hidden agents, got: %q", p.state.Stream.PartialText)
+	}
+}
+
+// TestProcessMessage_SeqTags tests --seq tags output with the message's sequence number
+func TestProcessMessage_SeqTags(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.seqTags = true
+
+	p.processMessage(createTestSystemInit("test", "model"))
+	p.processMessage(&CompactBoundary{Type: "system"})
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Hello"}, nil))
+
+	output := w.String()
+	if !strings.HasPrefix(output, "#1 [Session started: model]") {
+		t.Errorf("expected first message tagged #1, got: %q", output)
+	}
+	// The compact boundary renders nothing, so it is counted but untagged
+	if strings.Contains(output, "#2") {
+		t.Errorf("expected no tag for a message without output, got: %q", output)
+	}
+	if !strings.Contains(output, "#3 Hello") {
+		t.Errorf("expected third message tagged #3, got: %q", output)
+	}
+
+	// Deltas continuing the line are tagged on a line of their own once it ends
+	w.Reset()
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: ", world"}, nil))
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "!\nSecond line"}, nil))
+	if want := ", world!\n#5\nSecond line"; w.String() != want {
+		t.Errorf("expected tags only at line starts\nwant: %q\ngot:  %q", want, w.String())
+	}
+}
+
+// TestPrintToolCall_BashBackgroundAndTimeout tests background and timeout markers on Bash calls
+func TestPrintToolCall_BashBackgroundAndTimeout(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.printToolCall(createTestToolCall("tool_1", "Bash", map[string]interface{}{
+		"command":           "long_task.sh",
+		"run_in_background": true,
+		"timeout":           float64(120000),
+	}))
+	if w.String() != "→ Bash: long_task.sh [background] [timeout: 120s]\n" {
+		t.Errorf("expected background and timeout markers, got: %q", w.String())
+	}
+
+	// Foreground timeouts only show in verbose mode
+	w.Reset()
+	p.printToolCall(createTestToolCall("tool_2", "Bash", map[string]interface{}{
+		"command": "make test",
+		"timeout": float64(1500),
+	}))
+	if w.String() != "→ Bash: make test\n" {
+		t.Errorf("expected no markers for a foreground call, got: %q", w.String())
+	}
+
+	p.mode = OutputModeVerbose
+	w.Reset()
+	p.printToolCall(createTestToolCall("tool_3", "Bash", map[string]interface{}{
+		"command": "make test",
+		"timeout": float64(1500),
+	}))
+	if !strings.HasPrefix(w.String(), "→ Bash: make test [timeout: 1500ms]\n") {
+		t.Errorf("expected timeout marker in verbose mode, got: %q", w.String())
+	}
+}
+
+// TestPrintFinalSummary_Template tests --summary-template replaces the default summary layout
+func TestPrintFinalSummary_Template(t *testing.T) {
+	tmpl, err := ParseSummaryTemplate(`tokens={{.TotalTokens}} cost={{printf "%.4f" .Cost}} duration={{.Duration}} turns={{.Turns}} cache={{printf "%.0f" .CacheHitRate}}%`)
+	if err != nil {
+		t.Fatalf("ParseSummaryTemplate: %v", err)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.summaryTemplate = tmpl
+	p.handleResult(createTestResult(0.0123, 2500, 3))
+	p.state.TotalTokens.CacheReadInputTokens = 3000
+
+	p.printFinalSummary()
+
+	want := "\ntokens=1500 cost=0.0123 duration=2.5s turns=3 cache=75%\n"
+	if w.String() != want {
+		t.Errorf("expected %q, got %q", want, w.String())
+	}
+}
+
+func TestParseSummaryTemplate_Invalid(t *testing.T) {
+	if _, err := ParseSummaryTemplate("{{.Cost"); err == nil {
+		t.Error("expected parse error for malformed template")
+	}
+	if _, err := ParseSummaryTemplate("{{.NoSuchField}}"); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+// TestHandleAssistantMessage_StopSequence tests a custom stop sequence is noted once, escaped
+func TestHandleAssistantMessage_StopSequence(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+
+	p.handleStreamEvent(&StreamEvent{Type: StreamEventMessageStart, Message: &MessageContent{ID: "msg_1"}})
+	p.handleStreamEvent(&StreamEvent{Type: StreamEventMessageDelta, Delta: &Delta{StopReason: "stop_sequence", StopSequence: "</end>\n"}})
+
+	msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Done"}})
+	msg.Message.ID = "msg_1"
+	msg.Message.StopReason = "stop_sequence"
+	msg.Message.StopSequence = "</end>\n"
+	p.handleAssistantMessage(msg)
+
+	output := w.String()
+	if !strings.Contains(output, `[stopped at sequence: "</end>\n"]`) {
+		t.Errorf("expected escaped stop sequence note, got: %q", output)
+	}
+	if strings.Count(output, "[stopped at sequence") != 1 {
+		t.Errorf("expected the note once per message, got: %q", output)
+	}
+
+	// Ordinary stops get no note
+	w.Reset()
+	msg = createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Done"}})
+	msg.Message.ID = "msg_2"
+	msg.Message.StopReason = "end_turn"
+	p.handleAssistantMessage(msg)
+	if strings.Contains(w.String(), "stopped at sequence") {
+		t.Errorf("expected no note for end_turn, got: %q", w.String())
+	}
+}
+
+// TestPrintToolCall_VerboseNoRaw tests --verbose-no-raw keeps the formatted line but drops the input dump
+func TestPrintToolCall_VerboseNoRaw(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeVerbose)
+	p.noRawInput = true
+
+	p.printToolCall(createTestToolCall("tool_1", "CustomTool", map[string]interface{}{
+		"description": "Sync records",
+		"payload":     "large blob",
+	}))
+
+	output := w.String()
+	if !strings.Contains(output, "→ CustomTool: Sync records") {
+		t.Errorf("expected formatted tool line, got: %q", output)
+	}
+	if strings.Contains(output, "Input:") || strings.Contains(output, "large blob") {
+		t.Errorf("expected no raw input JSON, got: %q", output)
+	}
+}
+
+// TestProcessContentBlock_ConfirmTools tests --confirm-tools emphasizes matching calls only
+func TestProcessContentBlock_ConfirmTools(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.colors = DefaultScheme()
+	p.confirmTools = map[string]bool{"Bash": true, "Write": true}
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "rm -rf build"}))
+
+	c := p.colors
+	want := c.Warning + "⚠ about to run Bash: rm -rf build" + c.Reset + "\n"
+	if !strings.HasPrefix(w.String(), want) {
+		t.Errorf("expected emphasized warning before the call, got: %q", w.String())
+	}
+	if !strings.Contains(w.String(), "Bash"+c.Reset+": rm -rf build\n") {
+		t.Errorf("expected the regular tool line too, got: %q", w.String())
+	}
+
+	w.Reset()
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_2", "Read", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_2", "Read", map[string]interface{}{"file_path": "/tmp/a.go"}))
+	if strings.Contains(w.String(), "about to run") {
+		t.Errorf("expected no warning for unlisted tools, got: %q", w.String())
+	}
+}
+
+// TestHandleHookEvent tests hook events render only with --show-hooks
+func TestHandleHookEvent(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"system","subtype":"hook_response","hook_name":"PreToolUse:Bash","hook_event":"PreToolUse","decision":"blocked"}`))
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.processMessage(msg)
+	if w.String() != "" {
+		t.Errorf("expected hooks hidden by default, got: %q", w.String())
+	}
+
+	p.showHooks = true
+	p.processMessage(msg)
+	if w.String() != "[hook: PreToolUse → blocked]\n" {
+		t.Errorf("expected hook line, got: %q", w.String())
+	}
+	if p.state.RootAgent != nil {
+		t.Error("expected hook event not to re-initialize the session")
+	}
+}
+
+func TestHandleAssistantMessage_ContextWindowWarning(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.contextWarnAt = 0.9
+	p.state.Model = "claude-sonnet-4-5"
+
+	// Input grows each turn; the second request crosses 90% of 200k
+	for _, usage := range []*Usage{
+		{InputTokens: 10, CacheReadInputTokens: 150000},
+		{InputTokens: 10, CacheReadInputTokens: 185000},
+		{InputTokens: 10, CacheReadInputTokens: 190000},
+	} {
+		msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "ok"}})
+		msg.Message.Usage = usage
+		p.handleAssistantMessage(msg)
+	}
+
+	output := w.String()
+	if !strings.Contains(output, "⚠ approaching context limit (185k/200k)") {
+		t.Errorf("expected context warning, got: %q", output)
+	}
+	if strings.Count(output, "approaching context limit") != 1 {
+		t.Errorf("expected a single warning per session, got: %q", output)
+	}
+}
+
+func TestModelContextWindow(t *testing.T) {
+	if got := modelContextWindow("claude-sonnet-4-5"); got != 200000 {
+		t.Errorf("modelContextWindow(claude-sonnet-4-5) = %d, want 200000", got)
+	}
+	if got := modelContextWindow("claude-sonnet-4-5[1m]"); got != 1000000 {
+		t.Errorf("modelContextWindow(claude-sonnet-4-5[1m]) = %d, want 1000000", got)
+	}
+}
+
+func TestUsageCost(t *testing.T) {
+	usage := &TotalUsage{InputTokens: 1000000, OutputTokens: 100000}
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"claude-sonnet-4-5", 4.5},
+		{"claude-opus-4-1-20250805", 22.5},
+		{"claude-opus-4-5", 7.5},
+		{"claude-haiku-4-5", 1.5},
+		{"some-new-model", 4.5},
+	}
+	for _, tt := range tests {
+		if got := usageCost(tt.model, usage); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("usageCost(%s) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+
+	// Cache writes cost more than input, the 1h tier most, and cache reads less
+	cached := &TotalUsage{CacheCreationInputTokens: 1000000, CacheReadInputTokens: 1000000, CacheCreation: &CacheCreation{Ephemeral1hInputTokens: 1000000}}
+	if got := usageCost("claude-sonnet-4-5", cached); math.Abs(got-6.3) > 1e-9 {
+		t.Errorf("usageCost with cache = %v, want 6.3", got)
+	}
+}
+
+// TestProcessContentBlock_SubagentToolsIndented tests tool activity is indented by the depth of the
+// agent whose message made the call, with parallel agents interleaving
+func TestProcessContentBlock_SubagentToolsIndented(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	tasks := []ContentBlock{
+		*createTestToolUseBlock("task_1", "Task", map[string]interface{}{"subagent_type": "Explore", "description": "Find files"}),
+		*createTestToolUseBlock("task_2", "Task", map[string]interface{}{"subagent_type": "Explore", "description": "Find tests"}),
+	}
+	// call streams a Bash call and completes it in a message from agent ("" for the main agent)
+	call := func(id, command, agent string) []interface{} {
+		block := createTestToolUseBlock(id, "Bash", map[string]interface{}{"command": command})
+		msg := createTestAssistantMessage([]ContentBlock{*block})
+		msg.Message.ID = "msg_" + id
+		if agent != "" {
+			msg.ParentToolUseID = &agent
+		}
+		return []interface{}{createTestStreamEvent(StreamEventContentBlockStart, nil, block), msg}
+	}
+
+	script := []interface{}{
+		createTestSystemInit("test", "model"),
+		createTestStreamEvent(StreamEventContentBlockStart, nil, &tasks[0]),
+		createTestStreamEvent(StreamEventContentBlockStart, nil, &tasks[1]),
+		createTestAssistantMessage(tasks),
+	}
+	script = append(script, call("bash_1", "ls", "task_1")...)
+	script = append(script, createTestToolResultMessage(createTestToolResultBlock("bash_1", "main.go", false)))
+	script = append(script, call("bash_2", "ls test", "task_2")...)
+	script = append(script, call("bash_3", "pwd", "task_1")...)
+	for _, msg := range script {
+		p.processMessage(msg)
+	}
+
+	for _, want := range []string{"  → Bash: ls\n    main.go\n", "  → Bash: ls test\n", "  → Bash: pwd\n"} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("expected %q indented under its agent, got: %q", want, w.String())
+		}
+	}
+
+	// The main agent's calls are not indented while its subagents run
+	w.Reset()
+	for _, msg := range call("bash_4", "git status", "") {
+		p.processMessage(msg)
+	}
+	if !strings.HasPrefix(w.String(), "→ Bash: git status") {
+		t.Errorf("expected root tool call unindented, got: %q", w.String())
+	}
+}
+
+// TestProcessMessages_ErrorResetsPartialStream tests a parse error between streamed messages
+// doesn't let the interrupted message's partial text leak into the next one
+func TestProcessMessages_ErrorResetsPartialStream(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	// Unbuffered, so messages and errors are handled in the order they are sent
+	messages := make(chan interface{})
+	errors := make(chan error)
+
+	go func() {
+		messages <- createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Interrupted mess"}, nil)
+		errors <- fmt.Errorf("parse error: unexpected end of JSON input")
+		messages <- createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Fresh message"}, nil)
+		close(messages)
+	}()
+	p.ProcessMessages(messages, errors)
+
+	if p.state.Stream.PartialText != "Fresh message" {
+		t.Errorf("expected partial text to start fresh after the error, got: %q", p.state.Stream.PartialText)
+	}
+	if !strings.Contains(w.String(), "Interrupted mess\nFresh message") {
+		t.Errorf("expected the next message on its own line, got: %q", w.String())
+	}
+
+	// --keep-partial-on-error leaves the partial state alone
+	p, _ = newTestOutputProcessor(OutputModeText)
+	p.keepPartialOnError = true
+	messages = make(chan interface{})
+	go func() {
+		messages <- createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Interrupted mess"}, nil)
+		errors <- fmt.Errorf("parse error: unexpected end of JSON input")
+		messages <- createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "age"}, nil)
+		close(messages)
+	}()
+	p.ProcessMessages(messages, errors)
+
+	if p.state.Stream.PartialText != "Interrupted message" {
+		t.Errorf("expected partial text kept with keepPartialOnError, got: %q", p.state.Stream.PartialText)
+	}
+}
+
+// TestProcessMessage_ShowUUIDs tests messages are tagged with their uuid only when asked
+func TestProcessMessage_ShowUUIDs(t *testing.T) {
+	const uuid = "3f2a9c1e-7b4d-4e8a-9c2f-1d5e6b7a8c9d"
+	init := createTestSystemInit("test", "model")
+	init.UUID = uuid
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.processMessage(init)
+	if strings.Contains(w.String(), "3f2a9c1e") {
+		t.Errorf("expected no uuid by default, got: %q", w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.showUUIDs = true
+	p.processMessage(init)
+	if !strings.HasPrefix(w.String(), "3f2a9c1e [Session started: model]") {
+		t.Errorf("expected truncated uuid prefix, got: %q", w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.showUUIDs = true
+	p.fullUUIDs = true
+	p.seqTags = true
+	p.processMessage(init)
+	if !strings.HasPrefix(w.String(), "#1 "+uuid+" [Session started: model]") {
+		t.Errorf("expected sequence number and full uuid prefix, got: %q", w.String())
+	}
+
+	// Streamed text is already out when its complete message arrives, so the uuid follows it
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.showUUIDs = true
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockStart, nil, createTestContentBlock(ContentBlockTypeText, "")))
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "text_delta", Text: "Hello"}, nil))
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockStop, nil, nil))
+	msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Hello"}})
+	msg.UUID = uuid
+	p.processMessage(msg)
+	if !strings.HasPrefix(w.String(), "Hello\n3f2a9c1e\n") {
+		t.Errorf("expected the uuid on its own line after the streamed text, got: %q", w.String())
+	}
+}
+
+// TestPlainMode_BareToolLines tests --format plain strips colors and glyphs from tool lines
+func TestPlainMode_BareToolLines(t *testing.T) {
+	SetNoColor(false)
+	p := NewOutputProcessor("plain", false, false)
+	var w strings.Builder
+	p.writer = &w
+
+	p.handleSystemInit(createTestSystemInit("test", "model"))
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", nil))
+	p.processContentBlock(createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "ls -la"}))
+	p.processToolResult(createTestToolResultBlock("tool_1", "main.go", true))
+
+	output := w.String()
+	if !strings.HasPrefix(output, "Bash: ls -la\n") {
+		t.Errorf("expected bare tool line with no banner, got: %q", output)
+	}
+	if strings.Contains(output, "\033[") || strings.Contains(output, "→") || strings.Contains(output, "✗") {
+		t.Errorf("expected no colors or glyphs, got: %q", output)
+	}
+	if !strings.Contains(output, "  Command failed\n") {
+		t.Errorf("expected failure without icon, got: %q", output)
+	}
+}
+
+// TestPlainMode_BareThinkingAndAgents tests --format plain drops thinking labels and agent badges
+func TestPlainMode_BareThinkingAndAgents(t *testing.T) {
+	SetNoColor(false)
+	p := NewOutputProcessor("plain", false, false)
+	var w strings.Builder
+	p.writer = &w
+
+	p.processContentBlock(&ContentBlock{Type: ContentBlockTypeThinking, Thinking: "Checking the tests."})
+	p.state.InitializeSession(createTestSystemInit("test", "model"))
+	p.state.CreateChildAgent("task_1", "task", "Find files")
+	p.state.SetCurrentAgent("task_1")
+	p.printAgentContext()
+
+	output := w.String()
+	if !strings.HasPrefix(output, "Checking the tests.\n") {
+		t.Errorf("expected bare thinking text, got: %q", output)
+	}
+	if strings.Contains(output, "[THINKING]") || strings.Contains(output, "[task:") {
+		t.Errorf("expected no thinking label or agent badge, got: %q", output)
+	}
+}
+
+// TestHandleSystemInit_MCPServerWarnings tests servers that aren't running are flagged at session start
+func TestHandleSystemInit_MCPServerWarnings(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{
+		"type": "system",
+		"subtype": "init",
+		"session_id": "sess-full",
+		"model": "claude-opus-4-5-20251101",
+		"tools": ["Read", "Bash", "Write"],
+		"mcp_servers": [
+			{"name": "server1", "status": "running"},
+			{"name": "server2", "status": "stopped"}
+		],
+		"uuid": "uuid-12345"
+	}`))
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.handleSystemInit(msg.(*SystemInit))
+
+	output := w.String()
+	if !strings.Contains(output, "⚠ MCP server 'server2' is stopped\n") {
+		t.Errorf("expected warning for the stopped server, got: %q", output)
+	}
+	if strings.Contains(output, "server1") {
+		t.Errorf("expected no line for the running server outside verbose mode, got: %q", output)
+	}
+
+	p, w = newTestOutputProcessor(OutputModeVerbose)
+	p.handleSystemInit(msg.(*SystemInit))
+	if !strings.Contains(w.String(), "[MCP server 'server1': running]") {
+		t.Errorf("expected every server listed in verbose mode, got: %q", w.String())
+	}
+}
+
+// TestProcessContentBlock_CollapseReads tests consecutive reads render as a single line
+func TestProcessContentBlock_CollapseReads(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.collapseReads = true
+
+	files := []string{"main.go", "types.go", "output.go", "runner.go", "colors.go"}
+	for i, file := range files {
+		id := fmt.Sprintf("read_%d", i)
+		p.state.AddOrUpdateToolCall(createTestToolCall(id, "Read", nil))
+		p.processContentBlock(createTestToolUseBlock(id, "Read", map[string]interface{}{"file_path": "/repo/" + file}))
+		p.processToolResult(createTestToolResultBlock(id, "package main", false))
+	}
+	if w.String() != "" {
+		t.Errorf("expected reads held back while the run continues, got: %q", w.String())
+	}
+
+	// A different tool ends the run
+	p.state.AddOrUpdateToolCall(createTestToolCall("bash_1", "Bash", nil))
+	p.processContentBlock(createTestToolUseBlock("bash_1", "Bash", map[string]interface{}{"command": "go test"}))
+
+	want := "→ Read: 5 files (main.go, types.go, output.go, runner.go, colors.go)\n→ Bash: go test\n"
+	if w.String() != want {
+		t.Errorf("expected one collapsed read line, got: %q, want: %q", w.String(), want)
+	}
+}
+
+// TestProcessToolResult_EmptyResultSuppressed tests successful empty results are dropped when asked
+func TestProcessToolResult_EmptyResultSuppressed(t *testing.T) {
+	feed := func(p *OutputProcessor, content string, isError bool) {
+		p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "CustomTool", nil))
+		p.processToolResult(createTestToolResultBlock("tool_1", content, isError))
+	}
+
+	// By default the result is a compact one-liner
+	p, w := newTestOutputProcessor(OutputModeText)
+	feed(p, "", false)
+	if w.String() != "  ✓ CustomTool completed\n" {
+		t.Errorf("expected one-line confirmation by default, got: %q", w.String())
+	}
+
+	for name, configure := range map[string]func(p *OutputProcessor){
+		"no-result-on-empty": func(p *OutputProcessor) { p.noEmptyResults = true },
+		"fold":               func(p *OutputProcessor) { p.foldResults = true },
+	} {
+		p, w := newTestOutputProcessor(OutputModeText)
+		configure(p)
+		feed(p, "  \n", false)
+		if w.String() != "" {
+			t.Errorf("%s: expected empty result suppressed, got: %q", name, w.String())
+		}
+
+		// Failures still show
+		feed(p, "", true)
+		if !strings.Contains(w.String(), "✗") {
+			t.Errorf("%s: expected failed result shown, got: %q", name, w.String())
+		}
+	}
+}
+
+// TestProcessToolResult_InvalidUTF8 tests invalid bytes in the raw stream render as replacement characters
+func TestProcessToolResult_InvalidUTF8(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", map[string]interface{}{"command": "grep -r foo ."}))
+
+	var block ContentBlock
+	if err := json.Unmarshal([]byte("{\"type\":\"tool_result\",\"tool_use_id\":\"tool_1\",\"content\":\"data.bin: foo\x80\xffbar\"}"), &block); err != nil {
+		t.Fatal(err)
+	}
+	p.processToolResult(&block)
+
+	if !utf8.ValidString(w.String()) {
+		t.Errorf("expected valid UTF-8 output, got: %q", w.String())
+	}
+	if w.String() != "  data.bin: foo��bar\n" {
+		t.Errorf("expected invalid bytes replaced, got: %q", w.String())
+	}
+}
+
+// TestHandleAssistantMessage_PerTurnTokens tests each turn shows its own usage, not the running total
+func TestHandleAssistantMessage_PerTurnTokens(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.perTurnTokens = true
+
+	for i, usage := range []*Usage{
+		{InputTokens: 1240, OutputTokens: 380},
+		{InputTokens: 2000, OutputTokens: 150},
+	} {
+		msg := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "ok"}})
+		msg.Message.ID = fmt.Sprintf("msg_%d", i)
+		msg.Message.Usage = usage
+		p.handleAssistantMessage(msg)
+	}
+
+	output := w.String()
+	if !strings.Contains(output, "[+1,240 in, 380 out]\n") {
+		t.Errorf("expected first turn usage, got: %q", output)
+	}
+	if !strings.Contains(output, "[+2,000 in, 150 out]\n") {
+		t.Errorf("expected second turn delta rather than the cumulative total, got: %q", output)
+	}
+
+	// Streamed, each content block repeats the message's usage and message_delta completes it
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.perTurnTokens = true
+	p.processMessage(&StreamEvent{Type: StreamEventMessageStart, Message: &MessageContent{ID: "msg_stream"}})
+	for _, block := range []ContentBlock{{Type: ContentBlockTypeThinking, Thinking: "Plan."}, {Type: ContentBlockTypeText, Text: "ok"}} {
+		msg := createTestAssistantMessage([]ContentBlock{block})
+		msg.Message.ID = "msg_stream"
+		msg.Message.Usage = &Usage{InputTokens: 1000, OutputTokens: 20}
+		p.processMessage(msg)
+	}
+	p.processMessage(&StreamEvent{Type: StreamEventMessageDelta, Delta: &Delta{StopReason: "end_turn"}, Usage: &Usage{OutputTokens: 95}})
+	p.processMessage(&StreamEvent{Type: StreamEventMessageStop})
+
+	if got := strings.Count(w.String(), "[+"); got != 1 || !strings.Contains(w.String(), "[+1,000 in, 95 out]\n") {
+		t.Errorf("expected the message's usage once, from message_delta, got: %q", w.String())
+	}
+}
+
+// TestHandleAssistantMessage_PerMessageCost tests each message's cost and duration render in verbose mode
+func TestHandleAssistantMessage_PerMessageCost(t *testing.T) {
+	parsed, err := ParseMessage([]byte(`{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"text","text":"ok"}]},"cost_usd":0.003,"duration_ms":1200}`))
+	if err != nil {
+		t.Fatalf("ParseMessage: %v", err)
+	}
+	msg := parsed.(*AssistantMessage)
+
+	p, w := newTestOutputProcessor(OutputModeVerbose)
+	p.handleAssistantMessage(msg)
+	if !strings.Contains(w.String(), "($0.0030, 1.2s)\n") {
+		t.Errorf("expected the message's cost and duration, got: %q", w.String())
+	}
+
+	// Not shown in the default mode unless asked for
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.handleAssistantMessage(msg)
+	if strings.Contains(w.String(), "$0.0030") {
+		t.Errorf("expected no per-message cost by default, got: %q", w.String())
+	}
+
+	// Messages that report neither get no line
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.perMessageCost = true
+	p.handleAssistantMessage(createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "ok"}}))
+	if strings.Contains(w.String(), "(") {
+		t.Errorf("expected no cost line without cost or duration, got: %q", w.String())
+	}
+}
+
+// TestCleanThinking_StreamedAndComplete tests --clean-thinking strips wrapper tags on both thinking paths
+func TestCleanThinking_StreamedAndComplete(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.cleanThinking = true
+
+	// The tag is split across deltas
+	for _, chunk := range []string{"<think", "ing>Check the tests.  \n\n\n\nThen fix", " the bug.</thinking>"} {
+		p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "thinking_delta", Thinking: chunk}, nil))
+	}
+	p.handleStreamEvent(createTestStreamEvent(StreamEventContentBlockStop, nil, nil))
+
+	want := "[THINKING] Check the tests.\n\nThen fix the bug.\n"
+	if w.String() != want {
+		t.Errorf("expected cleaned streamed thinking %q, got: %q", want, w.String())
+	}
+
+	// Without partial messages only the complete block arrives
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.cleanThinking = true
+	p.processContentBlock(&ContentBlock{Type: ContentBlockTypeThinking, Thinking: "<scratchpad>Plan first.</scratchpad>"})
+	if !strings.HasPrefix(w.String(), "[THINKING] Plan first.\n") {
+		t.Errorf("expected cleaned complete thinking, got: %q", w.String())
+	}
+}
+
+// TestThinkingGist_Streamed tests --thinking-gist renders only the first sentence of a thinking block
+func TestThinkingGist_Streamed(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.thinkingGist = true
+	sidecar := &mockWriter{}
+	p.thinkingWriter = sidecar
+
+	thinking := "The test fails on Windows. Line endings differ, so the golden file\nneeds normalizing."
+	for _, chunk := range []string{"The test fails on Windows. Line endings", " differ, so the golden file\nneeds normalizing."} {
+		p.processMessage(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Type: "thinking_delta", Thinking: chunk}, nil))
+	}
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockStop, nil, nil))
+	// The complete block follows the stream, and is the same thinking again
+	p.processMessage(createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeThinking, Thinking: thinking}}))
+
+	if want := "[thinking] The test fails on Windows.…\n"; !strings.HasPrefix(w.String(), want) || strings.Count(w.String(), "[thinking]") != 1 || strings.Contains(w.String(), "Line endings") {
+		t.Errorf("expected %q once, got: %q", want, w.String())
+	}
+	if want := "[THINKING] " + thinking + "\n"; sidecar.String() != want {
+		t.Errorf("expected the whole block once in the --thinking-out sidecar %q, got: %q", want, sidecar.String())
+	}
+
+	// Verbose mode keeps the whole block
+	p, w = newTestOutputProcessor(OutputModeVerbose)
+	p.thinkingGist = true
+	p.processContentBlock(&ContentBlock{Type: ContentBlockTypeThinking, Thinking: "First. Second."})
+	if !strings.Contains(w.String(), "[THINKING] First. Second.") {
+		t.Errorf("expected full thinking in verbose mode, got: %q", w.String())
+	}
+}
+
+// TestProcessToolResult_IndentWidth tests --indent sets the tool result indentation
+func TestProcessToolResult_IndentWidth(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.indentWidth = 4
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", map[string]interface{}{"command": "ls"}))
+	p.processToolResult(createTestToolResultBlock("tool_1", "main.go", false))
+
+	if !strings.Contains(w.String(), "\n    main.go\n") && !strings.HasPrefix(w.String(), "    main.go\n") {
+		t.Errorf("expected result line indented by four spaces, got: %q", w.String())
+	}
+	if strings.Contains(w.String(), "\n  main.go") || strings.HasPrefix(w.String(), "  main.go") {
+		t.Errorf("expected no two-space indentation, got: %q", w.String())
+	}
+
+	if got := p.indent(2); got != "        " {
+		t.Errorf("indent(2) = %q, want eight spaces", got)
+	}
+}
+
+// TestPrintToolCall_TodoProgress tests --todo-progress renders a bar of completed items
+func TestPrintToolCall_TodoProgress(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.todoProgress = true
+
+	var todos []interface{}
+	for i, status := range []string{"completed", "completed", "completed", "in_progress", "pending"} {
+		todos = append(todos, map[string]interface{}{
+			"content": fmt.Sprintf("Task %d", i+1),
+			"status":  status,
+		})
+	}
+	p.printToolCall(createTestToolCall("tool_todo", "TodoWrite", map[string]interface{}{"todos": todos}))
+
+	if !strings.Contains(w.String(), "  [███░░] 3/5 done\n") {
+		t.Errorf("expected 3/5 progress bar, got: %q", w.String())
+	}
+	if completed, total := p.state.TodoProgress(); completed != 3 || total != 5 {
+		t.Errorf("expected last-seen todos 3/5, got %d/%d", completed, total)
+	}
+
+	// Without the flag the list is unchanged
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.printToolCall(createTestToolCall("tool_todo", "TodoWrite", map[string]interface{}{"todos": todos}))
+	if strings.Contains(w.String(), "done") {
+		t.Errorf("expected no progress bar without --todo-progress, got: %q", w.String())
+	}
+}
+
+// TestHandleSystemInit_CompatibilityNote tests an old claude version is noted in verbose mode
+func TestHandleSystemInit_CompatibilityNote(t *testing.T) {
+	sysInit := createTestSystemInit("session-old", "claude-sonnet-4-5")
+	sysInit.ClaudeCodeVersion = "0.2.9"
+
+	p, w := newTestOutputProcessor(OutputModeVerbose)
+	p.handleSystemInit(sysInit)
+	if !strings.Contains(w.String(), "⚠ claude 0.2.9 is older than 1.0.0") {
+		t.Errorf("expected compatibility warning in verbose mode, got: %q", w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.handleSystemInit(sysInit)
+	if strings.Contains(w.String(), "0.2.9") {
+		t.Errorf("expected no compatibility note outside verbose mode, got: %q", w.String())
+	}
+}
+
+// TestHandleAssistantMessage_MergeText tests --merge-text drops the blank line between adjacent text blocks
+func TestHandleAssistantMessage_MergeText(t *testing.T) {
+	msg := createTestAssistantMessage([]ContentBlock{
+		{Type: ContentBlockTypeText, Text: "The build is failing"},
+		{Type: ContentBlockTypeText, Text: "because go.sum is stale."},
+		*createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "go mod tidy"}),
+		{Type: ContentBlockTypeText, Text: "Fixed."},
+	})
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.mergeText = true
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", nil))
+	p.handleAssistantMessage(msg)
+	p.handleResult(createTestResult(0.01, 1000, 1))
+
+	output := w.String()
+	if !strings.Contains(output, "The build is failing\nbecause go.sum is stale.\n") {
+		t.Errorf("expected adjacent text blocks merged, got: %q", output)
+	}
+	// The tool call still separates text
+	if !strings.Contains(output, "stale.\n\n→ Bash") {
+		t.Errorf("expected spacing before the tool call, got: %q", output)
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "Bash", nil))
+	p.handleAssistantMessage(msg)
+	if !strings.Contains(w.String(), "The build is failing\n\nbecause") {
+		t.Errorf("expected a blank line between text blocks by default, got: %q", w.String())
+	}
+}
+
+// TestProcessToolResult_SlowMarker tests tools running past the slow threshold are flagged
+func TestProcessToolResult_SlowMarker(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.slowToolThreshold = 30 * time.Second
+
+	slow := createTestToolCall("tool_slow", "Bash", map[string]interface{}{"command": "make test"})
+	slow.StartTime = time.Now().Add(-47 * time.Second).UnixMilli()
+	p.state.AddOrUpdateToolCall(slow)
+	p.processToolResult(createTestToolResultBlock("tool_slow", "ok", false))
+
+	if !strings.Contains(w.String(), "⚠ slow (47s)") {
+		t.Errorf("expected slow marker, got: %q", w.String())
+	}
+
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.slowToolThreshold = 30 * time.Second
+
+	fast := createTestToolCall("tool_fast", "Bash", map[string]interface{}{"command": "ls"})
+	fast.StartTime = time.Now().Add(-2 * time.Second).UnixMilli()
+	p.state.AddOrUpdateToolCall(fast)
+	p.processToolResult(createTestToolResultBlock("tool_fast", "ok", false))
+
+	if strings.Contains(w.String(), "slow") {
+		t.Errorf("expected no slow marker for a fast tool, got: %q", w.String())
+	}
+}
+
+// TestProcessToolResult_TaskAgentTokens tests a finished subagent's token usage renders with its result,
+// counting each message's usage once for the agent that sent it
+func TestProcessToolResult_TaskAgentTokens(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	task := createTestToolUseBlock("task_1", "Task", map[string]interface{}{"subagent_type": "Explore", "description": "Find the parser"})
+	agent := "task_1"
+
+	root := createTestAssistantMessage([]ContentBlock{*task})
+	root.Message.ID = "msg_root"
+	root.Message.Usage = &Usage{InputTokens: 900, OutputTokens: 100}
+	explore := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Looking for the parser."}})
+	explore.Message.ID = "msg_explore_1"
+	explore.Message.Usage = &Usage{InputTokens: 3000, OutputTokens: 200}
+	explore.ParentToolUseID = &agent
+	search := createTestAssistantMessage([]ContentBlock{*createTestToolUseBlock("grep_1", "Grep", map[string]interface{}{"pattern": "func Parse"})})
+	search.Message.ID = "msg_explore_1"
+	search.Message.Usage = &Usage{InputTokens: 3000, OutputTokens: 200}
+	search.ParentToolUseID = &agent
+	answer := createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "It is in types.go."}})
+	answer.Message.ID = "msg_explore_2"
+	answer.Message.Usage = &Usage{InputTokens: 900, OutputTokens: 100}
+	answer.ParentToolUseID = &agent
+
+	for _, msg := range []interface{}{
+		createTestSystemInit("session-task", "claude-sonnet-4-5"),
+		&StreamEvent{Type: StreamEventMessageStart, Message: &MessageContent{ID: "msg_root"}},
+		createTestStreamEvent(StreamEventContentBlockStart, nil, task),
+		createTestStreamEvent(StreamEventContentBlockStop, nil, nil),
+		root,
+		// The main agent's final usage arrives once the Task is already running
+		&StreamEvent{Type: StreamEventMessageDelta, Delta: &Delta{StopReason: "tool_use"}, Usage: &Usage{OutputTokens: 120}},
+		explore,
+		search,
+		answer,
+		createTestToolResultMessage(createTestToolResultBlock("task_1", "The parser is in types.go", false)),
+	} {
+		p.processMessage(msg)
+	}
+
+	if !strings.Contains(w.String(), "[Explore] used ~4,200 tokens\n") {
+		t.Errorf("expected the subagent's token usage, got: %q", w.String())
+	}
+	if got := p.state.RootAgent.Tokens; got != 1020 {
+		t.Errorf("expected root agent tokens 1020, got %d", got)
+	}
+}
+
+// TestPrintFinalSummary_ToolUsage tests the summary counts each tool's calls and failures, most used first
+func TestPrintFinalSummary_ToolUsage(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.state.InitializeSession(createTestSystemInit("session-tools", "claude-sonnet-4-5"))
+	p.result = createTestResult(0.01, 1000, 3)
+
+	for i, name := range []string{"Edit", "Bash", "Bash", "Bash"} {
+		id := fmt.Sprintf("tool_%d", i)
+		p.state.AddOrUpdateToolCall(createTestToolCall(id, name, nil))
+		p.state.CompleteToolCall(id, "", i == 3)
+	}
+	p.printFinalSummary()
+
+	output := w.String()
+	bash, edit := strings.Index(output, "Bash: 3 (1 failed)\n"), strings.Index(output, "Edit: 1\n")
+	if bash < 0 || edit < 0 || bash > edit {
+		t.Errorf("expected Bash then Edit with their failures, got: %q", output)
+	}
+}
+
+// TestPrintFinalSummary_Width tests the summary is laid out in aligned columns for a known width
+func TestPrintFinalSummary_Width(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.summaryWidth = 50
+	p.result = createTestResult(0.05, 5000, 3)
+	p.state.TotalTokens = &TotalUsage{InputTokens: 1000, OutputTokens: 500}
+
+	p.printFinalSummary()
+
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if got := utf8.RuneCountInString(lines[0]); got != 50 {
+		t.Errorf("expected a 50-column separator, got %d: %q", got, lines[0])
+	}
+
+	want := []string{
+		"Tokens:   1500 total (1000 in, 500 out)",
+		"Cost:     $0.0500",
+		"Duration: 5.0s",
+		"Turns:    3",
+	}
+	if strings.Join(lines[1:], "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected aligned rows\ngot:\n%s\nwant:\n%s", strings.Join(lines[1:], "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWrapWords(t *testing.T) {
+	got := wrapWords("Bash, Write, github:create_issue, Edit", 20)
+	want := []string{"Bash, Write,", "github:create_issue,", "Edit"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("wrapWords() = %q, want %q", got, want)
+	}
+
+	// Color codes don't count towards the width
+	colored := "\x1b[1m1500\x1b[0m total"
+	if got := wrapWords(colored, 10); len(got) != 1 {
+		t.Errorf("expected colored text to fit on one line, got %q", got)
+	}
+}
+
+// TestPrintToolCall_NormalizeToolNames tests --normalize-tool-names changes only how tool names display
+func TestPrintToolCall_NormalizeToolNames(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.normalizeToolNames = true
+
+	p.printToolCall(createTestToolCall("tool_1", "navigate", map[string]interface{}{"url": "https://example.com"}))
+	if !strings.Contains(w.String(), "→ Navigate") {
+		t.Errorf("expected navigate to display as Navigate, got: %q", w.String())
+	}
+
+	// Handlers still dispatch on the original name
+	w.Reset()
+	p.printToolCall(createTestToolCall("tool_2", "Bash", map[string]interface{}{"command": "ls -la"}))
+	if !strings.Contains(w.String(), "→ Bash: ls -la") {
+		t.Errorf("expected Bash handler output, got: %q", w.String())
+	}
+
+	// Without the flag names are shown as sent
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.printToolCall(createTestToolCall("tool_1", "navigate", map[string]interface{}{"url": "https://example.com"}))
+	if !strings.Contains(w.String(), "→ navigate") {
+		t.Errorf("expected navigate unchanged without the flag, got: %q", w.String())
+	}
+}
+
+// TestHandleBashResult_DimResults tests --dim-results shows the output dim and keeps the failure marker's color
+func TestHandleBashResult_DimResults(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.colors = DefaultScheme()
+	p.dimResults = true
+
+	toolCall := createTestToolCall("tool_1", "Bash", map[string]interface{}{"command": "make"})
+	handleBashResult(p, toolCall, createTestToolResultBlock("tool_1", "\x1b[32mok\x1b[0m build", true))
+
+	if !strings.Contains(w.String(), "  "+Dim+"ok build"+Reset+"\n") {
+		t.Errorf("expected the output dim with its own colors dropped, got: %q", w.String())
+	}
+	if !strings.Contains(w.String(), Red+"✗ Command failed") {
+		t.Errorf("expected the failure marker in its usual color, got: %q", w.String())
+	}
+
+	// With colors off there is nothing to dim
+	p, w = newTestOutputProcessor(OutputModeText)
+	p.dimResults = true
+	handleBashResult(p, toolCall, createTestToolResultBlock("tool_1", "ok build", false))
+	if w.String() != "  ok build\n" {
+		t.Errorf("expected plain output without colors, got: %q", w.String())
+	}
+}
+
+// TestHandleContentBlockDelta_NoStream tests text and thinking deltas aren't written as they arrive with --pipe
+func TestHandleContentBlockDelta_NoStream(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.noStream = true
+
+	p.handleContentBlockDelta(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Thinking: "Let me see"}, nil))
+	p.handleContentBlockDelta(createTestStreamEvent(StreamEventContentBlockDelta, &Delta{Text: "Hel"}, nil))
+	if w.String() != "" {
+		t.Errorf("expected nothing written while streaming, got: %q", w.String())
+	}
+
+	p.processContentBlock(createTestContentBlock(ContentBlockTypeText, "Hello"))
+	if !strings.HasPrefix(w.String(), "Hello\n") {
+		t.Errorf("expected the complete text block to render, got: %q", w.String())
+	}
+}
+
+// TestProcessMessage_GroupByTurn tests --group-by-turn prints a turn's text before its tools, indented under it
+func TestProcessMessage_GroupByTurn(t *testing.T) {
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.groupByTurn = true
+	p.noStream = true
+
+	read := createTestToolUseBlock("tool_1", "Read", map[string]interface{}{"file_path": "main.go"})
+	grep := createTestToolUseBlock("tool_2", "Grep", map[string]interface{}{"pattern": "func run"})
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockStart, nil, read))
+	p.processMessage(createTestStreamEvent(StreamEventContentBlockStart, nil, grep))
+
+	// One turn split across messages, with the tools interleaved in its text
+	p.processMessage(createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Let me read main."}, *read}))
+	p.processMessage(createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Then find run."}, *grep}))
+	if strings.Contains(w.String(), "→") {
+		t.Fatalf("expected tools held back until the turn ends, got: %q", w.String())
+	}
+
+	p.processMessage(&UserMessage{Type: "user", Message: UserMessageContent{Role: "user", Content: []ContentBlock{
+		*createTestToolResultBlock("tool_1", "package main", false),
+	}}})
+
+	output := w.String()
+	first, second := strings.Index(output, "Let me read main."), strings.Index(output, "Then find run.")
+	readCall, grepCall := strings.Index(output, "  → Read: main.go\n"), strings.Index(output, "  → Grep: func run\n")
+	if first < 0 || second < 0 || readCall < 0 || grepCall < 0 {
+		t.Fatalf("expected both texts and both indented tool calls, got: %q", output)
+	}
+	if !(first < second && second < readCall && readCall < grepCall) {
+		t.Errorf("expected the turn's text before its tools, got: %q", output)
+	}
+}
+
+// TestProcessToolResult_Image tests image results render as one line with whatever metadata they carry
+func TestProcessToolResult_Image(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "media type and dimensions",
+			content: `[{"type":"text","text":"Screenshot taken"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="},"width":1280,"height":720}]`,
+			want:    "  ✓ image captured [png, 1280×720]\n    Screenshot taken\n",
+		},
+		{
+			name:    "media type only",
+			content: `[{"type":"image","source":{"type":"base64","media_type":"image/jpeg","data":"/9j/4AAQ"}}]`,
+			want:    "  ✓ image captured [jpeg]\n",
+		},
+		{
+			name:    "no metadata",
+			content: `[{"type":"image","source":{"type":"base64","data":"iVBORw0KGgo="}}]`,
+			want:    "  ✓ image captured [image]\n",
+		},
+	}
+
+	// The message's tool_use_result can flag an image the content alone doesn't show
+	t.Run("flagged by tool_use_result", func(t *testing.T) {
+		p, w := newTestOutputProcessor(OutputModeText)
+		p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "mcp__browser__screenshot", nil))
+		msg := createTestToolResultMessage(createTestToolResultBlock("tool_1", "\x89PNG\x1a", false))
+		msg.ToolUseResult = &ToolUseResult{IsImage: true}
+		p.processMessage(msg)
+
+		if want := "  ✓ image captured [image]\n"; w.String() != want {
+			t.Errorf("expected %q, got %q", want, w.String())
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, w := newTestOutputProcessor(OutputModeText)
+			p.state.AddOrUpdateToolCall(createTestToolCall("tool_1", "mcp__browser__screenshot", nil))
+
+			var block ContentBlock
+			if err := json.Unmarshal([]byte(`{"type":"tool_result","tool_use_id":"tool_1","content":`+tt.content+`}`), &block); err != nil {
+				t.Fatal(err)
+			}
+			p.processToolResult(&block)
+
+			if w.String() != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, w.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// promptLogEntry is one line of the --log-prompts file
+type promptLogEntry struct {
+	Timestamp string `json:"timestamp"` // RFC 3339, when ccv started
+	Prompt    string `json:"prompt"`
+	SessionID string `json:"session_id,omitempty"` // Empty if claude never started a session
+	Cwd       string `json:"cwd,omitempty"`
+}
+
+// PromptLog records a run's prompt and session ID as a JSONL line in a personal history file
+type PromptLog struct {
+	path    string
+	entry   promptLogEntry
+	written bool
+}
+
+// NewPromptLog starts the log entry for a run. Nothing is written until the session
+// ID is known, so each run is a single line.
+func NewPromptLog(path, prompt string) *PromptLog {
+	cwd, _ := os.Getwd()
+	return &PromptLog{
+		path: path,
+		entry: promptLogEntry{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Prompt:    prompt,
+			Cwd:       cwd,
+		},
+	}
+}
+
+// SessionStarted records the session ID and writes the entry
+func (l *PromptLog) SessionStarted(sessionID string) error {
+	l.entry.SessionID = sessionID
+	return l.write()
+}
+
+// Close writes the entry if the session never started, so failed runs are still logged
+func (l *PromptLog) Close() error {
+	return l.write()
+}
+
+// write appends the entry once. The line goes out in a single append-mode write,
+// so concurrent ccv runs sharing a log don't interleave.
+func (l *PromptLog) write() error {
+	if l.written {
+		return nil
+	}
+	l.written = true
+
+	data, err := json.Marshal(l.entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("writing prompt log: %w", err)
+	}
+	return f.Close()
+}
+
+// claudeValueFlags are the claude flags that take a value as the following argument, so
+// that argument is never mistaken for the prompt
+var claudeValueFlags = map[string]bool{
+	"--model":                  true,
+	"--fallback-model":         true,
+	"--allowedTools":           true,
+	"--allowed-tools":          true,
+	"--disallowedTools":        true,
+	"--disallowed-tools":       true,
+	"--tools":                  true,
+	"--permission-mode":        true,
+	"--permission-prompt-tool": true,
+	"--system-prompt":          true,
+	"--append-system-prompt":   true,
+	"--output-format":          true,
+	"--input-format":           true,
+	"--max-turns":              true,
+	"--max-budget-usd":         true,
+	"--mcp-config":             true,
+	"--add-dir":                true,
+	"--settings":               true,
+	"--setting-sources":        true,
+	"--session-id":             true,
+	"--resume":                 true,
+	"-r":                       true,
+	"--agents":                 true,
+	"--json-schema":            true,
+	"--plugin-dir":             true,
+	"--betas":                  true,
+}
+
+// promptIndex finds the prompt among the arguments passed to claude: the first argument
+// that is neither a flag nor a flag's value. It returns -1 when there is no prompt.
+func promptIndex(args []string) int {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return i
+		}
+		if claudeValueFlags[arg] {
+			i++
+		}
+	}
+	return -1
+}
+
+// promptFromArgs picks the prompt out of the arguments passed to claude
+func promptFromArgs(args []string) string {
+	if i := promptIndex(args); i >= 0 {
+		return args[i]
+	}
+	return ""
+}
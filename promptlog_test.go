@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_LogPrompts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.jsonl")
+
+	for _, session := range []string{"session-one", "session-two"} {
+		runner := newScriptedRunner([]interface{}{
+			createTestSystemInit(session, "claude-sonnet-4-5"),
+			createTestResult(0.01, 1000, 1),
+		}, 0)
+		_, restore := useScriptedRunner(runner)
+
+		var out bytes.Buffer
+		code := run([]string{"--log-prompts", path, "--model", "sonnet", "Explain " + session}, &out)
+		restore()
+		if code != 0 {
+			t.Fatalf("run() = %d, want 0", code)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading prompt log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per run, got: %q", data)
+	}
+
+	var entry promptLogEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("invalid JSONL line %q: %v", lines[1], err)
+	}
+	if entry.Prompt != "Explain session-two" || entry.SessionID != "session-two" || entry.Timestamp == "" {
+		t.Errorf("expected prompt and session ID recorded, got: %+v", entry)
+	}
+}
+
+func TestPromptLog_CloseWithoutSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.jsonl")
+	log := NewPromptLog(path, "Never started")
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	// A second Close doesn't write the entry again
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "\n") != 1 || !strings.Contains(string(data), `"prompt":"Never started"`) {
+		t.Errorf("expected a single entry without a session ID, got: %q", data)
+	}
+}
+
+func TestPromptFromArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-p", "Fix the bug", "--allowedTools", "Bash,Read"}, "Fix the bug"},
+		{[]string{"--model", "sonnet", "Explain this"}, "Explain this"},
+		{[]string{"--model=sonnet", "Explain this", "--verbose"}, "Explain this"},
+		{[]string{"--resume", "abc123"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := promptFromArgs(tt.args); got != tt.want {
+			t.Errorf("promptFromArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileRunner replays captured stream-json output from a file (--replay), so a session
+// can be re-rendered with different settings without running claude
+type FileRunner struct {
+	file     *os.File
+	messages chan interface{}
+	errors   chan error
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+var _ Runner = (*FileRunner)(nil)
+
+// NewFileRunner opens the capture at path for replay
+func NewFileRunner(ctx context.Context, path string) (*FileRunner, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	runnerCtx, cancel := context.WithCancel(ctx)
+	return &FileRunner{
+		file:     file,
+		messages: make(chan interface{}, 100),
+		errors:   make(chan error, 10),
+		ctx:      runnerCtx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Start begins parsing the capture
+func (r *FileRunner) Start() error {
+	r.wg.Add(1)
+	go r.parseFile()
+	return nil
+}
+
+// parseFile reads the capture line by line, the same way live claude output is read
+func (r *FileRunner) parseFile() {
+	defer r.wg.Done()
+	defer close(r.messages)
+	defer r.file.Close()
+
+	// Add recovery to catch any panics during parsing
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			// Log panic to stderr and continue - CCV must never crash
+			fmt.Fprintf(os.Stderr, "Error: panic in parseFile: %v\n", recovered)
+		}
+	}()
+
+	if err := scanMessages(r.ctx, r.file, r.messages, r.errors); err != nil {
+		r.errors <- fmt.Errorf("error reading %s: %w", r.file.Name(), err)
+	}
+}
+
+// Messages returns the channel of parsed messages
+func (r *FileRunner) Messages() <-chan interface{} {
+	return r.messages
+}
+
+// Errors returns the channel of parse errors
+func (r *FileRunner) Errors() <-chan error {
+	return r.errors
+}
+
+// Wait waits for the capture to be read
+func (r *FileRunner) Wait() {
+	r.wg.Wait()
+}
+
+// Stop abandons the replay
+func (r *FileRunner) Stop() {
+	r.cancel()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun_Replay(t *testing.T) {
+	// Replaying must not start claude
+	runner := newScriptedRunner(nil, 0)
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	capture := writeSession(t, t.TempDir(), "capture.jsonl",
+		`{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet-4-5"}`,
+		``,
+		`{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"text","text":"Looking at the failing test."}]}}`,
+		`{"type":"assistant","message":{"id":"msg_2","role":"assis`,
+		`{"type":"assistant","message":{"id":"msg_3","role":"assistant","content":[{"type":"text","text":"Fixed the off-by-one."}]}}`,
+		`{"type":"result","subtype":"success","is_error":false,"total_cost_usd":0.02,"duration_ms":4000,"num_turns":2}`,
+	)
+
+	var out bytes.Buffer
+	if code := run([]string{"--no-color", "--replay", capture}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if *gotArgs != nil {
+		t.Errorf("expected claude not to run, got args: %q", *gotArgs)
+	}
+
+	output := out.String()
+	for _, want := range []string{"Looking at the failing test.", "Fixed the off-by-one.", "$0.0200"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in the replayed output (malformed lines are skipped), got: %q", want, output)
+		}
+	}
+
+	if code := run([]string{"--replay", capture + ".missing"}, &out); code != 1 {
+		t.Errorf("run() = %d for a missing capture, want 1", code)
+	}
+}
+
+// TestRun_ReplayToolResults tests results claude sends back in user messages render, failures included
+func TestRun_ReplayToolResults(t *testing.T) {
+	defer SetNoColor(false)
+
+	capture := writeSession(t, t.TempDir(), "capture.jsonl",
+		`{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet-4-5"}`,
+		`{"type":"stream_event","event":{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"Bash","input":{}}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"command\":\"go test ./...\"}"}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_stop","index":0}}`,
+		`{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"go test ./..."}}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"--- FAIL: TestLoad","is_error":true}]}}`,
+		`{"type":"result","subtype":"success","is_error":false,"total_cost_usd":0.02,"duration_ms":4000,"num_turns":2}`,
+	)
+
+	var out bytes.Buffer
+	if code := run([]string{"--no-color", "--replay", capture}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	output := out.String()
+	for _, want := range []string{"→ Bash: go test ./...", "--- FAIL: TestLoad", "Bash: 1 (1 failed)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in the replayed output, got: %q", want, output)
+		}
+	}
+}
@@ -2,26 +2,74 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
 )
 
+// Runner produces parsed messages and errors for the output processor.
+// ClaudeRunner is the production implementation backed by the claude CLI.
+type Runner interface {
+	Start() error
+	Messages() <-chan interface{}
+	Errors() <-chan error
+	Wait()
+	Stop()
+}
+
 // ClaudeRunner manages the Claude subprocess and message parsing
 type ClaudeRunner struct {
-	cmd        *exec.Cmd
-	stdout     io.ReadCloser
-	stderr     io.ReadCloser
-	stdin      io.WriteCloser
-	messages   chan interface{}
-	errors     chan error
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
+	cmd          *exec.Cmd
+	stdout       io.ReadCloser
+	stderr       io.ReadCloser
+	stdin        io.WriteCloser
+	messages     chan interface{}
+	errors       chan error
+	stderrLines  chan string    // non-nil when stderr is merged into the rendered output
+	stderrFilter *regexp.Regexp // stderr lines to drop (nil forwards everything)
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+var _ Runner = (*ClaudeRunner)(nil)
+
+// benignStderrPatterns match informational stderr lines that --quiet-errors drops
+var benignStderrPatterns = []string{
+	`ExperimentalWarning`,
+	`DeprecationWarning`,
+	`\(Use .node --trace-(warnings|deprecation) .*\)`,
+	`^Debugger (attached|listening)`,
+	`^Waiting for the debugger to disconnect`,
+	`^npm (WARN|notice)`,
+}
+
+// errorStderrPattern matches lines that look like genuine errors, which are never filtered
+var errorStderrPattern = regexp.MustCompile(`(?i)\b(error|fatal|panic|failed|exception|denied)\b`)
+
+// NewStderrFilter builds the pattern for stderr lines to drop from the default benign
+// patterns (when quiet is set) and an optional user regex. It returns nil when nothing is filtered.
+func NewStderrFilter(quiet bool, userPattern string) (*regexp.Regexp, error) {
+	var patterns []string
+	if quiet {
+		patterns = append(patterns, benignStderrPatterns...)
+	}
+	if userPattern != "" {
+		if _, err := regexp.Compile(userPattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, userPattern)
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile("(?:" + strings.Join(patterns, ")|(?:") + ")")
 }
 
 // hasFlag checks if a flag is already present in the args slice.
@@ -51,8 +99,107 @@ func hasFlagValue(args []string, flag, value string) bool {
 	return false
 }
 
+// defaultClaudeCommand runs the claude CLI from PATH
+var defaultClaudeCommand = []string{"claude"}
+
+// claudeCommand resolves --claude-cmd (a command line, e.g. "npx claude-code") or
+// --claude-bin (a single binary path) to the argv prefix claude is run with. It fails
+// if the program isn't found, so a typo is reported before anything starts.
+func claudeCommand(cmdline, bin string) ([]string, error) {
+	command := defaultClaudeCommand
+	switch {
+	case cmdline != "" && bin != "":
+		return nil, fmt.Errorf("--claude-cmd and --claude-bin can't be combined")
+	case cmdline != "":
+		words, err := splitCommand(cmdline)
+		if err != nil {
+			return nil, fmt.Errorf("--claude-cmd: %w", err)
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("--claude-cmd is empty")
+		}
+		command = words
+	case bin != "":
+		command = []string{bin}
+	default:
+		return command, nil
+	}
+
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return nil, err
+	}
+	return command, nil
+}
+
+// splitCommand splits a command line into words like a POSIX shell: whitespace separates
+// words, single quotes keep text literally, and double quotes and backslashes escape.
+// Expansions, pipes and redirections are not supported.
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+				i++
+				word.WriteRune(runes[i])
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				word.WriteRune(runes[i])
+			}
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
 // NewClaudeRunner creates a new Claude subprocess runner
 func NewClaudeRunner(ctx context.Context, args []string) (*ClaudeRunner, error) {
+	return NewClaudeRunnerWithCommand(ctx, defaultClaudeCommand, args)
+}
+
+// NewClaudeRunnerWithCommand creates a Claude subprocess runner that starts claude with
+// command, e.g. ["npx", "claude-code"] for a wrapper, followed by the claude arguments
+func NewClaudeRunnerWithCommand(ctx context.Context, command []string, args []string) (*ClaudeRunner, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("empty claude command")
+	}
+
 	// Create cancellable context
 	runnerCtx, cancel := context.WithCancel(ctx)
 
@@ -82,7 +229,8 @@ func NewClaudeRunner(ctx context.Context, args []string) (*ClaudeRunner, error)
 	claudeArgs = append(claudeArgs, args...)
 
 	// Create command
-	cmd := exec.CommandContext(runnerCtx, "claude", claudeArgs...)
+	argv := append(append([]string(nil), command[1:]...), claudeArgs...)
+	cmd := exec.CommandContext(runnerCtx, command[0], argv...)
 
 	// Get pipes - clean up previously created pipes on error
 	stdout, err := cmd.StdoutPipe()
@@ -159,7 +307,17 @@ func (r *ClaudeRunner) parseStdout() {
 		}
 	}()
 
-	scanner := bufio.NewScanner(r.stdout)
+	// Stopping closes the pipe under the scanner, which isn't worth reporting
+	if err := scanMessages(r.ctx, r.stdout, r.messages, r.errors); err != nil && r.ctx.Err() == nil {
+		r.errors <- fmt.Errorf("error reading stdout: %w", err)
+	}
+}
+
+// scanMessages parses NDJSON lines from in and sends each message on messages, until in
+// is exhausted or ctx is canceled. Lines that fail to parse are reported on errors and
+// skipped. It returns the error that stopped reading, if any.
+func scanMessages(ctx context.Context, in io.Reader, messages chan<- interface{}, errors chan<- error) error {
+	scanner := bufio.NewScanner(in)
 	// Increase buffer size for large messages
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024) // 1MB max
@@ -167,7 +325,8 @@ func (r *ClaudeRunner) parseStdout() {
 	lineNum := 0
 	for scanner.Scan() {
 		lineNum++
-		line := scanner.Bytes()
+		// Transcripts written on Windows end lines with \r\n
+		line := bytes.TrimSuffix(scanner.Bytes(), []byte("\r"))
 
 		// Skip empty lines
 		if len(line) == 0 {
@@ -177,21 +336,18 @@ func (r *ClaudeRunner) parseStdout() {
 		// Parse the JSON message
 		msg, err := ParseMessage(line)
 		if err != nil {
-			r.errors <- fmt.Errorf("line %d: failed to parse message: %w", lineNum, err)
+			errors <- fmt.Errorf("line %d: failed to parse message: %w", lineNum, err)
 			continue
 		}
 
 		// Send parsed message to channel
 		select {
-		case r.messages <- msg:
-		case <-r.ctx.Done():
-			return
+		case messages <- msg:
+		case <-ctx.Done():
+			return nil
 		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		r.errors <- fmt.Errorf("error reading stdout: %w", err)
-	}
+	return scanner.Err()
 }
 
 // forwardStderr forwards stderr to os.Stderr
@@ -206,21 +362,52 @@ func (r *ClaudeRunner) forwardStderr() {
 		}
 	}()
 
+	if r.stderrLines != nil {
+		defer close(r.stderrLines)
+	}
+
 	scanner := bufio.NewScanner(r.stderr)
 	for scanner.Scan() {
+		// Unlike stdout, stderr reaches the terminal without passing through a JSON decoder
+		line := sanitizeUTF8(scanner.Text())
+		if r.dropStderrLine(line) {
+			continue
+		}
+
+		if r.stderrLines != nil {
+			// Merged mode: hand the line to the output processor
+			select {
+			case r.stderrLines <- line:
+			case <-r.ctx.Done():
+				return
+			}
+			continue
+		}
+
 		select {
 		case <-r.ctx.Done():
 			return
 		default:
-			fmt.Fprintln(os.Stderr, scanner.Text())
+			fmt.Fprintln(os.Stderr, line)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := scanner.Err(); err != nil && r.ctx.Err() == nil {
 		r.errors <- fmt.Errorf("error reading stderr: %w", err)
 	}
 }
 
+// FilterStderr drops stderr lines matching filter unless they look like errors.
+// It must be called before Start.
+func (r *ClaudeRunner) FilterStderr(filter *regexp.Regexp) {
+	r.stderrFilter = filter
+}
+
+// dropStderrLine reports whether a stderr line is filtered out
+func (r *ClaudeRunner) dropStderrLine(line string) bool {
+	return r.stderrFilter != nil && r.stderrFilter.MatchString(line) && !errorStderrPattern.MatchString(line)
+}
+
 // waitForCompletion waits for the process to complete
 func (r *ClaudeRunner) waitForCompletion() {
 	defer r.wg.Done()
@@ -256,6 +443,15 @@ func (r *ClaudeRunner) Errors() <-chan error {
 	return r.errors
 }
 
+// MergeStderr routes stderr lines to the returned channel instead of os.Stderr,
+// so they can be rendered inline with the formatted output. Must be called before Start.
+func (r *ClaudeRunner) MergeStderr() <-chan string {
+	if r.stderrLines == nil {
+		r.stderrLines = make(chan string, 100)
+	}
+	return r.stderrLines
+}
+
 // Wait waits for all goroutines to complete
 func (r *ClaudeRunner) Wait() {
 	r.wg.Wait()
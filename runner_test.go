@@ -1154,6 +1154,145 @@ func TestClaudeRunner_forwardStderr_ContextCancellation(t *testing.T) {
 	// If this test completes without hanging, cancellation worked
 }
 
+// TestClaudeRunner_forwardStderr_Merged tests stderr lines go to the merge channel instead of os.Stderr
+func TestClaudeRunner_forwardStderr_Merged(t *testing.T) {
+	input := "warning: slow network\nerror: retrying\n"
+
+	readIndex := 0
+	mockStderr := &mockReadCloser{
+		readFunc: func(p []byte) (int, error) {
+			if readIndex >= len(input) {
+				return 0, io.EOF
+			}
+			n := copy(p, input[readIndex:])
+			readIndex += n
+			return n, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := &ClaudeRunner{
+		stderr: mockStderr,
+		errors: make(chan error, 10),
+		ctx:    ctx,
+	}
+	lines := runner.MergeStderr()
+
+	runner.wg.Add(1)
+	go runner.forwardStderr()
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	runner.Wait()
+
+	if len(got) != 2 || got[0] != "warning: slow network" || got[1] != "error: retrying" {
+		t.Errorf("expected both stderr lines on the merge channel, got: %v", got)
+	}
+}
+
+// TestClaudeRunner_forwardStderr_InvalidUTF8 tests invalid bytes on stderr are replaced before forwarding
+func TestClaudeRunner_forwardStderr_InvalidUTF8(t *testing.T) {
+	input := "grep: caf\xe9 \xff\xfe matched\n"
+
+	readIndex := 0
+	mockStderr := &mockReadCloser{
+		readFunc: func(p []byte) (int, error) {
+			if readIndex >= len(input) {
+				return 0, io.EOF
+			}
+			n := copy(p, input[readIndex:])
+			readIndex += n
+			return n, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := &ClaudeRunner{
+		stderr: mockStderr,
+		errors: make(chan error, 10),
+		ctx:    ctx,
+	}
+	lines := runner.MergeStderr()
+
+	runner.wg.Add(1)
+	go runner.forwardStderr()
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	runner.Wait()
+
+	if len(got) != 1 || got[0] != "grep: caf� � matched" {
+		t.Errorf("expected invalid bytes replaced, got: %q", got)
+	}
+}
+
+func TestClaudeRunner_forwardStderr_Filtered(t *testing.T) {
+	input := "(node:1234) ExperimentalWarning: Fetch API is experimental\n" +
+		"(Use `node --trace-warnings ...` to show where the warning was created)\n" +
+		"Error: connection refused\n" +
+		"noisy progress 50%\n" +
+		"noisy but failed: disk full\n"
+
+	readIndex := 0
+	mockStderr := &mockReadCloser{
+		readFunc: func(p []byte) (int, error) {
+			if readIndex >= len(input) {
+				return 0, io.EOF
+			}
+			n := copy(p, input[readIndex:])
+			readIndex += n
+			return n, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	filter, err := NewStderrFilter(true, `^noisy`)
+	if err != nil {
+		t.Fatalf("NewStderrFilter: %v", err)
+	}
+
+	runner := &ClaudeRunner{
+		stderr: mockStderr,
+		errors: make(chan error, 10),
+		ctx:    ctx,
+	}
+	runner.FilterStderr(filter)
+	lines := runner.MergeStderr()
+
+	runner.wg.Add(1)
+	go runner.forwardStderr()
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	runner.Wait()
+
+	want := []string{"Error: connection refused", "noisy but failed: disk full"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected only error lines forwarded, got: %v", got)
+	}
+}
+
+func TestNewStderrFilter(t *testing.T) {
+	if filter, err := NewStderrFilter(false, ""); filter != nil || err != nil {
+		t.Errorf("expected no filter without options, got %v, %v", filter, err)
+	}
+	if _, err := NewStderrFilter(false, "("); err == nil {
+		t.Error("expected error for an invalid pattern")
+	}
+}
+
 // ==================== waitForCompletion Comprehensive Tests ====================
 
 // TestClaudeRunner_waitForCompletion_SuccessfulExit tests successful process completion
@@ -1261,6 +1400,36 @@ func TestClaudeRunner_waitForCompletion_ContextCancellation(t *testing.T) {
 	runner.Wait()
 }
 
+// TestClaudeRunner_StopReportsNoReadErrors tests stopping a running claude, as --head,
+// --interrupt-after and --max-tokens do, doesn't report its pipes closing under the readers
+func TestClaudeRunner_StopReportsNoReadErrors(t *testing.T) {
+	// The background sleep holds the pipes open after sh is killed, as claude's own child processes do
+	script := `echo '{"type":"system","subtype":"init","session_id":"s1"}'; sleep 2 & wait`
+	runner, err := NewClaudeRunnerWithCommand(context.Background(), []string{"sh", "-c", script}, nil)
+	if err != nil {
+		t.Fatalf("NewClaudeRunnerWithCommand failed: %v", err)
+	}
+	if err := runner.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	select {
+	case <-runner.Messages():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the first message")
+	}
+	runner.Stop()
+
+	for {
+		select {
+		case err := <-runner.Errors():
+			t.Errorf("unexpected error after Stop: %v", err)
+		default:
+			return
+		}
+	}
+}
+
 // ==================== Integration Tests ====================
 
 // TestClaudeRunner_FullLifecycle tests full lifecycle with mock subprocess
@@ -1341,3 +1510,101 @@ func TestClaudeRunner_Stop_Integration(t *testing.T) {
 		t.Error("Stop() did not complete goroutines within timeout")
 	}
 }
+
+// TestClaudeRunner_parseStdout_CRLF tests CRLF-terminated JSONL renders without stray carriage returns
+func TestClaudeRunner_parseStdout_CRLF(t *testing.T) {
+	input := strings.Join([]string{
+		`{"type":"stream_event","event":{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"t1","name":"Bash","input":{}}}}`,
+		`{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"dir"}}]}}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_result","tool_use_id":"t1","content":"main.go\r\ngo.mod\r\n"}]}}`,
+	}, "\r\n") + "\r\n"
+
+	runner := &ClaudeRunner{
+		stdout:   io.NopCloser(strings.NewReader(input)),
+		messages: make(chan interface{}, 10),
+		errors:   make(chan error, 10),
+		ctx:      context.Background(),
+	}
+	runner.wg.Add(1)
+	runner.parseStdout()
+
+	if len(runner.errors) != 0 {
+		t.Fatalf("unexpected parse error: %v", <-runner.errors)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	for msg := range runner.messages {
+		p.processMessage(msg)
+	}
+
+	output := w.String()
+	if strings.Contains(output, "\r") {
+		t.Errorf("expected no carriage returns in rendered output, got: %q", output)
+	}
+	if !strings.Contains(output, "→ Bash: dir\n  main.go\n  go.mod\n") {
+		t.Errorf("expected clean tool output, got: %q", output)
+	}
+}
+
+// TestNewClaudeRunnerWithCommand tests a multi-word command prefixes the claude argv
+func TestNewClaudeRunnerWithCommand(t *testing.T) {
+	command, err := claudeCommand(`env 'CLAUDE_CONFIG_DIR=/tmp/my config' claude`, "")
+	if err != nil {
+		t.Fatalf("claudeCommand failed: %v", err)
+	}
+
+	runner, err := NewClaudeRunnerWithCommand(context.Background(), command, []string{"--print", "hello"})
+	if err != nil {
+		t.Fatalf("NewClaudeRunnerWithCommand failed: %v", err)
+	}
+	defer runner.cancel()
+
+	want := []string{"env", "CLAUDE_CONFIG_DIR=/tmp/my config", "claude", "--output-format", "stream-json", "--include-partial-messages", "--verbose", "--print", "hello"}
+	if strings.Join(runner.cmd.Args, "|") != strings.Join(want, "|") {
+		t.Errorf("argv = %q, want %q", runner.cmd.Args, want)
+	}
+}
+
+func TestClaudeCommand(t *testing.T) {
+	if got, err := claudeCommand("", ""); err != nil || strings.Join(got, " ") != "claude" {
+		t.Errorf("claudeCommand() = %q, %v; want the default claude", got, err)
+	}
+	if got, err := claudeCommand("", "env"); err != nil || strings.Join(got, " ") != "env" {
+		t.Errorf("claudeCommand(bin) = %q, %v; want [env]", got, err)
+	}
+	if _, err := claudeCommand("no-such-claude-wrapper --flag", ""); err == nil {
+		t.Error("expected an error for an unresolvable command")
+	}
+	if _, err := claudeCommand("env", "env"); err == nil {
+		t.Error("expected an error combining --claude-cmd and --claude-bin")
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"npx claude-code", []string{"npx", "claude-code"}},
+		{"  npx   claude-code  ", []string{"npx", "claude-code"}},
+		{`docker run -e 'A=b c' img`, []string{"docker", "run", "-e", "A=b c", "img"}},
+		{`sh -c "exec \"claude\" \$@"`, []string{"sh", "-c", `exec "claude" $@`}},
+		{`my\ claude`, []string{"my claude"}},
+		{`claude ''`, []string{"claude", ""}},
+	}
+
+	for _, tt := range tests {
+		got, err := splitCommand(tt.input)
+		if err != nil {
+			t.Errorf("splitCommand(%q) error: %v", tt.input, err)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	if _, err := splitCommand(`npx "claude-code`); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+}
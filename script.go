@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// scriptTools are the tools with side effects that --format script records. Everything else
+// only reads, so it is left out.
+var scriptTools = map[string]bool{
+	"Bash":         true,
+	"Edit":         true,
+	"MultiEdit":    true,
+	"Write":        true,
+	"NotebookEdit": true,
+}
+
+// scriptMessage writes a message's side effects as shell script lines (--format script)
+func (p *OutputProcessor) scriptMessage(msg interface{}) {
+	switch m := msg.(type) {
+	case *SystemInit:
+		if !p.scriptStarted {
+			p.scriptStarted = true
+			fmt.Fprintln(p.writer, "#!/usr/bin/env bash")
+		}
+		if m.SessionID != "" {
+			fmt.Fprintf(p.writer, "# claude session %s\n", m.SessionID)
+		}
+	case *AssistantMessage:
+		for _, block := range m.Message.Content {
+			if block.Type != ContentBlockTypeToolUse || !scriptTools[block.Name] {
+				continue
+			}
+			// A tool call can be repeated in later messages of the same turn
+			if p.scripted[block.ID] {
+				continue
+			}
+			if p.scripted == nil {
+				p.scripted = make(map[string]bool)
+			}
+			p.scripted[block.ID] = true
+
+			if line := scriptLine(block.Name, block.Input); line != "" {
+				fmt.Fprintln(p.writer, line)
+			}
+		}
+	}
+}
+
+// scriptLine renders one tool call for the script: a Bash command as is, and a file change
+// as a comment describing it, e.g. "# Edit cmd/main.go"
+func scriptLine(name string, input json.RawMessage) string {
+	var inputMap map[string]interface{}
+	if err := json.Unmarshal(input, &inputMap); err != nil {
+		return ""
+	}
+
+	path, _ := inputMap["file_path"].(string)
+	if name == "NotebookEdit" {
+		path, _ = inputMap["notebook_path"].(string)
+	}
+
+	switch name {
+	case "Bash":
+		command, _ := inputMap["command"].(string)
+		return strings.TrimSpace(command)
+	case "Write":
+		content, _ := inputMap["content"].(string)
+		lines := strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+		if content == "" {
+			lines = 0
+		}
+		return fmt.Sprintf("# Write %s (%d lines)", path, lines)
+	case "MultiEdit":
+		edits, _ := inputMap["edits"].([]interface{})
+		return fmt.Sprintf("# MultiEdit %s (%d edits)", path, len(edits))
+	}
+	return fmt.Sprintf("# %s %s", name, path)
+}
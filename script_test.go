@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun_FormatScript(t *testing.T) {
+	bash := createTestToolUseBlock("tool_1", "Bash", map[string]interface{}{"command": "go test ./...", "description": "Run the tests"})
+	read := createTestToolUseBlock("tool_2", "Read", map[string]interface{}{"file_path": "main.go"})
+	edit := createTestToolUseBlock("tool_3", "Edit", map[string]interface{}{"file_path": "main.go", "old_string": "a", "new_string": "b"})
+	runner := newScriptedRunner([]interface{}{
+		createTestSystemInit("session-script", "claude-sonnet-4-5"),
+		createTestAssistantMessage([]ContentBlock{{Type: ContentBlockTypeText, Text: "Running the tests."}, *bash}),
+		createTestAssistantMessage([]ContentBlock{*read, *edit}),
+		createTestAssistantMessage([]ContentBlock{*bash}),
+		createTestResult(0.01, 1000, 2),
+	}, 0)
+	_, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out bytes.Buffer
+	if code := run([]string{"--format", "script", "fix the tests"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+
+	want := "#!/usr/bin/env bash\n# claude session session-script\ngo test ./...\n# Edit main.go\n"
+	if out.String() != want {
+		t.Errorf("expected the Bash command and the edit only\nwant: %q\ngot:  %q", want, out.String())
+	}
+	if strings.Contains(out.String(), "Read") {
+		t.Errorf("expected read-only tools left out, got: %q", out.String())
+	}
+}
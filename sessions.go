@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sessionsIndex is the sessions-index.json claude keeps in each project directory
+type sessionsIndex struct {
+	Entries []sessionIndexEntry `json:"entries"`
+}
+
+// sessionIndexEntry describes one session of a project
+type sessionIndexEntry struct {
+	SessionID string    `json:"sessionId"`
+	FileMtime int64     `json:"fileMtime"` // Unix milliseconds of the transcript's last write
+	Modified  time.Time `json:"modified"`
+}
+
+// mtime returns when the session was last written, preferring the transcript mtime
+func (e sessionIndexEntry) mtime() time.Time {
+	if e.FileMtime > 0 {
+		return time.UnixMilli(e.FileMtime)
+	}
+	return e.Modified
+}
+
+// claudeProjectsDir returns the directory claude stores per-project sessions in,
+// honoring CLAUDE_CONFIG_DIR like claude itself
+func claudeProjectsDir() (string, error) {
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "projects"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".claude", "projects"), nil
+}
+
+// projectDirPattern matches the characters claude replaces when naming project directories
+var projectDirPattern = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+// projectDir resolves a --project value to its session directory. The value is either
+// a directory name under projectsDir (e.g. -home-me-repo) or a path to the project itself.
+// A bare name that is neither is an error rather than a guess.
+func projectDir(projectsDir, project string) (string, error) {
+	if !strings.ContainsRune(project, filepath.Separator) && project != "." {
+		if info, err := os.Stat(filepath.Join(projectsDir, project)); err == nil && info.IsDir() {
+			return filepath.Join(projectsDir, project), nil
+		}
+		if info, err := os.Stat(project); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("project %s not found under %s", project, projectsDir)
+		}
+	}
+	if abs, err := filepath.Abs(project); err == nil {
+		project = abs
+	}
+	return filepath.Join(projectsDir, projectDirPattern.ReplaceAllString(project, "-")), nil
+}
+
+// latestSession returns the ID of the most recently modified session in a project directory.
+// It reads sessions-index.json, falling back to the transcripts' mtimes when there is no index.
+func latestSession(dir string) (string, error) {
+	var entries []sessionIndexEntry
+
+	data, err := os.ReadFile(filepath.Join(dir, "sessions-index.json"))
+	if err == nil {
+		var index sessionsIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return "", fmt.Errorf("reading sessions index: %w", err)
+		}
+		entries = index.Entries
+	} else {
+		transcripts, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+		for _, path := range transcripts {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, sessionIndexEntry{
+				SessionID: strings.TrimSuffix(filepath.Base(path), ".jsonl"),
+				Modified:  info.ModTime(),
+			})
+		}
+	}
+
+	var latest sessionIndexEntry
+	for _, entry := range entries {
+		if entry.SessionID != "" && (latest.SessionID == "" || entry.mtime().After(latest.mtime())) {
+			latest = entry
+		}
+	}
+	if latest.SessionID == "" {
+		return "", fmt.Errorf("no sessions found in %s", dir)
+	}
+	return latest.SessionID, nil
+}
+
+// maxPromptPreviewLen caps how much of a session's first prompt --validate-resume shows
+const maxPromptPreviewLen = 60
+
+// sessionInfo is what --validate-resume reports about a session before resuming it
+type sessionInfo struct {
+	Model       string
+	FirstPrompt string
+}
+
+// inspectSession checks a session transcript is well-formed and picks out its model and
+// first prompt. Every line must be valid JSON, and at least one must be a claude message;
+// lines of types ccv doesn't know are allowed, as in --compare.
+func inspectSession(path string) (sessionInfo, error) {
+	var info sessionInfo
+
+	f, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+
+	messages := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSuffix(scanner.Bytes(), []byte("\r"))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		msg, err := ParseMessage(line)
+		if err != nil {
+			return info, fmt.Errorf("%s is corrupt at line %d: %v", path, n, err)
+		}
+
+		switch m := msg.(type) {
+		case *SystemInit:
+			messages++
+			if info.Model == "" {
+				info.Model = m.Model
+			}
+		case *AssistantMessage:
+			messages++
+			if info.Model == "" {
+				info.Model = m.Message.Model
+			}
+		case *UserMessage:
+			messages++
+			if info.FirstPrompt == "" {
+				info.FirstPrompt = promptText(m.Message.Content)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return info, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if messages == 0 {
+		return info, fmt.Errorf("%s holds no claude messages", path)
+	}
+	return info, nil
+}
+
+// promptText returns the first line of a user message's text, shortened for display.
+// Tool results carry no prompt, so they give "".
+func promptText(blocks []ContentBlock) string {
+	for _, block := range blocks {
+		if block.Type != ContentBlockTypeText {
+			continue
+		}
+		text := strings.TrimSpace(block.Text)
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[:i] + " …"
+		}
+		if runes := []rune(text); len(runes) > maxPromptPreviewLen {
+			text = string(runes[:maxPromptPreviewLen]) + "…"
+		}
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// resumeSessionID returns the session ID claude's --resume (or -r) is given in args, if any
+func resumeSessionID(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--resume="); ok {
+			return value
+		}
+		if (arg == "--resume" || arg == "-r") && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// continuesSession reports whether args pass claude's --continue (or -c)
+func continuesSession(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--continue" || arg == "-c" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateResume finds the transcript of the session being resumed in project (default:
+// the current directory) and checks it with inspectSession (--validate-resume)
+func validateResume(project, sessionID string) (sessionInfo, error) {
+	if project == "" {
+		project = "."
+	}
+	projectsDir, err := claudeProjectsDir()
+	if err != nil {
+		return sessionInfo{}, err
+	}
+	dir, err := projectDir(projectsDir, project)
+	if err != nil {
+		return sessionInfo{}, err
+	}
+	path := filepath.Join(dir, sessionID+".jsonl")
+	if _, err := os.Stat(path); err != nil {
+		return sessionInfo{}, fmt.Errorf("session %s not found (looked for %s)", sessionID, path)
+	}
+	return inspectSession(path)
+}
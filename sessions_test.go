@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatestSession_Index(t *testing.T) {
+	dir := t.TempDir()
+	index := `{"version":1,"entries":[
+		{"sessionId":"older","fileMtime":1760000000000},
+		{"sessionId":"newer","fileMtime":1760000500000}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "sessions-index.json"), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := latestSession(dir)
+	if err != nil {
+		t.Fatalf("latestSession() error: %v", err)
+	}
+	if got != "newer" {
+		t.Errorf("latestSession() = %q, want %q", got, "newer")
+	}
+}
+
+func TestLatestSession_NoSessions(t *testing.T) {
+	if _, err := latestSession(t.TempDir()); err == nil {
+		t.Error("expected an error for a project without sessions")
+	}
+}
+
+func TestRun_Reconnect(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CLAUDE_CONFIG_DIR", configDir)
+
+	// No index, so the transcripts' mtimes decide
+	dir := filepath.Join(configDir, "projects", "-home-me-repo")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for id, age := range map[string]time.Duration{"session-old": time.Hour, "session-new": time.Minute} {
+		path := filepath.Join(dir, id+".jsonl")
+		if err := os.WriteFile(path, []byte("{}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner := newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+
+	var out bytes.Buffer
+	if code := run([]string{"--reconnect", "--project", "-home-me-repo", "Keep going"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if got := strings.Join(*gotArgs, " "); got != "--resume session-new Keep going" {
+		t.Errorf("expected the newer session resumed, got args: %q", got)
+	}
+
+	// A project without sessions is an error
+	if code := run([]string{"--reconnect", "--project", "-home-me-elsewhere", "Keep going"}, &out); code != 1 {
+		t.Errorf("run() = %d for a project without sessions, want 1", code)
+	}
+}
+
+// TestProjectDir tests --project values resolve to a session directory by name or by path
+func TestProjectDir(t *testing.T) {
+	projectsDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(projectsDir, "-home-me-repo"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if dir, err := projectDir(projectsDir, "-home-me-repo"); err != nil || dir != filepath.Join(projectsDir, "-home-me-repo") {
+		t.Errorf("projectDir(name) = %q, %v; want the named directory", dir, err)
+	}
+	project := t.TempDir()
+	want := filepath.Join(projectsDir, projectDirPattern.ReplaceAllString(project, "-"))
+	if dir, err := projectDir(projectsDir, project); err != nil || dir != want {
+		t.Errorf("projectDir(path) = %q, %v; want %q", dir, err, want)
+	}
+
+	// An unknown name isn't taken for a path under the current directory
+	_, err := projectDir(projectsDir, "-home-me-typo")
+	if err == nil || !strings.Contains(err.Error(), "project -home-me-typo not found under "+projectsDir) {
+		t.Errorf("expected a not-found error for an unknown project name, got: %v", err)
+	}
+}
+
+func TestRun_Resume(t *testing.T) {
+	defer SetNoColor(false)
+	for _, tc := range []struct {
+		args     []string
+		wantArgs string
+		banner   string
+	}{
+		{[]string{"--resume", "session-abc", "Keep going"}, "--resume session-abc Keep going", "[Resuming session: session-abc]\n"},
+		{[]string{"--resume=session-abc", "Keep going"}, "--resume session-abc Keep going", "[Resuming session: session-abc]\n"},
+		{[]string{"--continue", "Keep going"}, "--continue Keep going", ""},
+	} {
+		runner := newScriptedRunner([]interface{}{createTestSystemInit("session-abc", "claude-sonnet-4-5")}, 0)
+		gotArgs, restore := useScriptedRunner(runner)
+
+		var out bytes.Buffer
+		if code := run(append([]string{"--no-color"}, tc.args...), &out); code != 0 {
+			t.Fatalf("run(%q) = %d, want 0", tc.args, code)
+		}
+		restore()
+		if got := strings.Join(*gotArgs, " "); got != tc.wantArgs {
+			t.Errorf("run(%q) passed claude %q, want %q", tc.args, got, tc.wantArgs)
+		}
+		if !strings.HasPrefix(out.String(), tc.banner+"[Session started") {
+			t.Errorf("run(%q) expected %q before the stream, got: %q", tc.args, tc.banner, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if code := run([]string{"--resume", "session-abc", "--continue", "Keep going"}, &out); code != 1 {
+		t.Errorf("run() = %d for --resume with --continue, want 1", code)
+	}
+}
+
+func TestInspectSession(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.jsonl")
+	transcript := `{"type":"system","subtype":"init","session_id":"abc","model":"claude-sonnet-4-5"}
+{"type":"user","message":{"role":"user","content":"Fix the login bug\nin auth.go"}}
+{"type":"summary","summary":"ccv doesn't know this line"}
+{"type":"assistant","message":{"id":"msg_1","role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"On it."}]}}
+`
+	if err := os.WriteFile(valid, []byte(transcript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := inspectSession(valid)
+	if err != nil {
+		t.Fatalf("inspectSession() error: %v", err)
+	}
+	if info.Model != "claude-sonnet-4-5" || info.FirstPrompt != "Fix the login bug …" {
+		t.Errorf("unexpected session info: %+v", info)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.jsonl")
+	if err := os.WriteFile(corrupt, []byte(transcript[:strings.Index(transcript, "\n")+20]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inspectSession(corrupt); err == nil || !strings.Contains(err.Error(), "corrupt at line 2") {
+		t.Errorf("expected a corrupt line 2 error, got: %v", err)
+	}
+
+	empty := filepath.Join(dir, "empty.jsonl")
+	if err := os.WriteFile(empty, []byte("\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inspectSession(empty); err == nil {
+		t.Error("expected an error for a transcript without messages")
+	}
+}
+
+func TestRun_ValidateResume(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CLAUDE_CONFIG_DIR", configDir)
+
+	dir := filepath.Join(configDir, "projects", "-home-me-repo")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sessions := map[string]string{
+		"session-ok":      `{"type":"system","subtype":"init","session_id":"session-ok","model":"claude-opus-4-1"}` + "\n" + `{"type":"user","message":{"role":"user","content":"Add tests"}}` + "\n",
+		"session-corrupt": `{"type":"system","subtype":"init","sess` + "\n",
+	}
+	for id, data := range sessions {
+		if err := os.WriteFile(filepath.Join(dir, id+".jsonl"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner := newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--no-color", "--validate-resume", "--project", "-home-me-repo", "--resume", "session-ok", "Keep going"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if !strings.HasPrefix(out.String(), `[Resuming session-ok (claude-opus-4-1): "Add tests"]`) {
+		t.Errorf("expected the session to be identified, got: %q", out.String())
+	}
+	if got := strings.Join(*gotArgs, " "); got != "--resume session-ok Keep going" {
+		t.Errorf("expected --resume passed through to claude, got args: %q", got)
+	}
+
+	// Formats meant for other programs keep the banner out of stdout
+	out.Reset()
+	runner = newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	_, restoreJSON := useScriptedRunner(runner)
+	defer restoreJSON()
+	if code := run([]string{"--format", "json", "--validate-resume", "--project", "-home-me-repo", "--resume", "session-ok", "Keep going"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if strings.Contains(out.String(), "Resuming") {
+		t.Errorf("expected only JSON on stdout, got: %q", out.String())
+	}
+
+	// A corrupt or missing transcript stops ccv before claude runs
+	for _, id := range []string{"session-corrupt", "session-missing"} {
+		*gotArgs = nil
+		if code := run([]string{"--validate-resume", "--project", "-home-me-repo", "--resume", id, "Keep going"}, &out); code != 1 {
+			t.Errorf("run() = %d for %s, want 1", code, id)
+		}
+		if *gotArgs != nil {
+			t.Errorf("expected claude not to run for %s", id)
+		}
+	}
+}
+
+// TestRun_ValidateResumeContinue tests --validate-resume checks the session --continue picks up,
+// the most recent one of the current directory
+func TestRun_ValidateResumeContinue(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CLAUDE_CONFIG_DIR", configDir)
+	t.Chdir(t.TempDir())
+
+	dir, err := projectDir(filepath.Join(configDir, "projects"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	transcript := `{"type":"system","subtype":"init","session_id":"session-last","model":"claude-opus-4-1"}` + "\n" + `{"type":"user","message":{"role":"user","content":"Add tests"}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "session-last.jsonl"), []byte(transcript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0)
+	gotArgs, restore := useScriptedRunner(runner)
+	defer restore()
+	defer SetNoColor(false)
+
+	var out bytes.Buffer
+	if code := run([]string{"--no-color", "--validate-resume", "--continue", "Keep going"}, &out); code != 0 {
+		t.Fatalf("run() = %d, want 0", code)
+	}
+	if !strings.HasPrefix(out.String(), `[Resuming session-last (claude-opus-4-1): "Add tests"]`) {
+		t.Errorf("expected the continued session to be identified, got: %q", out.String())
+	}
+	if got := strings.Join(*gotArgs, " "); got != "--continue Keep going" {
+		t.Errorf("expected --continue passed through to claude, got args: %q", got)
+	}
+
+	// Nothing to continue is an error before claude runs
+	if err := os.Remove(filepath.Join(dir, "session-last.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	*gotArgs = nil
+	if code := run([]string{"--validate-resume", "-c", "Keep going"}, &out); code != 1 {
+		t.Errorf("run() = %d with no session to continue, want 1", code)
+	}
+	if *gotArgs != nil {
+		t.Error("expected claude not to run")
+	}
+}
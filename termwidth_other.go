@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// fdWidth can't query the terminal on this platform, so COLUMNS is used instead
+func fdWidth(fd uintptr) (width int, ok bool) {
+	return 0, false
+}
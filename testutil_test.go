@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
+	"sync"
+	"time"
 )
 
 // mockWriter captures output written to it for testing
@@ -90,6 +93,15 @@ func createTestToolResultBlock(toolUseID, content string, isError bool) *Content
 	}
 }
 
+// createTestToolResultMessage creates the user message claude sends tool results back in
+func createTestToolResultMessage(blocks ...*ContentBlock) *UserMessage {
+	msg := &UserMessage{Type: "user", Message: UserMessageContent{Role: "user"}}
+	for _, block := range blocks {
+		msg.Message.Content = append(msg.Message.Content, *block)
+	}
+	return msg
+}
+
 // createTestSystemInit creates a SystemInit message for testing
 func createTestSystemInit(sessionID, model string) *SystemInit {
 	return &SystemInit{
@@ -128,6 +140,83 @@ func createTestResult(cost float64, duration int64, turns int) *Result {
 	}
 }
 
+// scriptedRunner is an in-memory Runner that replays pre-parsed messages on a timer.
+// Script entries that are errors go to the errors channel, everything else to messages.
+type scriptedRunner struct {
+	script   []interface{}
+	interval time.Duration
+	messages chan interface{}
+	errors   chan error
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newScriptedRunner creates a scriptedRunner that replays script with the given delay between entries
+func newScriptedRunner(script []interface{}, interval time.Duration) *scriptedRunner {
+	return &scriptedRunner{
+		script:   script,
+		interval: interval,
+		messages: make(chan interface{}, 100),
+		errors:   make(chan error, 10),
+		stop:     make(chan struct{}),
+	}
+}
+
+func (r *scriptedRunner) Start() error {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(r.messages)
+
+		for _, entry := range r.script {
+			select {
+			case <-time.After(r.interval):
+			case <-r.stop:
+				return
+			}
+
+			if err, ok := entry.(error); ok {
+				select {
+				case r.errors <- err:
+				case <-r.stop:
+					return
+				}
+				continue
+			}
+			select {
+			case r.messages <- entry:
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *scriptedRunner) Messages() <-chan interface{} { return r.messages }
+func (r *scriptedRunner) Errors() <-chan error         { return r.errors }
+func (r *scriptedRunner) Wait()                        { r.wg.Wait() }
+
+func (r *scriptedRunner) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.Wait()
+}
+
+// useScriptedRunner swaps newRunner for one returning runner, recording the args it was given.
+// It returns a pointer to the recorded args and a restore function.
+func useScriptedRunner(runner Runner) (*[]string, func()) {
+	var gotArgs []string
+	original := newRunner
+	newRunner = func(ctx context.Context, command, args []string) (Runner, error) {
+		gotArgs = args
+		return runner, nil
+	}
+	return &gotArgs, func() { newRunner = original }
+}
+
+var _ Runner = (*scriptedRunner)(nil)
+
 // discardWriter is an io.Writer that discards all output
 type discardWriter struct{}
 
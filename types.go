@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 )
 
 // MessageType represents the type of SDK message
@@ -89,6 +93,21 @@ type SystemInit struct {
 	UUID             string       `json:"uuid,omitempty"`
 }
 
+// HookEvent represents a user hook firing (system subtypes hook_started, hook_response)
+type HookEvent struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype"`
+	HookName  string `json:"hook_name,omitempty"`  // e.g. "PreToolUse:Bash"
+	HookEvent string `json:"hook_event,omitempty"` // e.g. "PreToolUse"
+	Outcome   string `json:"outcome,omitempty"`    // e.g. "success", "error"
+	Decision  string `json:"decision,omitempty"`   // e.g. "blocked", "approve"
+	ExitCode  *int   `json:"exit_code,omitempty"`
+	Stdout    string `json:"stdout,omitempty"`
+	Stderr    string `json:"stderr,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	UUID      string `json:"uuid,omitempty"`
+}
+
 // AssistantMessage represents an assistant response message
 type AssistantMessage struct {
 	Type              string         `json:"type"`
@@ -101,12 +120,20 @@ type AssistantMessage struct {
 	IsError           bool           `json:"is_error,omitempty"`
 }
 
+// AgentID returns the tool use ID of the Task whose agent sent the message, or "" for the main agent
+func (m *AssistantMessage) AgentID() string {
+	if m.ParentToolUseID == nil {
+		return ""
+	}
+	return *m.ParentToolUseID
+}
+
 // MessageContent represents the content of a message
 type MessageContent struct {
 	ID           string         `json:"id"`
 	Type         string         `json:"type"`
 	Role         string         `json:"role"`
-	Content      []ContentBlock `json:"content"`
+	Content      ContentBlocks  `json:"content"`
 	Model        string         `json:"model,omitempty"`
 	StopReason   string         `json:"stop_reason,omitempty"`
 	StopSequence string         `json:"stop_sequence,omitempty"`
@@ -228,6 +255,29 @@ func (c *ContentBlock) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("cannot unmarshal ContentBlock")
 }
 
+// ContentBlocks is a message's content. It is normally an array of blocks, but some
+// configurations send a bare string, which becomes a single text block.
+type ContentBlocks []ContentBlock
+
+// UnmarshalJSON handles both the array and plain string forms of message content
+func (b *ContentBlocks) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = nil
+		if text != "" {
+			*b = ContentBlocks{{Type: ContentBlockTypeText, Text: text}}
+		}
+		return nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*b = blocks
+	return nil
+}
+
 // StreamEventWrapper wraps a stream event from the Claude CLI
 type StreamEventWrapper struct {
 	Type            string       `json:"type"`
@@ -310,6 +360,35 @@ type TotalUsage struct {
 	CacheCreation            *CacheCreation `json:"cache_creation,omitempty"`
 }
 
+// FileOp flags how a session used a file
+type FileOp int
+
+const (
+	FileOpRead FileOp = 1 << iota
+	FileOpWrite
+	FileOpEdit
+)
+
+// Tags returns the operations as letters, e.g. "RE" for a file that was read and edited
+func (op FileOp) Tags() string {
+	var tags strings.Builder
+	for _, flag := range []struct {
+		op  FileOp
+		tag byte
+	}{{FileOpRead, 'R'}, {FileOpWrite, 'W'}, {FileOpEdit, 'E'}} {
+		if op&flag.op != 0 {
+			tags.WriteByte(flag.tag)
+		}
+	}
+	return tags.String()
+}
+
+// TodoItem is one entry of a TodoWrite list
+type TodoItem struct {
+	Content string `json:"content"`
+	Status  string `json:"status"` // pending, in_progress or completed
+}
+
 // CompactBoundary represents a boundary marker in the stream
 type CompactBoundary struct {
 	Type      string `json:"type"`
@@ -349,8 +428,8 @@ func (t *ToolUseResult) UnmarshalJSON(data []byte) error {
 
 // UserMessageContent represents the content of a user message
 type UserMessageContent struct {
-	Role    string         `json:"role"`
-	Content []ContentBlock `json:"content"`
+	Role    string        `json:"role"`
+	Content ContentBlocks `json:"content"`
 }
 
 // UserMessage represents a user input message (including tool results)
@@ -371,8 +450,43 @@ type ToolCall struct {
 	Status    ToolCallStatus  `json:"status"`
 	Result    string          `json:"result,omitempty"`
 	IsError   bool            `json:"is_error,omitempty"`
-	StartTime int64           `json:"start_time,omitempty"`
-	EndTime   int64           `json:"end_time,omitempty"`
+	IsImage   bool            `json:"is_image,omitempty"`   // Result flagged isImage by its tool_use_result
+	StartTime int64           `json:"start_time,omitempty"` // Unix milliseconds when the tool_use started
+	EndTime   int64           `json:"end_time,omitempty"`   // Unix milliseconds when its result arrived
+	AgentID   string          `json:"agent_id,omitempty"`   // Tool use ID of the Task whose agent called it, "" for the main agent
+
+	inputMap    map[string]interface{} // Parsed Input, cached by InputMap
+	inputParsed json.RawMessage        // Input the cached map was parsed from
+}
+
+// Elapsed returns how long the tool ran, or 0 if it hasn't both started and finished
+func (tc *ToolCall) Elapsed() time.Duration {
+	if tc.StartTime == 0 || tc.EndTime < tc.StartTime {
+		return 0
+	}
+	return time.Duration(tc.EndTime-tc.StartTime) * time.Millisecond
+}
+
+// finished reports whether the tool call has its result
+func (tc *ToolCall) finished() bool {
+	return tc.Status == ToolCallStatusCompleted || tc.Status == ToolCallStatusFailed
+}
+
+// InputMap returns Input parsed as a map, parsing once and reusing the result until Input changes.
+// Invalid input yields an empty map (graceful degradation).
+func (tc *ToolCall) InputMap() map[string]interface{} {
+	if tc.inputMap != nil && bytes.Equal(tc.inputParsed, tc.Input) {
+		return tc.inputMap
+	}
+
+	inputMap := make(map[string]interface{})
+	if len(tc.Input) > 0 {
+		// Ignore error - continue with empty map on failure
+		_ = json.Unmarshal(tc.Input, &inputMap)
+	}
+	tc.inputMap = inputMap
+	tc.inputParsed = tc.Input
+	return inputMap
 }
 
 // ToolCallStatus represents the current state of a tool call
@@ -395,6 +509,7 @@ type AgentState struct {
 	Children    []AgentState `json:"children,omitempty"`
 	ToolCalls   []ToolCall   `json:"tool_calls,omitempty"`
 	Depth       int          `json:"depth"`
+	Tokens      int          `json:"tokens,omitempty"` // Input and output tokens of the agent's own messages
 }
 
 // AgentStatus represents the current status of an agent
@@ -434,31 +549,48 @@ func (s *StreamState) Reset() {
 // AppState manages the complete application state including agent hierarchy
 type AppState struct {
 	// Tool call tracking
-	PendingTools map[string]*ToolCall `json:"pending_tools"` // tool ID -> ToolCall
+	PendingTools  map[string]*ToolCall     `json:"pending_tools"`  // tool ID -> ToolCall
+	OrphanResults map[string]*ContentBlock `json:"orphan_results"` // tool ID -> result that arrived before its tool_use
 
 	// Agent hierarchy
-	RootAgent    *AgentState `json:"root_agent"`    // Root agent (main)
-	CurrentAgent *AgentState `json:"current_agent"` // Currently active agent
-	AgentsByID   map[string]*AgentState `json:"agents_by_id"` // Quick lookup by tool use ID
+	RootAgent    *AgentState            `json:"root_agent"`    // Root agent (main)
+	CurrentAgent *AgentState            `json:"current_agent"` // Currently active agent
+	AgentsByID   map[string]*AgentState `json:"agents_by_id"`  // Quick lookup by tool use ID
+	HasSubagents bool                   `json:"has_subagents"` // True once any Task has spawned a child agent
+	BackgroundTasks map[string]bool     `json:"background_tasks,omitempty"` // IDs of run_in_background Task agents still running
 
 	// Token tracking
-	TotalTokens *TotalUsage `json:"total_tokens"`
+	TotalTokens   *TotalUsage `json:"total_tokens"`
+	ContextTokens int         `json:"context_tokens"` // Input tokens (including cache) of the latest request
+	messageUsage  map[string]*messageUsage // Usage already counted for each message ID
 
 	// Streaming state
 	Stream *StreamState `json:"stream"`
 
+	// Task tracking
+	Todos []TodoItem `json:"todos"` // Last list written by TodoWrite
+	Files map[string]FileOp `json:"files,omitempty"` // Paths the file tools used, and how
+
 	// Session info
 	SessionID string `json:"session_id"`
 	Model     string `json:"model"`
+	Cwd       string `json:"cwd,omitempty"` // Working directory claude runs in
+}
+
+// messageUsage is the usage counted so far for one message, and the agent it is charged to
+type messageUsage struct {
+	usage Usage
+	agent *AgentState
 }
 
 // NewAppState creates a new application state
 func NewAppState() *AppState {
 	return &AppState{
-		PendingTools: make(map[string]*ToolCall),
-		AgentsByID:   make(map[string]*AgentState),
-		TotalTokens: &TotalUsage{},
-		Stream:      NewStreamState(),
+		PendingTools:  make(map[string]*ToolCall),
+		OrphanResults: make(map[string]*ContentBlock),
+		AgentsByID:    make(map[string]*AgentState),
+		TotalTokens:   &TotalUsage{},
+		Stream:        NewStreamState(),
 	}
 }
 
@@ -466,6 +598,7 @@ func NewAppState() *AppState {
 func (a *AppState) InitializeSession(sysInit *SystemInit) {
 	a.SessionID = sysInit.SessionID
 	a.Model = sysInit.Model
+	a.Cwd = sysInit.CwdPath
 
 	// Create root agent
 	a.RootAgent = &AgentState{
@@ -480,27 +613,58 @@ func (a *AppState) InitializeSession(sysInit *SystemInit) {
 	a.AgentsByID["main"] = a.RootAgent
 }
 
-// AddOrUpdateToolCall adds or updates a tool call
+// AddOrUpdateToolCall adds or updates a tool call. An ID that arrives again after its call
+// completed (possible after a resume or compaction) starts a new call: the finished one is kept
+// under a suffixed key, so results keep routing to the call that is still running.
 func (a *AppState) AddOrUpdateToolCall(toolCall *ToolCall) {
+	reused := false
+	if prev, ok := a.PendingTools[toolCall.ID]; ok && prev != toolCall && prev.finished() {
+		a.retireToolID(toolCall.ID)
+		reused = true
+	}
 	a.PendingTools[toolCall.ID] = toolCall
 
 	// Add to current agent
 	if a.CurrentAgent != nil {
-		// Check if tool call already exists in agent
-		found := false
-		for i, tc := range a.CurrentAgent.ToolCalls {
-			if tc.ID == toolCall.ID {
-				a.CurrentAgent.ToolCalls[i] = *toolCall
-				found = true
-				break
-			}
-		}
-		if !found {
+		// Check if tool call already exists in agent; the latest call with the ID is the live one
+		i := lastToolCall(a.CurrentAgent.ToolCalls, toolCall.ID)
+		if i >= 0 && !reused {
+			a.CurrentAgent.ToolCalls[i] = *toolCall
+		} else {
 			a.CurrentAgent.ToolCalls = append(a.CurrentAgent.ToolCalls, *toolCall)
 		}
 	}
 }
 
+// retireToolID moves the finished call with toolID, and the agent it spawned if any, to the
+// first free "<id>#<n>" key so a new call can take the ID
+func (a *AppState) retireToolID(toolID string) {
+	key := toolID
+	for n := 2; ; n++ {
+		key = fmt.Sprintf("%s#%d", toolID, n)
+		if _, taken := a.PendingTools[key]; !taken {
+			break
+		}
+	}
+	a.PendingTools[key] = a.PendingTools[toolID]
+	delete(a.PendingTools, toolID)
+
+	if agent, ok := a.AgentsByID[toolID]; ok {
+		a.AgentsByID[key] = agent
+		delete(a.AgentsByID, toolID)
+	}
+}
+
+// lastToolCall returns the index of the latest call with toolID, or -1
+func lastToolCall(calls []ToolCall, toolID string) int {
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].ID == toolID {
+			return i
+		}
+	}
+	return -1
+}
+
 // CompleteToolCall marks a tool call as completed
 func (a *AppState) CompleteToolCall(toolID string, result string, isError bool) {
 	if tc, ok := a.PendingTools[toolID]; ok {
@@ -511,19 +675,34 @@ func (a *AppState) CompleteToolCall(toolID string, result string, isError bool)
 		}
 		tc.Result = result
 		tc.IsError = isError
+		tc.EndTime = time.Now().UnixMilli()
 
 		// Update in current agent's tool calls
 		if a.CurrentAgent != nil {
-			for i, t := range a.CurrentAgent.ToolCalls {
-				if t.ID == toolID {
-					a.CurrentAgent.ToolCalls[i] = *tc
-					break
-				}
+			if i := lastToolCall(a.CurrentAgent.ToolCalls, toolID); i >= 0 {
+				a.CurrentAgent.ToolCalls[i] = *tc
 			}
 		}
 	}
 }
 
+// AddOrphanResult buffers a tool result whose tool_use hasn't been seen yet
+func (a *AppState) AddOrphanResult(block *ContentBlock) {
+	if a.OrphanResults == nil {
+		a.OrphanResults = make(map[string]*ContentBlock)
+	}
+	a.OrphanResults[block.ToolUseID] = block
+}
+
+// TakeOrphanResult removes and returns the buffered result for a tool ID, if any
+func (a *AppState) TakeOrphanResult(toolID string) (*ContentBlock, bool) {
+	block, ok := a.OrphanResults[toolID]
+	if ok {
+		delete(a.OrphanResults, toolID)
+	}
+	return block, ok
+}
+
 // CreateChildAgent creates a new child agent from a Task tool call
 func (a *AppState) CreateChildAgent(parentToolID string, agentType string, description string) *AgentState {
 	parent := a.CurrentAgent
@@ -547,6 +726,7 @@ func (a *AppState) CreateChildAgent(parentToolID string, agentType string, descr
 
 	// Register in lookup map
 	a.AgentsByID[child.ID] = child
+	a.HasSubagents = true
 
 	return child
 }
@@ -570,6 +750,185 @@ func (a *AppState) UpdateTokens(usage *Usage) {
 	a.TotalTokens.CacheCreationInputTokens += usage.CacheCreationInputTokens
 	a.TotalTokens.CacheReadInputTokens += usage.CacheReadInputTokens
 	a.TotalTokens.TotalTokens = a.TotalTokens.InputTokens + a.TotalTokens.OutputTokens
+	if usage.CacheCreation != nil {
+		if a.TotalTokens.CacheCreation == nil {
+			a.TotalTokens.CacheCreation = &CacheCreation{}
+		}
+		a.TotalTokens.CacheCreation.Ephemeral5mInputTokens += usage.CacheCreation.Ephemeral5mInputTokens
+		a.TotalTokens.CacheCreation.Ephemeral1hInputTokens += usage.CacheCreation.Ephemeral1hInputTokens
+	}
+
+	// Each request resends the whole conversation, so its input is what occupies the context window
+	if context := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens; context > 0 {
+		a.ContextTokens = context
+	}
+}
+
+// RecordUsage counts a message's usage once, charging it to the agent that sent the message:
+// the Task agent whose tool use ID is agentID, or the main agent for "". claude repeats a
+// message's usage on each of its content blocks and again in message_delta, and the counts
+// only grow, so a message ID seen before only adds what grew since, and stays charged to the
+// agent it was first seen from. Usage without a message ID is always added.
+func (a *AppState) RecordUsage(messageID, agentID string, usage *Usage) {
+	if usage == nil {
+		return
+	}
+	if messageID == "" {
+		a.UpdateTokens(usage)
+		a.chargeAgent(a.usageAgent(agentID), usage)
+		return
+	}
+	if a.messageUsage == nil {
+		a.messageUsage = make(map[string]*messageUsage)
+	}
+	counted, ok := a.messageUsage[messageID]
+	if !ok {
+		counted = &messageUsage{agent: a.usageAgent(agentID)}
+		a.messageUsage[messageID] = counted
+	}
+
+	seen := counted.usage
+	latest := Usage{
+		InputTokens:              max(seen.InputTokens, usage.InputTokens),
+		OutputTokens:             max(seen.OutputTokens, usage.OutputTokens),
+		CacheCreationInputTokens: max(seen.CacheCreationInputTokens, usage.CacheCreationInputTokens),
+		CacheReadInputTokens:     max(seen.CacheReadInputTokens, usage.CacheReadInputTokens),
+		CacheCreation:            seen.CacheCreation,
+		ServiceTier:              usage.ServiceTier,
+	}
+	delta := &Usage{
+		InputTokens:              latest.InputTokens - seen.InputTokens,
+		OutputTokens:             latest.OutputTokens - seen.OutputTokens,
+		CacheCreationInputTokens: latest.CacheCreationInputTokens - seen.CacheCreationInputTokens,
+		CacheReadInputTokens:     latest.CacheReadInputTokens - seen.CacheReadInputTokens,
+	}
+	if usage.CacheCreation != nil {
+		before := CacheCreation{}
+		if seen.CacheCreation != nil {
+			before = *seen.CacheCreation
+		}
+		latest.CacheCreation = &CacheCreation{
+			Ephemeral5mInputTokens: max(before.Ephemeral5mInputTokens, usage.CacheCreation.Ephemeral5mInputTokens),
+			Ephemeral1hInputTokens: max(before.Ephemeral1hInputTokens, usage.CacheCreation.Ephemeral1hInputTokens),
+		}
+		delta.CacheCreation = &CacheCreation{
+			Ephemeral5mInputTokens: latest.CacheCreation.Ephemeral5mInputTokens - before.Ephemeral5mInputTokens,
+			Ephemeral1hInputTokens: latest.CacheCreation.Ephemeral1hInputTokens - before.Ephemeral1hInputTokens,
+		}
+	}
+	counted.usage = latest
+	a.UpdateTokens(delta)
+	a.chargeAgent(counted.agent, delta)
+
+	// The delta alone isn't the request's input, so take the context from the whole message
+	if context := latest.InputTokens + latest.CacheReadInputTokens + latest.CacheCreationInputTokens; context > 0 {
+		a.ContextTokens = context
+	}
+}
+
+// MessageUsage returns the usage counted so far for a message, and whether any was
+func (a *AppState) MessageUsage(messageID string) (Usage, bool) {
+	counted, ok := a.messageUsage[messageID]
+	if !ok {
+		return Usage{}, false
+	}
+	return counted.usage, true
+}
+
+// usageAgent returns the agent usage from agentID is charged to, or nil for a Task agent
+// that isn't tracked
+func (a *AppState) usageAgent(agentID string) *AgentState {
+	if agentID == "" {
+		return a.RootAgent
+	}
+	return a.AgentsByID[agentID]
+}
+
+// chargeAgent adds usage to an agent's tokens, so subagents' share can be shown
+func (a *AppState) chargeAgent(agent *AgentState, usage *Usage) {
+	if agent != nil {
+		agent.Tokens += usage.InputTokens + usage.OutputTokens
+	}
+}
+
+// TouchFile records that a file tool used path
+func (a *AppState) TouchFile(path string, op FileOp) {
+	if path == "" {
+		return
+	}
+	if a.Files == nil {
+		a.Files = make(map[string]FileOp)
+	}
+	a.Files[path] |= op
+}
+
+// StartBackgroundTask records a Task agent started with run_in_background and returns how many are running
+func (a *AppState) StartBackgroundTask(agentID string) int {
+	if a.BackgroundTasks == nil {
+		a.BackgroundTasks = make(map[string]bool)
+	}
+	a.BackgroundTasks[agentID] = true
+	return len(a.BackgroundTasks)
+}
+
+// FinishBackgroundTask records that a background Task agent completed and returns how many are
+// still running. ok is false when agentID isn't a running background task.
+func (a *AppState) FinishBackgroundTask(agentID string) (running int, ok bool) {
+	if !a.BackgroundTasks[agentID] {
+		return len(a.BackgroundTasks), false
+	}
+	delete(a.BackgroundTasks, agentID)
+	return len(a.BackgroundTasks), true
+}
+
+// ToolUsage is how many times a tool was called in the session, and how many of the calls failed
+type ToolUsage struct {
+	Name   string `json:"name"`
+	Calls  int    `json:"calls"`
+	Failed int    `json:"failed,omitempty"`
+}
+
+// ToolUsage counts the calls of each tool, most used first
+func (a *AppState) ToolUsage() []ToolUsage {
+	counts := make(map[string]*ToolUsage)
+	for _, tc := range a.PendingTools {
+		usage, ok := counts[tc.Name]
+		if !ok {
+			usage = &ToolUsage{Name: tc.Name}
+			counts[tc.Name] = usage
+		}
+		usage.Calls++
+		if tc.Status == ToolCallStatusFailed {
+			usage.Failed++
+		}
+	}
+
+	usages := make([]ToolUsage, 0, len(counts))
+	for _, usage := range counts {
+		usages = append(usages, *usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Calls != usages[j].Calls {
+			return usages[i].Calls > usages[j].Calls
+		}
+		return usages[i].Name < usages[j].Name
+	})
+	return usages
+}
+
+// TodoProgress counts the completed items of the last TodoWrite list
+func (a *AppState) TodoProgress() (completed, total int) {
+	return todoCounts(a.Todos)
+}
+
+// todoCounts counts the completed items of a todo list
+func todoCounts(todos []TodoItem) (completed, total int) {
+	for _, todo := range todos {
+		if todo.Status == "completed" {
+			completed++
+		}
+	}
+	return completed, len(todos)
 }
 
 // AppendStreamText appends text to the current streaming state
@@ -623,6 +982,14 @@ func ParseMessage(data []byte) (result interface{}, err error) {
 
 	switch base.Type {
 	case "system":
+		if strings.HasPrefix(base.Subtype, "hook_") {
+			var msg HookEvent
+			if err := json.Unmarshal(data, &msg); err != nil {
+				return nil, err
+			}
+			return &msg, nil
+		}
+
 		var msg SystemInit
 		if err := json.Unmarshal(data, &msg); err != nil {
 			return nil, err
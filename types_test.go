@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -330,6 +331,69 @@ func TestAppState_UpdateTokens(t *testing.T) {
 	}
 }
 
+func TestAppState_UpdateTokens_CacheCreation(t *testing.T) {
+	state := NewAppState()
+
+	// Usage without a breakdown leaves it unset
+	state.UpdateTokens(&Usage{InputTokens: 10, CacheCreationInputTokens: 5})
+	if state.TotalTokens.CacheCreation != nil {
+		t.Errorf("expected no cache creation breakdown, got %+v", state.TotalTokens.CacheCreation)
+	}
+
+	state.UpdateTokens(&Usage{
+		InputTokens:              100,
+		CacheCreationInputTokens: 150,
+		CacheCreation:            &CacheCreation{Ephemeral5mInputTokens: 100, Ephemeral1hInputTokens: 50},
+	})
+	state.UpdateTokens(&Usage{
+		InputTokens:              100,
+		CacheCreationInputTokens: 70,
+		CacheCreation:            &CacheCreation{Ephemeral5mInputTokens: 50, Ephemeral1hInputTokens: 20},
+	})
+
+	created := state.TotalTokens.CacheCreation
+	if created == nil {
+		t.Fatal("expected an accumulated cache creation breakdown")
+	}
+	if created.Ephemeral5mInputTokens != 150 {
+		t.Errorf("expected 5m cache creation tokens 150, got %d", created.Ephemeral5mInputTokens)
+	}
+	if created.Ephemeral1hInputTokens != 70 {
+		t.Errorf("expected 1h cache creation tokens 70, got %d", created.Ephemeral1hInputTokens)
+	}
+	if state.TotalTokens.CacheCreationInputTokens != 225 {
+		t.Errorf("expected cache creation tokens 225, got %d", state.TotalTokens.CacheCreationInputTokens)
+	}
+}
+
+// TestAppState_RecordUsage tests a message's repeated usage is counted once, keeping what grew
+func TestAppState_RecordUsage(t *testing.T) {
+	state := NewAppState()
+
+	// Repeated on each content block, then message_delta reports the final output alone
+	state.RecordUsage("msg_1", "", &Usage{InputTokens: 1000, OutputTokens: 20, CacheReadInputTokens: 300})
+	state.RecordUsage("msg_1", "", &Usage{InputTokens: 1000, OutputTokens: 20, CacheReadInputTokens: 300})
+	state.RecordUsage("msg_1", "", &Usage{OutputTokens: 50})
+	state.RecordUsage("msg_2", "", &Usage{InputTokens: 1100, OutputTokens: 10})
+
+	if state.TotalTokens.InputTokens != 2100 || state.TotalTokens.OutputTokens != 60 {
+		t.Errorf("expected 2100 in and 60 out, got %d in and %d out", state.TotalTokens.InputTokens, state.TotalTokens.OutputTokens)
+	}
+	if state.TotalTokens.CacheReadInputTokens != 300 {
+		t.Errorf("expected cache read tokens 300, got %d", state.TotalTokens.CacheReadInputTokens)
+	}
+	if state.ContextTokens != 1100 {
+		t.Errorf("expected context tokens 1100, got %d", state.ContextTokens)
+	}
+
+	// Without an ID there's nothing to match repeats by
+	state.RecordUsage("", "", &Usage{OutputTokens: 5})
+	state.RecordUsage("", "", &Usage{OutputTokens: 5})
+	if state.TotalTokens.OutputTokens != 70 {
+		t.Errorf("expected 70 out, got %d", state.TotalTokens.OutputTokens)
+	}
+}
+
 func TestToolUseResult_UnmarshalJSON_String(t *testing.T) {
 	jsonData := []byte(`"simple string result"`)
 
@@ -558,6 +622,38 @@ func TestAppState_CompleteToolCall_NonExistent(t *testing.T) {
 	}
 }
 
+func TestAppState_AddOrUpdateToolCall_ReusedID(t *testing.T) {
+	state := NewAppState()
+	state.InitializeSession(&SystemInit{SessionID: "test"})
+
+	first := &ToolCall{ID: "toolu_1", Name: "Read", Status: ToolCallStatusPending}
+	state.AddOrUpdateToolCall(first)
+	state.CompleteToolCall("toolu_1", "file contents", false)
+
+	// The same ID after a resume is a new call, not an update of the finished one
+	second := &ToolCall{ID: "toolu_1", Name: "Bash", Status: ToolCallStatusPending}
+	state.AddOrUpdateToolCall(second)
+	state.CompleteToolCall("toolu_1", "ok", true)
+
+	if state.PendingTools["toolu_1"] != second {
+		t.Fatalf("expected the ID to route to the new call, got: %+v", state.PendingTools["toolu_1"])
+	}
+	if state.PendingTools["toolu_1#2"] != first {
+		t.Fatalf("expected the finished call kept under toolu_1#2, got: %+v", state.PendingTools["toolu_1#2"])
+	}
+	if first.Result != "file contents" || first.IsError {
+		t.Errorf("expected the first call's result untouched, got: %q (error %v)", first.Result, first.IsError)
+	}
+	if second.Result != "ok" || second.Status != ToolCallStatusFailed {
+		t.Errorf("expected the second result on the second call, got: %q (%s)", second.Result, second.Status)
+	}
+
+	calls := state.CurrentAgent.ToolCalls
+	if len(calls) != 2 || calls[0].Name != "Read" || calls[0].Result != "file contents" || calls[1].Name != "Bash" || calls[1].Result != "ok" {
+		t.Errorf("expected both calls tracked on the agent, got: %+v", calls)
+	}
+}
+
 func TestAppState_AddOrUpdateToolCall_NilCurrentAgent(t *testing.T) {
 	state := NewAppState()
 	state.InitializeSession(&SystemInit{SessionID: "test"})
@@ -1652,3 +1748,101 @@ func FuzzToolUseResult_UnmarshalJSON(f *testing.F) {
 		}
 	})
 }
+
+func TestParseMessage_HookEvent(t *testing.T) {
+	data := []byte(`{"type":"system","subtype":"hook_response","hook_name":"PreToolUse:Bash","hook_event":"PreToolUse","decision":"blocked","exit_code":2,"session_id":"s1"}`)
+
+	msg, err := ParseMessage(data)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	hook, ok := msg.(*HookEvent)
+	if !ok {
+		t.Fatalf("expected *HookEvent, got %T", msg)
+	}
+	if hook.HookEvent != "PreToolUse" || hook.Decision != "blocked" || hook.ExitCode == nil || *hook.ExitCode != 2 {
+		t.Errorf("unexpected hook event: %+v", hook)
+	}
+}
+
+func TestToolCall_InputMapCached(t *testing.T) {
+	tc := createTestToolCall("tool_1", "Bash", map[string]interface{}{"command": "ls"})
+
+	if tc.InputMap()["command"] != "ls" {
+		t.Fatalf("unexpected input map: %v", tc.InputMap())
+	}
+	// Parsing allocates; the cached map doesn't
+	if allocs := testing.AllocsPerRun(10, func() { tc.InputMap() }); allocs != 0 {
+		t.Errorf("expected the parsed input reused, got %.0f allocations per call", allocs)
+	}
+
+	// Replacing the input invalidates the cache
+	tc.Input = []byte(`{"command":"pwd"}`)
+	if tc.InputMap()["command"] != "pwd" {
+		t.Errorf("expected updated input after change, got: %v", tc.InputMap())
+	}
+}
+
+func TestParseMessage_AssistantStringContent(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":"The build passes."}}`))
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	assistant, ok := msg.(*AssistantMessage)
+	if !ok {
+		t.Fatalf("expected *AssistantMessage, got %T", msg)
+	}
+	content := assistant.Message.Content
+	if len(content) != 1 || content[0].Type != ContentBlockTypeText || content[0].Text != "The build passes." {
+		t.Fatalf("expected a single text block, got: %+v", content)
+	}
+
+	p, w := newTestOutputProcessor(OutputModeText)
+	p.processMessage(msg)
+	if !strings.Contains(w.String(), "The build passes.\n") {
+		t.Errorf("expected string content rendered as text, got: %q", w.String())
+	}
+}
+
+// TestAppState_TouchFile tests operations on the same file accumulate
+func TestAppState_TouchFile(t *testing.T) {
+	state := NewAppState()
+	state.TouchFile("/a.go", FileOpRead)
+	state.TouchFile("/a.go", FileOpEdit)
+	state.TouchFile("", FileOpWrite)
+
+	if len(state.Files) != 1 || state.Files["/a.go"].Tags() != "RE" {
+		t.Errorf("expected /a.go tagged RE, got: %v", state.Files)
+	}
+}
+
+func TestAppState_BackgroundTasks(t *testing.T) {
+	state := NewAppState()
+	state.StartBackgroundTask("task_1")
+	if running := state.StartBackgroundTask("task_2"); running != 2 {
+		t.Errorf("expected 2 background tasks running, got %d", running)
+	}
+
+	if running, ok := state.FinishBackgroundTask("task_1"); !ok || running != 1 {
+		t.Errorf("FinishBackgroundTask(task_1) = %d, %v, want 1, true", running, ok)
+	}
+	if _, ok := state.FinishBackgroundTask("task_1"); ok {
+		t.Error("expected a finished task not to finish twice")
+	}
+}
+
+func TestAppState_ToolUsage(t *testing.T) {
+	state := NewAppState()
+	for i, name := range []string{"Read", "Grep", "Grep", "Bash"} {
+		id := fmt.Sprintf("tool_%d", i)
+		state.AddOrUpdateToolCall(&ToolCall{ID: id, Name: name})
+		state.CompleteToolCall(id, "", name == "Grep")
+	}
+
+	want := []ToolUsage{{"Grep", 2, 2}, {"Bash", 1, 0}, {"Read", 1, 0}}
+	if got := state.ToolUsage(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ToolUsage() = %v, want %v", got, want)
+	}
+}
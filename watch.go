@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchPollInterval is how often --watch checks the watched files for changes
+var watchPollInterval = 500 * time.Millisecond
+
+// clearScreen moves the cursor home and clears the terminal (--watch-clear)
+const clearScreen = "\033[H\033[2J"
+
+// watchArgs takes --watch <glob> and --watch-clear out of args, returning the remaining
+// arguments for each run. ok is false when --watch isn't given.
+func watchArgs(args []string) (pattern string, clearBetween bool, rest []string, ok bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case arg == "--watch" || arg == "-watch":
+			if i+1 < len(args) {
+				i++
+				pattern, ok = args[i], true
+			}
+		case strings.HasPrefix(arg, "--watch="):
+			pattern, ok = strings.TrimPrefix(arg, "--watch="), true
+		case arg == "--watch-clear" || arg == "-watch-clear":
+			clearBetween = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return pattern, clearBetween, rest, ok
+}
+
+// snapshotFiles records the modification time of every file matching pattern
+func snapshotFiles(pattern string) (map[string]time.Time, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]time.Time, len(matches))
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files[path] = info.ModTime()
+		}
+	}
+	return files, nil
+}
+
+// filesChanged reports whether any file was added, removed or modified between snapshots
+func filesChanged(before, after map[string]time.Time) bool {
+	if len(before) != len(after) {
+		return true
+	}
+	for path, mtime := range after {
+		if prev, ok := before[path]; !ok || !prev.Equal(mtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// runWatch runs args, then waits for a file matching pattern to change and runs them again,
+// until ctx is canceled (Ctrl-C). Files are polled rather than watched, and the baseline is
+// taken after each run, so claude's own edits during a run don't trigger the next one.
+// It returns the exit code of the last run.
+func runWatch(ctx context.Context, pattern string, clearBetween bool, args []string, stdout io.Writer) int {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --watch pattern: %v\n", err)
+		return 1
+	}
+
+	for {
+		code := run(args, stdout)
+		if ctx.Err() != nil {
+			return code
+		}
+
+		before, _ := snapshotFiles(pattern)
+		c := GetScheme()
+		fmt.Fprintf(stdout, "\n%s[watching %s for changes, Ctrl-C to stop]%s\n", c.LabelDim, pattern, c.Reset)
+
+		ticker := time.NewTicker(watchPollInterval)
+		for changed := false; !changed; {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return code
+			case <-ticker.C:
+				after, _ := snapshotFiles(pattern)
+				changed = filesChanged(before, after)
+			}
+		}
+		ticker.Stop()
+
+		if clearBetween {
+			fmt.Fprint(stdout, clearScreen)
+		}
+	}
+}
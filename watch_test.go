@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchArgs(t *testing.T) {
+	pattern, clearBetween, rest, ok := watchArgs([]string{"--watch", "*.go", "--watch-clear", "--verbose", "Fix the tests"})
+	if !ok || pattern != "*.go" || !clearBetween {
+		t.Errorf("watchArgs() = %q, %v, ok %v", pattern, clearBetween, ok)
+	}
+	if len(rest) != 2 || rest[0] != "--verbose" || rest[1] != "Fix the tests" {
+		t.Errorf("expected the other args kept, got %q", rest)
+	}
+
+	if _, _, _, ok := watchArgs([]string{"--", "--watch", "*.go"}); ok {
+		t.Error("expected --watch after -- to be left for claude")
+	}
+}
+
+func TestFilesChanged(t *testing.T) {
+	now := time.Now()
+	before := map[string]time.Time{"a.go": now}
+	for name, after := range map[string]map[string]time.Time{
+		"modified": {"a.go": now.Add(time.Second)},
+		"added":    {"a.go": now, "b.go": now},
+		"removed":  {},
+	} {
+		if !filesChanged(before, after) {
+			t.Errorf("expected %s file to count as a change", name)
+		}
+	}
+	if filesChanged(before, map[string]time.Time{"a.go": now}) {
+		t.Error("expected identical snapshots to be unchanged")
+	}
+}
+
+// TestRunWatch tests a change to a watched file triggers another run
+func TestRunWatch(t *testing.T) {
+	original, interval := newRunner, watchPollInterval
+	defer func() { newRunner, watchPollInterval = original, interval }()
+	watchPollInterval = 5 * time.Millisecond
+
+	runs := make(chan struct{}, 10)
+	newRunner = func(ctx context.Context, command, args []string) (Runner, error) {
+		runs <- struct{}{}
+		return newScriptedRunner([]interface{}{createTestResult(0.01, 1000, 1)}, 0), nil
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main_test.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() {
+		done <- runWatch(ctx, filepath.Join(dir, "*.go"), false, []string{"--quiet", "Fix the tests"}, io.Discard)
+	}()
+
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a first run")
+	}
+
+	// Keep touching the file until the watcher, which snapshots after each run, sees a change
+	mtime := time.Now()
+	deadline := time.After(5 * time.Second)
+	for second := false; !second; {
+		mtime = mtime.Add(time.Second)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-runs:
+			second = true
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("expected the change to trigger a second run")
+		}
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Errorf("runWatch() = %d, want 0", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected runWatch to stop when canceled")
+	}
+}